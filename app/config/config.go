@@ -2,8 +2,10 @@ package config
 
 import (
 	"fmt"
+	"path"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/jo-hoe/goback"
 	"gopkg.in/yaml.v2"
@@ -23,24 +25,275 @@ type Config struct {
 
 	// Processing controls what to do with a mail after a successful webhook call.
 	Processing Processing `yaml:"processing"`
+
+	// MessageScope selects whether selectors and attachment strategies operate on the mail itself
+	// ("outer", default) or on the original message of a mail forwarded as attachment ("innermost").
+	MessageScope MessageScope `yaml:"messageScope"`
+
+	// SenderAuthentication controls which Authentication-Results are trusted and whether mails whose
+	// From domain is not authenticated are processed.
+	SenderAuthentication SenderAuthentication `yaml:"senderAuthentication"`
+
+	// Inbound configures push-based ingestion; when enabled the service runs as a server instead of polling once.
+	Inbound Inbound `yaml:"inbound"`
 }
 
 // MailSelectorConfig defines a single mail selector rule.
 type MailSelectorConfig struct {
 	Name         string `yaml:"name"`
-	Type         string `yaml:"type"`         // "subjectRegex" | "bodyRegex" | "attachmentNameRegex" | "senderRegex" | "recipientRegex"
+	Type         string `yaml:"type"`         // "subjectRegex" | "bodyRegex" | "attachmentNameRegex" | "senderRegex" | "authenticatedSenderRegex" | "recipientRegex" | "headerRegex"
 	Pattern      string `yaml:"pattern"`      // regex pattern
 	CaptureGroup int    `yaml:"captureGroup"` // 0 = full match (default)
+	Target       string `yaml:"target"`       // bodyRegex only: "text" (default; plain or HTML-derived text) | "html"
+	Header       string `yaml:"header"`       // headerRegex only: header field name, e.g. "Message-ID"
 }
 
 // GmailClient holds Gmail-specific client configuration.
 type GmailClient struct {
 	Enabled bool `yaml:"enabled"`
+	// CredentialsPath is the directory holding client_secret.json and request.token; defaults to "/secrets/mail".
+	CredentialsPath string `yaml:"credentialsPath"`
+	// Query is the Gmail search query selecting the mails to process; defaults to "is:unread".
+	// Labels, NewerThan and In are appended to it as label:, newer_than: and in: clauses.
+	Query string `yaml:"query"`
+	// Labels restricts processing to mails carrying all of these labels, e.g. ["Invoices"].
+	Labels []string `yaml:"labels"`
+	// NewerThan restricts processing to mails newer than a relative age such as "7d", "2m" or "1y".
+	NewerThan string `yaml:"newerThan"`
+	// In restricts the search to a location such as "inbox", "anywhere" or "sent".
+	In string `yaml:"in"`
+	// IncludeSpamTrash also lists mails in spam and trash.
+	IncludeSpamTrash bool `yaml:"includeSpamTrash"`
+	// MaxMessages caps the number of mails listed per run across all result pages; defaults to 500.
+	// The full sync that starts a history checkpoint is not capped.
+	MaxMessages int `yaml:"maxMessages"`
+	// Concurrency bounds the parallel message and attachment requests; defaults to 8.
+	Concurrency int `yaml:"concurrency"`
+	// QuotaUnitsPerSecond is the Gmail quota budget spent per second; defaults to 250, the per-user
+	// limit. Lower it when other clients share the mailbox quota.
+	QuotaUnitsPerSecond int `yaml:"quotaUnitsPerSecond"`
+	// ServiceAccount authenticates as a Google Workspace service account impersonating a mailbox
+	// user (domain-wide delegation) instead of using a user OAuth token.
+	ServiceAccount GmailServiceAccount `yaml:"serviceAccount"`
+	// TokenStore selects where the user OAuth token is read from and refreshed tokens are written to.
+	TokenStore GmailTokenStore `yaml:"tokenStore"`
+	// History enables incremental sync via the Gmail History API instead of listing Query on every run.
+	History GmailHistory `yaml:"history"`
+	// Push enables near-real-time processing via Gmail push notifications (Cloud Pub/Sub).
+	Push GmailPush `yaml:"push"`
+}
+
+// GmailServiceAccount configures service-account (JWT) credentials with domain-wide delegation.
+// The service account's client ID must be granted the gmail.modify scope in the Workspace admin console.
+type GmailServiceAccount struct {
+	Enabled bool `yaml:"enabled"`
+	// KeyFile is the JSON key of the service account; defaults to "<credentialsPath>/service_account.json".
+	KeyFile string `yaml:"keyFile"`
+	// Subject is the mailbox user to impersonate, e.g. "invoices@example.com".
+	Subject string `yaml:"subject"`
+}
+
+// GmailTokenStore configures the storage of the user OAuth token.
+type GmailTokenStore struct {
+	// Type is "file" (default; request.token in credentialsPath), "env" or "kubernetesSecret".
+	Type string `yaml:"type"`
+	// EnvVar is the variable holding the token JSON for type "env"; defaults to "GMAIL_TOKEN".
+	EnvVar string `yaml:"envVar"`
+	// SecretName is the Secret holding the token for type "kubernetesSecret"; it is patched on refresh.
+	SecretName string `yaml:"secretName"`
+	// SecretNamespace defaults to the namespace of the pod.
+	SecretNamespace string `yaml:"secretNamespace"`
+	// SecretKey is the key of the token in the Secret; defaults to "request.token".
+	SecretKey string `yaml:"secretKey"`
+}
+
+// GmailHistory configures incremental sync: only messages added since the history ID stored in
+// the checkpoint file are processed, independent of their read state. Query is only used for the
+// initial sync and when the stored history ID has expired.
+type GmailHistory struct {
+	Enabled bool `yaml:"enabled"`
+	// CheckpointPath is the file storing the last synced history ID; it must be writable and persistent.
+	CheckpointPath string `yaml:"checkpointPath"`
+	// LabelIDs restricts processing to added messages carrying all of these labels; defaults to ["INBOX"].
+	LabelIDs []string `yaml:"labelIds"`
+}
+
+// GmailPush configures Gmail push notifications delivered by a Pub/Sub push subscription.
+// When enabled the service runs as a server, renews the watch periodically and processes
+// the messages added since the previous notification.
+type GmailPush struct {
+	Enabled bool `yaml:"enabled"`
+	// Topic is the Pub/Sub topic Gmail publishes to, e.g. "projects/my-project/topics/gmail".
+	Topic string `yaml:"topic"`
+	// LabelIDs restricts notifications to changes of these labels; defaults to ["INBOX"].
+	LabelIDs []string `yaml:"labelIds"`
+	// ListenAddress is the TCP address of the push endpoint; defaults to ":8080".
+	ListenAddress string `yaml:"listenAddress"`
+	// Path is the push endpoint path; defaults to "/gmail/push".
+	Path string `yaml:"path"`
+	// Audience is the audience configured for the OIDC token of the push subscription.
+	Audience string `yaml:"audience"`
+	// ServiceAccountEmail must match the verified email claim of the OIDC token, since Google signs
+	// tokens for any service account with the same audience.
+	ServiceAccountEmail string `yaml:"serviceAccountEmail"`
+	// RenewInterval is how often the watch is renewed (watches expire after 7 days); defaults to "24h".
+	RenewInterval         string        `yaml:"renewInterval"`
+	RenewIntervalDuration time.Duration `yaml:"-"`
+}
+
+// IMAPClient holds IMAP-specific client configuration.
+type IMAPClient struct {
+	Enabled bool   `yaml:"enabled"`
+	Host    string `yaml:"host"`
+	Port    int    `yaml:"port"` // defaults to 993 for implicit TLS, 143 otherwise
+	// Security selects the transport: "tls" (default, implicit TLS), "starttls" or "none".
+	Security string `yaml:"security"`
+	// InsecureSkipVerify disables server certificate verification; only use for testing.
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
+	Username           string `yaml:"username"`
+	Password           string `yaml:"password"`
+	// PasswordFile is read at runtime when Password is empty (e.g. a mounted Secret).
+	PasswordFile string `yaml:"passwordFile"`
+	// Folder is the mailbox searched for unseen mails; defaults to "INBOX".
+	Folder string `yaml:"folder"`
+}
+
+// POP3Client holds POP3-specific client configuration.
+type POP3Client struct {
+	Enabled bool   `yaml:"enabled"`
+	Host    string `yaml:"host"`
+	Port    int    `yaml:"port"` // defaults to 995 for implicit TLS, 110 otherwise
+	// Security selects the transport: "tls" (default, implicit TLS), "starttls" (STLS) or "none".
+	Security string `yaml:"security"`
+	// InsecureSkipVerify disables server certificate verification; only use for testing.
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
+	Username           string `yaml:"username"`
+	Password           string `yaml:"password"`
+	// PasswordFile is read at runtime when Password is empty (e.g. a mounted Secret).
+	PasswordFile string `yaml:"passwordFile"`
+	// LedgerPath is the writable file persisting the UIDLs of processed messages.
+	// POP3 has no read flag, so this file replaces markRead; it must survive between runs.
+	LedgerPath string `yaml:"ledgerPath"`
+}
+
+// FilesystemClient holds configuration for reading a locally delivered mailbox.
+type FilesystemClient struct {
+	Enabled bool `yaml:"enabled"`
+	// Format is "maildir" (default) or "mbox". The mbox file is never modified.
+	Format string `yaml:"format"`
+	// Path is the Maildir root (containing new/ and cur/) or the mbox file.
+	Path string `yaml:"path"`
+	// LedgerPath is the writable file persisting the IDs of processed messages; required for mbox,
+	// where it replaces both processed actions. It must survive between runs.
+	LedgerPath string `yaml:"ledgerPath"`
+}
+
+// GraphClient holds Microsoft Graph (Outlook / Exchange Online) client configuration.
+// Authentication uses the OAuth2 client-credentials flow of an Entra ID app registration
+// with the Mail.ReadWrite application permission.
+type GraphClient struct {
+	Enabled  bool   `yaml:"enabled"`
+	TenantID string `yaml:"tenantId"`
+	ClientID string `yaml:"clientId"`
+	// ClientSecret of the app registration; ClientSecretFile is read at runtime when empty.
+	ClientSecret     string `yaml:"clientSecret"`
+	ClientSecretFile string `yaml:"clientSecretFile"`
+	// User is the user ID or principal name of the mailbox to process.
+	User string `yaml:"user"`
+	// Folder is the mail folder ID or well-known name; defaults to "inbox".
+	Folder string `yaml:"folder"`
+	// BaseURL defaults to https://graph.microsoft.com/v1.0.
+	BaseURL string `yaml:"baseUrl"`
+	// TokenURL defaults to https://login.microsoftonline.com/<tenantId>/oauth2/v2.0/token.
+	TokenURL string `yaml:"tokenUrl"`
+}
+
+// JMAPClient holds JMAP (RFC 8620/8621) client configuration, e.g. for Fastmail or Stalwart.
+type JMAPClient struct {
+	Enabled bool `yaml:"enabled"`
+	// SessionURL is the JMAP session resource, e.g. https://api.fastmail.com/jmap/session.
+	SessionURL string `yaml:"sessionUrl"`
+	// Token is sent as a Bearer token; when Username is set it is used as the Basic auth password instead.
+	Token     string `yaml:"token"`
+	TokenFile string `yaml:"tokenFile"`
+	Username  string `yaml:"username"`
+	// Mailbox is the role of the mailbox to process; defaults to "inbox".
+	Mailbox string `yaml:"mailbox"`
+	// DeleteMode selects how the delete action works: "trash" (default, move to the Trash role mailbox) or "destroy".
+	DeleteMode string `yaml:"deleteMode"`
+}
+
+// MailAccount is a named mail client; each account is processed separately in a run.
+type MailAccount struct {
+	Name       string `yaml:"name"`
+	MailClient `yaml:",inline"`
 }
 
 // MailClient holds mail client configuration.
+// Exactly one client must be enabled; Gmail is enabled when no other client is.
+// Alternatively, Accounts lists several named clients, in which case no top-level client may be enabled.
 type MailClient struct {
-	Gmail GmailClient `yaml:"gmail"`
+	Accounts   []MailAccount    `yaml:"accounts"`
+	Gmail      GmailClient      `yaml:"gmail"`
+	IMAP       IMAPClient       `yaml:"imap"`
+	POP3       POP3Client       `yaml:"pop3"`
+	Filesystem FilesystemClient `yaml:"filesystem"`
+	Graph      GraphClient      `yaml:"graph"`
+	JMAP       JMAPClient       `yaml:"jmap"`
+}
+
+// Inbound holds the push-based ingestion listeners.
+type Inbound struct {
+	SMTP SMTPInbound `yaml:"smtp"`
+	HTTP HTTPInbound `yaml:"http"`
+}
+
+// Enabled reports whether any inbound listener is enabled.
+func (in Inbound) Enabled() bool {
+	return in.SMTP.Enabled || in.HTTP.Enabled
+}
+
+// SMTPInbound configures the embedded SMTP receiver.
+type SMTPInbound struct {
+	Enabled bool `yaml:"enabled"`
+	// ListenAddress is the TCP address to listen on; defaults to ":2525".
+	ListenAddress string `yaml:"listenAddress"`
+	// Domain is the hostname announced in the greeting; defaults to "localhost".
+	Domain string `yaml:"domain"`
+	// AllowedRecipientDomains lists the domains RCPT TO is accepted for; all other recipients are rejected.
+	AllowedRecipientDomains []string `yaml:"allowedRecipientDomains"`
+	// MaxMessageSize limits the size of a message (e.g. "25MB"); defaults to "25MB".
+	MaxMessageSize      string `yaml:"maxMessageSize"`
+	MaxMessageSizeBytes int64  `yaml:"-"`
+	// TLSCertFile and TLSKeyFile enable STARTTLS when both are set.
+	TLSCertFile string `yaml:"tlsCertFile"`
+	TLSKeyFile  string `yaml:"tlsKeyFile"`
+}
+
+// HTTPInbound configures the HTTP inbound-parse endpoints. Each format is served on its own path;
+// an empty path disables that format.
+type HTTPInbound struct {
+	Enabled bool `yaml:"enabled"`
+	// ListenAddress is the TCP address to listen on; defaults to ":8080".
+	ListenAddress string `yaml:"listenAddress"`
+	// RawPath accepts a raw RFC 822 message as request body (e.g. Content-Type message/rfc822).
+	RawPath string `yaml:"rawPath"`
+	// MailgunPath accepts Mailgun route forwards (parsed fields or body-mime).
+	MailgunPath string `yaml:"mailgunPath"`
+	// SendGridPath accepts SendGrid Inbound Parse posts (parsed fields or raw "email" field).
+	SendGridPath string `yaml:"sendgridPath"`
+	// MaxMessageSize limits the request body size (e.g. "25MB"); defaults to "25MB".
+	MaxMessageSize      string `yaml:"maxMessageSize"`
+	MaxMessageSizeBytes int64  `yaml:"-"`
+	// Username and Password are the HTTP Basic auth credentials required on RawPath and SendGridPath;
+	// PasswordFile is read at startup when Password is empty (e.g. a mounted Secret).
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
+	PasswordFile string `yaml:"passwordFile"`
+	// MailgunSigningKey is the Mailgun HTTP webhook signing key that verifies the signature of
+	// requests on MailgunPath; MailgunSigningKeyFile is read at startup when it is empty.
+	MailgunSigningKey     string `yaml:"mailgunSigningKey"`
+	MailgunSigningKeyFile string `yaml:"mailgunSigningKeyFile"`
 }
 
 // Processing controls post-processing behaviour after a successful webhook call.
@@ -50,6 +303,30 @@ type Processing struct {
 	ProcessedAction string `yaml:"processedAction"`
 }
 
+// SenderAuthentication configures the evaluation of the SPF, DKIM, DMARC and ARC results that the
+// receiving mail server records in Authentication-Results headers. A sender is authenticated by
+// dkim=pass for a domain aligned with the From domain, or by dmarc=pass for the From domain.
+type SenderAuthentication struct {
+	// Required skips mails whose sender is not authenticated, whatever the selectors match.
+	Required bool `yaml:"required"`
+	// TrustedAuthServIDs are the authserv-ids (e.g. "mx.google.com") whose Authentication-Results
+	// are evaluated; only the topmost of them counts. Required with Required or an authenticatedSenderRegex selector, since a sender
+	// delivering directly (e.g. to the SMTP or HTTP inbound endpoint) writes the topmost header itself.
+	TrustedAuthServIDs []string `yaml:"trustedAuthServIds"`
+	// TrustedARCSealers are the ARC sealer domains (d= of ARC-Seal), e.g. of a mailing list that breaks
+	// DKIM signatures, whose ARC-Authentication-Results of the highest instance are evaluated when the
+	// trusted results report arc=pass.
+	TrustedARCSealers []string `yaml:"trustedArcSealers"`
+}
+
+// MessageScope selects the message that selectors and attachment strategies operate on.
+type MessageScope string
+
+const (
+	MessageScopeOuter     MessageScope = "outer"
+	MessageScopeInnermost MessageScope = "innermost"
+)
+
 // AttachmentStrategy is a strongly-typed enum for attachment handling behaviour.
 type AttachmentStrategy string
 
@@ -57,6 +334,16 @@ const (
 	StrategyIgnore                 AttachmentStrategy = "ignore"
 	StrategyMultipartBundle        AttachmentStrategy = "multipartBundle"
 	StrategyMultipartPerAttachment AttachmentStrategy = "multipartPerAttachment"
+	// StrategyOriginalMessage sends the unmodified RFC 822 source of the mail as a message/rfc822 file.
+	StrategyOriginalMessage AttachmentStrategy = "originalMessage"
+)
+
+// InlineAttachments selects whether inline parts (e.g. images embedded in the HTML body) are forwarded.
+type InlineAttachments string
+
+const (
+	InlineInclude InlineAttachments = "include"
+	InlineExclude InlineAttachments = "exclude"
 )
 
 // AttachmentsConfig controls forwarding of attachments in webhook requests.
@@ -68,6 +355,39 @@ type AttachmentsConfig struct {
 	// MaxSize is an optional per-attachment size limit (e.g. "200Mi"); empty or "0" means no limit.
 	MaxSize      string `yaml:"maxSize"`
 	MaxSizeBytes int64  `yaml:"-"`
+	// Inline is "include" (default) or "exclude" to drop inline parts such as embedded logos.
+	Inline InlineAttachments `yaml:"inline"`
+	// WithAttachments adds the regular attachments after the original message (originalMessage only).
+	WithAttachments bool `yaml:"withAttachments"`
+	// Archives expands zip, tar and tar.gz attachments into their members before selection and delivery.
+	Archives ArchiveExpansion `yaml:"archives"`
+}
+
+// ArchiveExpansion configures the opt-in expansion of archive attachments. The limits defend
+// against zip bombs: an archive exceeding them is forwarded unexpanded.
+type ArchiveExpansion struct {
+	Enabled bool `yaml:"enabled"`
+	// Include is a glob matched case-insensitively against member filenames, e.g. "*.pdf"; defaults to "*".
+	Include string `yaml:"include"`
+	// MaxDepth is the number of nested archive levels expanded; defaults to 2.
+	MaxDepth int `yaml:"maxDepth"`
+	// MaxEntries caps the members of an archive, nested archives included; defaults to 100.
+	MaxEntries int `yaml:"maxEntries"`
+	// MaxTotalSize caps the uncompressed size of an archive (e.g. "100Mi"); defaults to "100Mi".
+	MaxTotalSize      string `yaml:"maxTotalSize"`
+	MaxTotalSizeBytes int64  `yaml:"-"`
+}
+
+// ForwardsAttachments reports whether the regular attachments of a mail are sent with the webhook.
+func (a AttachmentsConfig) ForwardsAttachments() bool {
+	switch a.Strategy {
+	case StrategyIgnore:
+		return false
+	case StrategyOriginalMessage:
+		return a.WithAttachments
+	default:
+		return true
+	}
 }
 
 // selectorNameRegex is compiled once and reused for every selector name validation.
@@ -90,9 +410,7 @@ func setDefaults(cfg *Config) {
 	if strings.TrimSpace(cfg.LogLevel) == "" {
 		cfg.LogLevel = "info"
 	}
-	if !cfg.MailClient.Gmail.Enabled {
-		cfg.MailClient.Gmail.Enabled = true
-	}
+	setMailClientDefaults(&cfg.MailClient)
 	if strings.TrimSpace(cfg.Processing.ProcessedAction) == "" {
 		cfg.Processing.ProcessedAction = "markRead"
 	}
@@ -102,6 +420,57 @@ func setDefaults(cfg *Config) {
 	if strings.TrimSpace(string(cfg.Attachments.Strategy)) == "" {
 		cfg.Attachments.Strategy = StrategyMultipartBundle
 	}
+	if strings.TrimSpace(string(cfg.Attachments.Inline)) == "" {
+		cfg.Attachments.Inline = InlineInclude
+	}
+	setArchiveExpansionDefaults(&cfg.Attachments.Archives)
+	setSMTPInboundDefaults(&cfg.Inbound.SMTP)
+	setHTTPInboundDefaults(&cfg.Inbound.HTTP)
+}
+
+func setHTTPInboundDefaults(c *HTTPInbound) {
+	if !c.Enabled {
+		return
+	}
+	if strings.TrimSpace(c.ListenAddress) == "" {
+		c.ListenAddress = ":8080"
+	}
+	if strings.TrimSpace(c.MaxMessageSize) == "" {
+		c.MaxMessageSize = "25MB"
+	}
+}
+
+func setArchiveExpansionDefaults(c *ArchiveExpansion) {
+	if !c.Enabled {
+		return
+	}
+	if strings.TrimSpace(c.Include) == "" {
+		c.Include = "*"
+	}
+	if c.MaxDepth == 0 {
+		c.MaxDepth = 2
+	}
+	if c.MaxEntries == 0 {
+		c.MaxEntries = 100
+	}
+	if strings.TrimSpace(c.MaxTotalSize) == "" {
+		c.MaxTotalSize = "100Mi"
+	}
+}
+
+func setSMTPInboundDefaults(c *SMTPInbound) {
+	if !c.Enabled {
+		return
+	}
+	if strings.TrimSpace(c.ListenAddress) == "" {
+		c.ListenAddress = ":2525"
+	}
+	if strings.TrimSpace(c.Domain) == "" {
+		c.Domain = "localhost"
+	}
+	if strings.TrimSpace(c.MaxMessageSize) == "" {
+		c.MaxMessageSize = "25MB"
+	}
 }
 
 func validateConfig(cfg *Config) error {
@@ -113,8 +482,8 @@ func validateConfig(cfg *Config) error {
 			return err
 		}
 	}
-	if !cfg.MailClient.Gmail.Enabled {
-		return fmt.Errorf("no mail client enabled; set mailClient.gmail.enabled: true")
+	if err := validateMailClient(&cfg.MailClient); err != nil {
+		return err
 	}
 	if strings.TrimSpace(cfg.Callback.URL) == "" {
 		return fmt.Errorf("callback.url is required")
@@ -122,7 +491,123 @@ func validateConfig(cfg *Config) error {
 	if err := validateProcessedAction(cfg); err != nil {
 		return err
 	}
-	return validateAttachments(&cfg.Attachments)
+	if err := validateAttachments(&cfg.Attachments); err != nil {
+		return err
+	}
+	if err := validateMessageScope(&cfg.MessageScope); err != nil {
+		return err
+	}
+	if err := validateSenderAuthentication(&cfg.SenderAuthentication, cfg.MailSelectors); err != nil {
+		return err
+	}
+	if err := validateSMTPInbound(&cfg.Inbound.SMTP); err != nil {
+		return err
+	}
+	return validateHTTPInbound(&cfg.Inbound.HTTP)
+}
+
+func validateHTTPInbound(c *HTTPInbound) error {
+	if !c.Enabled {
+		return nil
+	}
+	paths := []struct {
+		key  string
+		path *string
+	}{{"rawPath", &c.RawPath}, {"mailgunPath", &c.MailgunPath}, {"sendgridPath", &c.SendGridPath}}
+	seen := map[string]bool{}
+	for _, p := range paths {
+		*p.path = strings.TrimSpace(*p.path)
+		if *p.path == "" {
+			continue
+		}
+		if !strings.HasPrefix(*p.path, "/") {
+			return fmt.Errorf("inbound.http.%s %q must start with /", p.key, *p.path)
+		}
+		if seen[*p.path] {
+			return fmt.Errorf("inbound.http.%s %q is used by more than one format", p.key, *p.path)
+		}
+		seen[*p.path] = true
+	}
+	if len(seen) == 0 {
+		return fmt.Errorf("inbound.http requires at least one of rawPath, mailgunPath, sendgridPath")
+	}
+	if c.RawPath != "" || c.SendGridPath != "" {
+		if strings.TrimSpace(c.Username) == "" {
+			return fmt.Errorf("inbound.http.username is required for rawPath and sendgridPath")
+		}
+		if c.Password == "" && strings.TrimSpace(c.PasswordFile) == "" {
+			return fmt.Errorf("inbound.http requires password or passwordFile for rawPath and sendgridPath")
+		}
+	}
+	if c.MailgunPath != "" && c.MailgunSigningKey == "" && strings.TrimSpace(c.MailgunSigningKeyFile) == "" {
+		return fmt.Errorf("inbound.http.mailgunPath requires mailgunSigningKey or mailgunSigningKeyFile")
+	}
+	n, err := parseMessageSize("inbound.http.maxMessageSize", c.MaxMessageSize)
+	if err != nil {
+		return err
+	}
+	c.MaxMessageSizeBytes = n
+	return nil
+}
+
+// parseMessageSize parses a required, positive size limit such as the message size of an inbound listener.
+func parseMessageSize(key, s string) (int64, error) {
+	n, err := parseSizeString(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s %q is invalid: %w", key, s, err)
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("%s must be > 0", key)
+	}
+	return n, nil
+}
+
+func validateArchiveExpansion(c *ArchiveExpansion) error {
+	if !c.Enabled {
+		return nil
+	}
+	if _, err := path.Match(c.Include, ""); err != nil {
+		return fmt.Errorf("attachments.archives.include %q is not a valid glob: %w", c.Include, err)
+	}
+	if c.MaxDepth < 1 {
+		return fmt.Errorf("attachments.archives.maxDepth must be >= 1")
+	}
+	if c.MaxEntries < 1 {
+		return fmt.Errorf("attachments.archives.maxEntries must be >= 1")
+	}
+	n, err := parseMessageSize("attachments.archives.maxTotalSize", c.MaxTotalSize)
+	if err != nil {
+		return err
+	}
+	c.MaxTotalSizeBytes = n
+	return nil
+}
+
+func validateSMTPInbound(c *SMTPInbound) error {
+	if !c.Enabled {
+		return nil
+	}
+	domains := make([]string, 0, len(c.AllowedRecipientDomains))
+	for _, d := range c.AllowedRecipientDomains {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	if len(domains) == 0 {
+		return fmt.Errorf("inbound.smtp.allowedRecipientDomains requires at least one domain")
+	}
+	c.AllowedRecipientDomains = domains
+
+	n, err := parseMessageSize("inbound.smtp.maxMessageSize", c.MaxMessageSize)
+	if err != nil {
+		return err
+	}
+	c.MaxMessageSizeBytes = n
+
+	if (strings.TrimSpace(c.TLSCertFile) == "") != (strings.TrimSpace(c.TLSKeyFile) == "") {
+		return fmt.Errorf("inbound.smtp.tlsCertFile and inbound.smtp.tlsKeyFile must be set together")
+	}
+	return nil
 }
 
 func validateLogLevel(cfg *Config) error {
@@ -136,6 +621,380 @@ func validateLogLevel(cfg *Config) error {
 	}
 }
 
+// PushEnabled reports whether Gmail push is enabled for any account.
+func (mc MailClient) PushEnabled() bool {
+	for _, acc := range mc.AllAccounts() {
+		if acc.Gmail.Enabled && acc.Gmail.Push.Enabled {
+			return true
+		}
+	}
+	return false
+}
+
+// AllAccounts returns the configured accounts, or the top-level client as a single account named "default".
+func (mc MailClient) AllAccounts() []MailAccount {
+	if len(mc.Accounts) > 0 {
+		return mc.Accounts
+	}
+	return []MailAccount{{Name: "default", MailClient: mc}}
+}
+
+// setMailClientDefaults enables Gmail when no other client or account is configured and fills per-client defaults.
+// Accounts must enable their client explicitly.
+func setMailClientDefaults(mc *MailClient) {
+	if len(mc.Accounts) == 0 && !mc.IMAP.Enabled && !mc.POP3.Enabled && !mc.Filesystem.Enabled && !mc.Graph.Enabled && !mc.JMAP.Enabled {
+		mc.Gmail.Enabled = true
+	}
+	setClientDefaults(mc)
+	for i := range mc.Accounts {
+		setClientDefaults(&mc.Accounts[i].MailClient)
+	}
+}
+
+// setClientDefaults fills the defaults of the enabled client.
+func setClientDefaults(mc *MailClient) {
+	setGmailDefaults(&mc.Gmail)
+	setIMAPDefaults(&mc.IMAP)
+	setPOP3Defaults(&mc.POP3)
+	if mc.Filesystem.Enabled && strings.TrimSpace(mc.Filesystem.Format) == "" {
+		mc.Filesystem.Format = "maildir"
+	}
+	setGraphDefaults(&mc.Graph)
+	setJMAPDefaults(&mc.JMAP)
+}
+
+func setGmailDefaults(c *GmailClient) {
+	if !c.Enabled {
+		return
+	}
+	if strings.TrimSpace(c.CredentialsPath) == "" {
+		c.CredentialsPath = "/secrets/mail"
+	}
+	if strings.TrimSpace(c.Query) == "" {
+		c.Query = "is:unread"
+	}
+	if c.ServiceAccount.Enabled && strings.TrimSpace(c.ServiceAccount.KeyFile) == "" {
+		c.ServiceAccount.KeyFile = strings.TrimRight(c.CredentialsPath, "/") + "/service_account.json"
+	}
+	if c.MaxMessages == 0 {
+		c.MaxMessages = 500
+	}
+	if c.Concurrency == 0 {
+		c.Concurrency = 8
+	}
+	if c.QuotaUnitsPerSecond == 0 {
+		c.QuotaUnitsPerSecond = 250
+	}
+	if c.History.Enabled && len(c.History.LabelIDs) == 0 {
+		c.History.LabelIDs = []string{"INBOX"}
+	}
+	if c.Push.Enabled {
+		if len(c.Push.LabelIDs) == 0 {
+			c.Push.LabelIDs = []string{"INBOX"}
+		}
+		if strings.TrimSpace(c.Push.ListenAddress) == "" {
+			c.Push.ListenAddress = ":8080"
+		}
+		if strings.TrimSpace(c.Push.Path) == "" {
+			c.Push.Path = "/gmail/push"
+		}
+		if strings.TrimSpace(c.Push.RenewInterval) == "" {
+			c.Push.RenewInterval = "24h"
+		}
+	}
+}
+
+func setJMAPDefaults(c *JMAPClient) {
+	if !c.Enabled {
+		return
+	}
+	if strings.TrimSpace(c.Mailbox) == "" {
+		c.Mailbox = "inbox"
+	}
+	if strings.TrimSpace(c.DeleteMode) == "" {
+		c.DeleteMode = "trash"
+	}
+}
+
+func setIMAPDefaults(c *IMAPClient) {
+	if !c.Enabled {
+		return
+	}
+	if strings.TrimSpace(c.Security) == "" {
+		c.Security = "tls"
+	}
+	if c.Port == 0 {
+		if strings.EqualFold(c.Security, "tls") {
+			c.Port = 993
+		} else {
+			c.Port = 143
+		}
+	}
+	if strings.TrimSpace(c.Folder) == "" {
+		c.Folder = "INBOX"
+	}
+}
+
+func setGraphDefaults(c *GraphClient) {
+	if !c.Enabled {
+		return
+	}
+	if strings.TrimSpace(c.Folder) == "" {
+		c.Folder = "inbox"
+	}
+	if strings.TrimSpace(c.BaseURL) == "" {
+		c.BaseURL = "https://graph.microsoft.com/v1.0"
+	}
+	if strings.TrimSpace(c.TokenURL) == "" && strings.TrimSpace(c.TenantID) != "" {
+		c.TokenURL = "https://login.microsoftonline.com/" + strings.TrimSpace(c.TenantID) + "/oauth2/v2.0/token"
+	}
+}
+
+func setPOP3Defaults(c *POP3Client) {
+	if !c.Enabled {
+		return
+	}
+	if strings.TrimSpace(c.Security) == "" {
+		c.Security = "tls"
+	}
+	if c.Port == 0 {
+		if strings.EqualFold(c.Security, "tls") {
+			c.Port = 995
+		} else {
+			c.Port = 110
+		}
+	}
+}
+
+// mailClientKeys lists the configurable mail clients for error messages.
+const mailClientKeys = "mailClient.gmail, mailClient.imap, mailClient.pop3, mailClient.filesystem, mailClient.graph, mailClient.jmap"
+
+// accountNameRegex restricts account names to characters that are safe in logs and file names.
+var accountNameRegex = regexp.MustCompile(`^[0-9A-Za-z_-]+$`)
+
+func validateMailClient(mc *MailClient) error {
+	enabled := 0
+	for _, on := range []bool{mc.Gmail.Enabled, mc.IMAP.Enabled, mc.POP3.Enabled, mc.Filesystem.Enabled, mc.Graph.Enabled, mc.JMAP.Enabled} {
+		if on {
+			enabled++
+		}
+	}
+	if len(mc.Accounts) > 0 {
+		if enabled > 0 {
+			return fmt.Errorf("mailClient.accounts cannot be combined with a top-level client; move it into an account")
+		}
+		return validateMailAccounts(mc.Accounts)
+	}
+	if enabled == 0 {
+		return fmt.Errorf("no mail client enabled; set one of %s to enabled: true", mailClientKeys)
+	}
+	if enabled > 1 {
+		return fmt.Errorf("more than one mail client enabled; enable exactly one of %s", mailClientKeys)
+	}
+	switch {
+	case mc.Gmail.Enabled:
+		return validateGmailClient(&mc.Gmail)
+	case mc.IMAP.Enabled:
+		c := &mc.IMAP
+		return validateServerLogin("mailClient.imap", c.Host, c.Port, &c.Security, c.Username, c.Password, c.PasswordFile)
+	case mc.POP3.Enabled:
+		return validatePOP3Client(&mc.POP3)
+	case mc.Filesystem.Enabled:
+		return validateFilesystemClient(&mc.Filesystem)
+	case mc.Graph.Enabled:
+		return validateGraphClient(&mc.Graph)
+	case mc.JMAP.Enabled:
+		return validateJMAPClient(&mc.JMAP)
+	}
+	return nil
+}
+
+var gmailNewerThanRegex = regexp.MustCompile(`^[0-9]+[dmy]$`)
+
+func validateGmailClient(c *GmailClient) error {
+	for i, l := range c.Labels {
+		c.Labels[i] = strings.TrimSpace(l)
+		if c.Labels[i] == "" {
+			return fmt.Errorf("mailClient.gmail.labels must not contain empty entries")
+		}
+	}
+	c.NewerThan = strings.TrimSpace(c.NewerThan)
+	if c.NewerThan != "" && !gmailNewerThanRegex.MatchString(c.NewerThan) {
+		return fmt.Errorf("mailClient.gmail.newerThan %q is invalid (expected a number followed by d, m or y)", c.NewerThan)
+	}
+	c.In = strings.TrimSpace(c.In)
+	if strings.ContainsAny(c.In, " \t\"") {
+		return fmt.Errorf("mailClient.gmail.in %q must be a single location such as inbox or anywhere", c.In)
+	}
+	if c.MaxMessages < 0 {
+		return fmt.Errorf("mailClient.gmail.maxMessages must not be negative")
+	}
+	if c.Concurrency < 0 || c.QuotaUnitsPerSecond < 0 {
+		return fmt.Errorf("mailClient.gmail.concurrency and quotaUnitsPerSecond must be positive")
+	}
+	switch c.TokenStore.Type {
+	case "", "file", "env":
+	case "kubernetesSecret":
+		if strings.TrimSpace(c.TokenStore.SecretName) == "" {
+			return fmt.Errorf("mailClient.gmail.tokenStore.secretName is required for type kubernetesSecret")
+		}
+	default:
+		return fmt.Errorf("invalid mailClient.gmail.tokenStore.type %q (supported: file, env, kubernetesSecret)", c.TokenStore.Type)
+	}
+	if c.ServiceAccount.Enabled && !strings.Contains(c.ServiceAccount.Subject, "@") {
+		return fmt.Errorf("mailClient.gmail.serviceAccount.subject must be the email address of the mailbox to impersonate")
+	}
+	if c.History.Enabled && strings.TrimSpace(c.History.CheckpointPath) == "" {
+		return fmt.Errorf("mailClient.gmail.history.checkpointPath is required")
+	}
+	if c.History.Enabled && c.Push.Enabled {
+		// Notifications do not advance the checkpoint, so a restart would process their mails again.
+		return fmt.Errorf("mailClient.gmail.history cannot be combined with push, which processes unread mails and catches up on them at startup")
+	}
+	return validateGmailPush(&c.Push)
+}
+
+// maxGmailWatchLifetime is the lifetime of a Gmail watch; it must be renewed before.
+const maxGmailWatchLifetime = 7 * 24 * time.Hour
+
+func validateGmailPush(c *GmailPush) error {
+	if !c.Enabled {
+		return nil
+	}
+	if strings.TrimSpace(c.Topic) == "" {
+		return fmt.Errorf("mailClient.gmail.push.topic is required")
+	}
+	if strings.TrimSpace(c.Audience) == "" {
+		return fmt.Errorf("mailClient.gmail.push.audience is required to verify the Pub/Sub OIDC token")
+	}
+	if strings.TrimSpace(c.ServiceAccountEmail) == "" {
+		return fmt.Errorf("mailClient.gmail.push.serviceAccountEmail is required to verify the Pub/Sub OIDC token")
+	}
+	if !strings.HasPrefix(c.Path, "/") {
+		return fmt.Errorf("mailClient.gmail.push.path %q must start with /", c.Path)
+	}
+	d, err := time.ParseDuration(c.RenewInterval)
+	if err != nil {
+		return fmt.Errorf("mailClient.gmail.push.renewInterval %q is invalid: %w", c.RenewInterval, err)
+	}
+	if d <= 0 || d >= maxGmailWatchLifetime {
+		return fmt.Errorf("mailClient.gmail.push.renewInterval must be > 0 and < %s", maxGmailWatchLifetime)
+	}
+	c.RenewIntervalDuration = d
+	return nil
+}
+
+func validateMailAccounts(accounts []MailAccount) error {
+	seen := make(map[string]bool, len(accounts))
+	for i := range accounts {
+		acc := &accounts[i]
+		if !accountNameRegex.MatchString(acc.Name) {
+			return fmt.Errorf("mailClient.accounts[%d].name %q is invalid (allowed: letters, digits, '-', '_')", i, acc.Name)
+		}
+		if seen[acc.Name] {
+			return fmt.Errorf("mailClient.accounts name %q is not unique", acc.Name)
+		}
+		seen[acc.Name] = true
+		if len(acc.Accounts) > 0 {
+			return fmt.Errorf("mailClient.accounts[%s] cannot contain nested accounts", acc.Name)
+		}
+		if err := validateMailClient(&acc.MailClient); err != nil {
+			return fmt.Errorf("mailClient.accounts[%s]: %w", acc.Name, err)
+		}
+	}
+	return nil
+}
+
+func validateJMAPClient(c *JMAPClient) error {
+	if strings.TrimSpace(c.SessionURL) == "" {
+		return fmt.Errorf("mailClient.jmap.sessionUrl is required")
+	}
+	if c.Token == "" && strings.TrimSpace(c.TokenFile) == "" {
+		return fmt.Errorf("mailClient.jmap requires token or tokenFile")
+	}
+	switch strings.ToLower(strings.TrimSpace(c.DeleteMode)) {
+	case "trash":
+		c.DeleteMode = "trash"
+	case "destroy":
+		c.DeleteMode = "destroy"
+	default:
+		return fmt.Errorf("mailClient.jmap.deleteMode %q is invalid (supported: trash, destroy)", c.DeleteMode)
+	}
+	return nil
+}
+
+func validateGraphClient(c *GraphClient) error {
+	if strings.TrimSpace(c.TenantID) == "" && strings.TrimSpace(c.TokenURL) == "" {
+		return fmt.Errorf("mailClient.graph.tenantId is required")
+	}
+	if strings.TrimSpace(c.ClientID) == "" {
+		return fmt.Errorf("mailClient.graph.clientId is required")
+	}
+	if c.ClientSecret == "" && strings.TrimSpace(c.ClientSecretFile) == "" {
+		return fmt.Errorf("mailClient.graph requires clientSecret or clientSecretFile")
+	}
+	if strings.TrimSpace(c.User) == "" {
+		return fmt.Errorf("mailClient.graph.user is required (client credentials cannot use /me)")
+	}
+	return nil
+}
+
+func validateFilesystemClient(c *FilesystemClient) error {
+	switch strings.ToLower(strings.TrimSpace(c.Format)) {
+	case "maildir":
+		c.Format = "maildir"
+	case "mbox":
+		c.Format = "mbox"
+	default:
+		return fmt.Errorf("mailClient.filesystem.format %q is invalid (supported: maildir, mbox)", c.Format)
+	}
+	if strings.TrimSpace(c.Path) == "" {
+		return fmt.Errorf("mailClient.filesystem.path is required")
+	}
+	if c.Format == "mbox" && strings.TrimSpace(c.LedgerPath) == "" {
+		return fmt.Errorf("mailClient.filesystem.ledgerPath is required for the mbox format to track processed messages")
+	}
+	return nil
+}
+
+func validatePOP3Client(c *POP3Client) error {
+	if err := validateServerLogin("mailClient.pop3", c.Host, c.Port, &c.Security, c.Username, c.Password, c.PasswordFile); err != nil {
+		return err
+	}
+	if strings.TrimSpace(c.LedgerPath) == "" {
+		return fmt.Errorf("mailClient.pop3.ledgerPath is required to track processed messages")
+	}
+	return nil
+}
+
+// validateServerLogin checks the connection and credential fields shared by server-based clients
+// and canonicalizes security in place.
+func validateServerLogin(prefix, host string, port int, security *string, username, password, passwordFile string) error {
+	if strings.TrimSpace(host) == "" {
+		return fmt.Errorf("%s.host is required", prefix)
+	}
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("%s.port must be between 1 and 65535 (got %d)", prefix, port)
+	}
+	switch strings.ToLower(strings.TrimSpace(*security)) {
+	case "tls":
+		*security = "tls"
+	case "starttls":
+		*security = "starttls"
+	case "none":
+		*security = "none"
+	default:
+		return fmt.Errorf("%s.security %q is invalid (supported: tls, starttls, none)", prefix, *security)
+	}
+	if strings.TrimSpace(username) == "" {
+		return fmt.Errorf("%s.username is required", prefix)
+	}
+	if password == "" && strings.TrimSpace(passwordFile) == "" {
+		return fmt.Errorf("%s requires password or passwordFile", prefix)
+	}
+	return nil
+}
+
 func validateProcessedAction(cfg *Config) error {
 	switch strings.ToLower(strings.TrimSpace(cfg.Processing.ProcessedAction)) {
 	case "markread":
@@ -148,14 +1007,75 @@ func validateProcessedAction(cfg *Config) error {
 	return nil
 }
 
+// validateSenderAuthentication lower-cases the trusted authserv-ids and sealer domains and requires
+// trusted authserv-ids whenever the verdict gates mails.
+func validateSenderAuthentication(c *SenderAuthentication, selectors []MailSelectorConfig) error {
+	for _, list := range []struct {
+		key   string
+		names *[]string
+	}{
+		{"senderAuthentication.trustedAuthServIds", &c.TrustedAuthServIDs},
+		{"senderAuthentication.trustedArcSealers", &c.TrustedARCSealers},
+	} {
+		for i, n := range *list.names {
+			n = strings.ToLower(strings.TrimSpace(n))
+			if n == "" || strings.ContainsAny(n, " \t;") {
+				return fmt.Errorf("%s contains an invalid entry %q", list.key, (*list.names)[i])
+			}
+			(*list.names)[i] = n
+		}
+	}
+	if len(c.TrustedAuthServIDs) > 0 {
+		return nil
+	}
+	if c.Required {
+		return fmt.Errorf("senderAuthentication.trustedAuthServIds is required when senderAuthentication.required is set")
+	}
+	for _, sel := range selectors {
+		if sel.Type == "authenticatedSenderRegex" {
+			return fmt.Errorf("senderAuthentication.trustedAuthServIds is required for authenticatedSenderRegex (selector %q)", sel.Name)
+		}
+	}
+	return nil
+}
+
+// validateMessageScope canonicalizes scope; empty means outer.
+func validateMessageScope(scope *MessageScope) error {
+	switch strings.ToLower(strings.TrimSpace(string(*scope))) {
+	case "":
+		// outer
+	case "outer":
+		*scope = MessageScopeOuter
+	case "innermost":
+		*scope = MessageScopeInnermost
+	default:
+		return fmt.Errorf("messageScope %q is invalid (supported: outer, innermost)", *scope)
+	}
+	return nil
+}
+
 func validateMailSelectorConfig(sel *MailSelectorConfig) error {
 	if !selectorNameRegex.MatchString(sel.Name) {
 		return fmt.Errorf("mailSelectors.name must match ^[0-9A-Za-z]+$: %q", sel.Name)
 	}
 	switch sel.Type {
-	case "subjectRegex", "bodyRegex", "attachmentNameRegex", "senderRegex", "recipientRegex":
+	case "subjectRegex", "bodyRegex", "attachmentNameRegex", "senderRegex", "authenticatedSenderRegex", "recipientRegex", "headerRegex":
 	default:
-		return fmt.Errorf("mailSelectors.type %q not supported (supported: subjectRegex, bodyRegex, attachmentNameRegex, senderRegex, recipientRegex)", sel.Type)
+		return fmt.Errorf("mailSelectors.type %q not supported (supported: subjectRegex, bodyRegex, attachmentNameRegex, senderRegex, authenticatedSenderRegex, recipientRegex, headerRegex)", sel.Type)
+	}
+	sel.Header = strings.TrimSpace(sel.Header)
+	switch {
+	case sel.Type == "headerRegex" && sel.Header == "":
+		return fmt.Errorf("mailSelectors.header is required for headerRegex (selector %q)", sel.Name)
+	case sel.Type != "headerRegex" && sel.Header != "":
+		return fmt.Errorf("mailSelectors.header is only supported for headerRegex (selector %q)", sel.Name)
+	}
+	switch {
+	case sel.Type == "bodyRegex" && (sel.Target == "" || sel.Target == "text" || sel.Target == "html"):
+	case sel.Type == "bodyRegex":
+		return fmt.Errorf("mailSelectors.target %q not supported for bodyRegex (supported: text, html)", sel.Target)
+	case sel.Target != "":
+		return fmt.Errorf("mailSelectors.target is only supported for bodyRegex (selector %q)", sel.Name)
 	}
 	re, err := regexp.Compile(sel.Pattern)
 	if err != nil {
@@ -178,8 +1098,24 @@ func validateAttachments(att *AttachmentsConfig) error {
 		att.Strategy = StrategyMultipartBundle
 	case "multipartperattachment":
 		att.Strategy = StrategyMultipartPerAttachment
+	case "originalmessage":
+		att.Strategy = StrategyOriginalMessage
 	default:
-		return fmt.Errorf("attachments.strategy %q is invalid (supported: ignore, multipartBundle, multipartPerAttachment)", att.Strategy)
+		return fmt.Errorf("attachments.strategy %q is invalid (supported: ignore, multipartBundle, multipartPerAttachment, originalMessage)", att.Strategy)
+	}
+	if att.WithAttachments && att.Strategy != StrategyOriginalMessage {
+		return fmt.Errorf("attachments.withAttachments is only supported with strategy originalMessage")
+	}
+	switch strings.ToLower(strings.TrimSpace(string(att.Inline))) {
+	case "include":
+		att.Inline = InlineInclude
+	case "exclude":
+		att.Inline = InlineExclude
+	default:
+		return fmt.Errorf("attachments.inline %q is invalid (supported: include, exclude)", att.Inline)
+	}
+	if err := validateArchiveExpansion(&att.Archives); err != nil {
+		return err
 	}
 
 	sizeStr := strings.TrimSpace(att.MaxSize)
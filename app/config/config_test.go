@@ -3,6 +3,7 @@ package config
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/jo-hoe/goback"
 )
@@ -42,7 +43,7 @@ processing:
 			want: &Config{
 				LogLevel: "info",
 				MailClient: MailClient{
-					Gmail: GmailClient{Enabled: true},
+					Gmail: GmailClient{Enabled: true, CredentialsPath: "/secrets/mail", Query: "is:unread", MaxMessages: 500, Concurrency: 8, QuotaUnitsPerSecond: 250},
 				},
 				MailSelectors: []MailSelectorConfig{
 					{Name: "subjectScope", Type: "subjectRegex", Pattern: ".*", CaptureGroup: 0},
@@ -59,6 +60,7 @@ processing:
 					FieldName:    "attachment",
 					MaxSize:      "",
 					MaxSizeBytes: 0,
+					Inline:       "include",
 				},
 				Processing: Processing{
 					ProcessedAction: "markRead",
@@ -89,7 +91,7 @@ callback:
 			want: &Config{
 				LogLevel: "info",
 				MailClient: MailClient{
-					Gmail: GmailClient{Enabled: true},
+					Gmail: GmailClient{Enabled: true, CredentialsPath: "/secrets/mail", Query: "is:unread", MaxMessages: 500, Concurrency: 8, QuotaUnitsPerSecond: 250},
 				},
 				MailSelectors: []MailSelectorConfig{
 					{Name: "subjectScope", Type: "subjectRegex", Pattern: ".*", CaptureGroup: 0},
@@ -102,6 +104,7 @@ callback:
 					FieldName:    "attachment",
 					MaxSize:      "",
 					MaxSizeBytes: 0,
+					Inline:       "include",
 				},
 				Processing: Processing{
 					ProcessedAction: "markRead",
@@ -109,6 +112,778 @@ callback:
 			},
 			wantErr: false,
 		},
+		{
+			name: "imap client replaces gmail default",
+			args: args{
+				yamlBytes: []byte(`
+mailClient:
+  imap:
+    enabled: true
+    host: "imap.example.com"
+    username: "user"
+    passwordFile: "/secrets/mail/imap-password"
+mailSelectors:
+- name: "subjectScope"
+  type: "subjectRegex"
+  pattern: ".*"
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want: &Config{
+				LogLevel: "info",
+				MailClient: MailClient{
+					IMAP: IMAPClient{
+						Enabled:      true,
+						Host:         "imap.example.com",
+						Port:         993,
+						Security:     "tls",
+						Username:     "user",
+						PasswordFile: "/secrets/mail/imap-password",
+						Folder:       "INBOX",
+					},
+				},
+				MailSelectors: []MailSelectorConfig{
+					{Name: "subjectScope", Type: "subjectRegex", Pattern: ".*", CaptureGroup: 0},
+				},
+				Callback: goback.Config{
+					URL: "https://example.com/callback",
+				},
+				Attachments: AttachmentsConfig{
+					Strategy:  "multipartBundle",
+					FieldName: "attachment",
+					Inline:    "include",
+				},
+				Processing: Processing{
+					ProcessedAction: "markRead",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "smtp inbound defaults and canonical domains",
+			args: args{
+				yamlBytes: []byte(`
+inbound:
+  smtp:
+    enabled: true
+    allowedRecipientDomains: [" Example.COM "]
+mailSelectors:
+- name: "subjectScope"
+  type: "subjectRegex"
+  pattern: ".*"
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want: &Config{
+				LogLevel: "info",
+				MailClient: MailClient{
+					Gmail: GmailClient{Enabled: true, CredentialsPath: "/secrets/mail", Query: "is:unread", MaxMessages: 500, Concurrency: 8, QuotaUnitsPerSecond: 250},
+				},
+				MailSelectors: []MailSelectorConfig{
+					{Name: "subjectScope", Type: "subjectRegex", Pattern: ".*", CaptureGroup: 0},
+				},
+				Callback: goback.Config{
+					URL: "https://example.com/callback",
+				},
+				Attachments: AttachmentsConfig{
+					Strategy:  "multipartBundle",
+					FieldName: "attachment",
+					Inline:    "include",
+				},
+				Processing: Processing{
+					ProcessedAction: "markRead",
+				},
+				Inbound: Inbound{
+					SMTP: SMTPInbound{
+						Enabled:                 true,
+						ListenAddress:           ":2525",
+						Domain:                  "localhost",
+						AllowedRecipientDomains: []string{"example.com"},
+						MaxMessageSize:          "25MB",
+						MaxMessageSizeBytes:     25_000_000,
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "gmail push defaults",
+			args: args{
+				yamlBytes: []byte(`
+mailClient:
+  gmail:
+    enabled: true
+    push:
+      enabled: true
+      topic: "projects/p/topics/gmail"
+      audience: "https://hooks.example.com/gmail/push"
+      serviceAccountEmail: "gmail-push@p.iam.gserviceaccount.com"
+mailSelectors:
+- name: "subjectScope"
+  type: "subjectRegex"
+  pattern: ".*"
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want: &Config{
+				LogLevel: "info",
+				MailClient: MailClient{
+					Gmail: GmailClient{Enabled: true, CredentialsPath: "/secrets/mail", Query: "is:unread", MaxMessages: 500, Concurrency: 8, QuotaUnitsPerSecond: 250, Push: GmailPush{
+						Enabled:               true,
+						Topic:                 "projects/p/topics/gmail",
+						LabelIDs:              []string{"INBOX"},
+						ListenAddress:         ":8080",
+						Path:                  "/gmail/push",
+						Audience:              "https://hooks.example.com/gmail/push",
+						ServiceAccountEmail:   "gmail-push@p.iam.gserviceaccount.com",
+						RenewInterval:         "24h",
+						RenewIntervalDuration: 24 * time.Hour,
+					}},
+				},
+				MailSelectors: []MailSelectorConfig{
+					{Name: "subjectScope", Type: "subjectRegex", Pattern: ".*", CaptureGroup: 0},
+				},
+				Callback: goback.Config{
+					URL: "https://example.com/callback",
+				},
+				Attachments: AttachmentsConfig{
+					Strategy:  "multipartBundle",
+					FieldName: "attachment",
+					Inline:    "include",
+				},
+				Processing: Processing{
+					ProcessedAction: "markRead",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "negative test gmail service account without subject",
+			args: args{
+				yamlBytes: []byte(`
+mailClient:
+  gmail:
+    enabled: true
+    serviceAccount:
+      enabled: true
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test unsupported bodyRegex target",
+			args: args{
+				yamlBytes: []byte(`
+mailSelectors:
+  - name: "Amount"
+    type: "bodyRegex"
+    pattern: "Total: ([0-9.]+)"
+    target: "markdown"
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test headerRegex without header",
+			args: args{
+				yamlBytes: []byte(`
+mailSelectors:
+  - name: "ThreadRef"
+    type: "headerRegex"
+    pattern: "<([^>]+)>"
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test target on a non-body selector",
+			args: args{
+				yamlBytes: []byte(`
+mailSelectors:
+  - name: "OrderId"
+    type: "subjectRegex"
+    pattern: "Order ([0-9]+)"
+    target: "html"
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test withAttachments without originalMessage",
+			args: args{
+				yamlBytes: []byte(`
+mailSelectors:
+  - name: "OrderId"
+    type: "subjectRegex"
+    pattern: "Order ([0-9]+)"
+callback:
+  url: "https://example.com/callback"
+attachments:
+  strategy: "multipartBundle"
+  withAttachments: true
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test invalid archive include glob",
+			args: args{
+				yamlBytes: []byte(`
+mailSelectors:
+  - name: "OrderId"
+    type: "subjectRegex"
+    pattern: "Order ([0-9]+)"
+callback:
+  url: "https://example.com/callback"
+attachments:
+  archives:
+    enabled: true
+    include: "[*.pdf"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test archive maxDepth below one",
+			args: args{
+				yamlBytes: []byte(`
+mailSelectors:
+  - name: "OrderId"
+    type: "subjectRegex"
+    pattern: "Order ([0-9]+)"
+callback:
+  url: "https://example.com/callback"
+attachments:
+  archives:
+    enabled: true
+    maxDepth: -1
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test empty trusted authserv-id",
+			args: args{
+				yamlBytes: []byte(`
+mailSelectors:
+  - name: "Vendor"
+    type: "authenticatedSenderRegex"
+    pattern: "@ourvendor\\.com$"
+callback:
+  url: "https://example.com/callback"
+senderAuthentication:
+  required: true
+  trustedAuthServIds: ["mx.example.net", " "]
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test required sender authentication without trusted authserv-ids",
+			args: args{
+				yamlBytes: []byte(`
+mailSelectors:
+  - name: "OrderId"
+    type: "subjectRegex"
+    pattern: "Order ([0-9]+)"
+callback:
+  url: "https://example.com/callback"
+senderAuthentication:
+  required: true
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test authenticatedSenderRegex without trusted authserv-ids",
+			args: args{
+				yamlBytes: []byte(`
+mailSelectors:
+  - name: "Vendor"
+    type: "authenticatedSenderRegex"
+    pattern: "@ourvendor\\.com$"
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test unknown messageScope",
+			args: args{
+				yamlBytes: []byte(`
+mailSelectors:
+  - name: "OrderId"
+    type: "subjectRegex"
+    pattern: "Order ([0-9]+)"
+callback:
+  url: "https://example.com/callback"
+messageScope: "outermost"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test gmail kubernetes token store without secretName",
+			args: args{
+				yamlBytes: []byte(`
+mailClient:
+  gmail:
+    enabled: true
+    tokenStore:
+      type: kubernetesSecret
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test gmail with unknown token store",
+			args: args{
+				yamlBytes: []byte(`
+mailClient:
+  gmail:
+    enabled: true
+    tokenStore:
+      type: vault
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test gmail with invalid newerThan",
+			args: args{
+				yamlBytes: []byte(`
+mailClient:
+  gmail:
+    enabled: true
+    newerThan: "7 days"
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test gmail history without checkpoint path",
+			args: args{
+				yamlBytes: []byte(`
+mailClient:
+  gmail:
+    enabled: true
+    history:
+      enabled: true
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test gmail push without audience",
+			args: args{
+				yamlBytes: []byte(`
+mailClient:
+  gmail:
+    enabled: true
+    push:
+      enabled: true
+      topic: "projects/p/topics/gmail"
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test gmail push without service account email",
+			args: args{
+				yamlBytes: []byte(`
+mailClient:
+  gmail:
+    enabled: true
+    push:
+      enabled: true
+      topic: "projects/p/topics/gmail"
+      audience: "https://hooks.example.com/gmail/push"
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test gmail push with history",
+			args: args{
+				yamlBytes: []byte(`
+mailClient:
+  gmail:
+    enabled: true
+    history:
+      enabled: true
+      checkpointPath: "/data/gmail-checkpoint.json"
+    push:
+      enabled: true
+      topic: "projects/p/topics/gmail"
+      audience: "https://hooks.example.com/gmail/push"
+      serviceAccountEmail: "gmail-push@p.iam.gserviceaccount.com"
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test gmail push renewal beyond watch lifetime",
+			args: args{
+				yamlBytes: []byte(`
+mailClient:
+  gmail:
+    enabled: true
+    push:
+      enabled: true
+      topic: "projects/p/topics/gmail"
+      audience: "https://hooks.example.com/gmail/push"
+      serviceAccountEmail: "gmail-push@p.iam.gserviceaccount.com"
+      renewInterval: "168h"
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test smtp inbound without allowed domains",
+			args: args{
+				yamlBytes: []byte(`
+inbound:
+  smtp:
+    enabled: true
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test http inbound without paths",
+			args: args{
+				yamlBytes: []byte(`
+inbound:
+  http:
+    enabled: true
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test http inbound with duplicate paths",
+			args: args{
+				yamlBytes: []byte(`
+inbound:
+  http:
+    enabled: true
+    rawPath: "/inbound"
+    sendgridPath: "/inbound"
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test http inbound raw path without credentials",
+			args: args{
+				yamlBytes: []byte(`
+inbound:
+  http:
+    enabled: true
+    rawPath: "/inbound/raw"
+    username: "inbound"
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test http inbound mailgun path without signing key",
+			args: args{
+				yamlBytes: []byte(`
+inbound:
+  http:
+    enabled: true
+    mailgunPath: "/inbound/mailgun"
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "named accounts get per-account defaults",
+			args: args{
+				yamlBytes: []byte(`
+mailClient:
+  accounts:
+    - name: "orders"
+      gmail:
+        enabled: true
+        credentialsPath: "/secrets/orders"
+        query: "is:unread label:orders"
+    - name: "billing"
+      gmail:
+        enabled: true
+    - name: "support"
+      filesystem:
+        enabled: true
+        path: "/var/mail/support"
+mailSelectors:
+- name: "subjectScope"
+  type: "subjectRegex"
+  pattern: ".*"
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want: &Config{
+				LogLevel: "info",
+				MailClient: MailClient{
+					Accounts: []MailAccount{
+						{Name: "orders", MailClient: MailClient{Gmail: GmailClient{Enabled: true, CredentialsPath: "/secrets/orders", Query: "is:unread label:orders", MaxMessages: 500, Concurrency: 8, QuotaUnitsPerSecond: 250}}},
+						{Name: "billing", MailClient: MailClient{Gmail: GmailClient{Enabled: true, CredentialsPath: "/secrets/mail", Query: "is:unread", MaxMessages: 500, Concurrency: 8, QuotaUnitsPerSecond: 250}}},
+						{Name: "support", MailClient: MailClient{Filesystem: FilesystemClient{Enabled: true, Format: "maildir", Path: "/var/mail/support"}}},
+					},
+				},
+				MailSelectors: []MailSelectorConfig{
+					{Name: "subjectScope", Type: "subjectRegex", Pattern: ".*", CaptureGroup: 0},
+				},
+				Callback: goback.Config{
+					URL: "https://example.com/callback",
+				},
+				Attachments: AttachmentsConfig{
+					Strategy:  "multipartBundle",
+					FieldName: "attachment",
+					Inline:    "include",
+				},
+				Processing: Processing{
+					ProcessedAction: "markRead",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "negative test duplicate account names",
+			args: args{
+				yamlBytes: []byte(`
+mailClient:
+  accounts:
+    - name: "orders"
+      gmail:
+        enabled: true
+    - name: "orders"
+      gmail:
+        enabled: true
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test accounts combined with top-level client",
+			args: args{
+				yamlBytes: []byte(`
+mailClient:
+  imap:
+    enabled: true
+    host: "imap.example.com"
+    username: "user"
+    password: "secret"
+  accounts:
+    - name: "orders"
+      gmail:
+        enabled: true
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test account without client",
+			args: args{
+				yamlBytes: []byte(`
+mailClient:
+  accounts:
+    - name: "orders"
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test gmail and imap both enabled",
+			args: args{
+				yamlBytes: []byte(`
+mailClient:
+  gmail:
+    enabled: true
+  imap:
+    enabled: true
+    host: "imap.example.com"
+    username: "user"
+    password: "secret"
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test pop3 without ledger",
+			args: args{
+				yamlBytes: []byte(`
+mailClient:
+  pop3:
+    enabled: true
+    host: "pop.example.com"
+    username: "user"
+    password: "secret"
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test filesystem with unknown format",
+			args: args{
+				yamlBytes: []byte(`
+mailClient:
+  filesystem:
+    enabled: true
+    format: "pst"
+    path: "/var/mail/orders"
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test mbox without ledger",
+			args: args{
+				yamlBytes: []byte(`
+mailClient:
+  filesystem:
+    enabled: true
+    format: "mbox"
+    path: "/var/mail/orders.mbox"
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test graph without user",
+			args: args{
+				yamlBytes: []byte(`
+mailClient:
+  graph:
+    enabled: true
+    tenantId: "contoso"
+    clientId: "app"
+    clientSecret: "secret"
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test jmap with unknown delete mode",
+			args: args{
+				yamlBytes: []byte(`
+mailClient:
+  jmap:
+    enabled: true
+    sessionUrl: "https://api.fastmail.com/jmap/session"
+    token: "secret"
+    deleteMode: "shred"
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative test imap without host",
+			args: args{
+				yamlBytes: []byte(`
+mailClient:
+  imap:
+    enabled: true
+    username: "user"
+    password: "secret"
+callback:
+  url: "https://example.com/callback"
+`),
+			},
+			want:    nil,
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,229 @@
+package inbound
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/idtoken"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
+	"github.com/jo-hoe/go-mail-webhook-service/app/mail"
+)
+
+// watchRenewMargin is how long before the watch expiration it is renewed at the latest.
+const watchRenewMargin = time.Hour
+
+// MailProcessor processes mails fetched from a mailbox, including the configured processed action.
+// It returns the number of mails that failed.
+type MailProcessor interface {
+	ProcessMails(ctx context.Context, account string, mailService mail.MailClientService, mails []mail.Mail) int
+}
+
+// gmailWatchSource is the part of the Gmail backend used by the push endpoint.
+type gmailWatchSource interface {
+	mail.MailClientService
+	Watch(ctx context.Context, topic string, labelIDs []string) (uint64, time.Time, error)
+	GetMailsAddedSince(ctx context.Context, startHistoryID uint64, requiredLabels []string) ([]mail.Mail, uint64, error)
+}
+
+// tokenValidator verifies a Google-signed OIDC token for the given audience.
+type tokenValidator func(ctx context.Context, token, audience string) (*idtoken.Payload, error)
+
+// pushEnvelope is the body of a Pub/Sub push delivery.
+type pushEnvelope struct {
+	Message struct {
+		Data      []byte `json:"data"`
+		MessageID string `json:"messageId"`
+	} `json:"message"`
+	Subscription string `json:"subscription"`
+}
+
+// gmailNotification is the Pub/Sub message data published by Gmail.
+type gmailNotification struct {
+	EmailAddress string `json:"emailAddress"`
+	HistoryID    uint64 `json:"historyId"`
+}
+
+// GmailPushEndpoint receives Gmail push notifications for one account. It keeps the mailbox
+// watch alive and processes the unread messages added since the last processed history ID.
+// The history ID is kept in memory only; Start catches up on the unread mails instead.
+type GmailPushEndpoint struct {
+	account   string
+	cfg       config.GmailPush
+	source    gmailWatchSource
+	processor MailProcessor
+	validate  tokenValidator
+
+	// mu serializes notifications so that the checkpoint only moves forward.
+	mu        sync.Mutex
+	historyID uint64
+	expires   time.Time
+}
+
+// NewGmailPushEndpoint creates the push endpoint for an account using the given Gmail source.
+func NewGmailPushEndpoint(account string, cfg config.GmailPush, source gmailWatchSource, processor MailProcessor) *GmailPushEndpoint {
+	return &GmailPushEndpoint{
+		account:   account,
+		cfg:       cfg,
+		source:    source,
+		processor: processor,
+		validate:  idtoken.Validate,
+	}
+}
+
+// Start registers the mailbox watch and then processes all unread mails, so that mails received
+// while the endpoint was not running are not missed. Mails arriving during this sweep are either
+// processed by it or, still unread, by the next notification.
+func (e *GmailPushEndpoint) Start(ctx context.Context) error {
+	if err := e.renewWatch(ctx); err != nil {
+		return err
+	}
+	return e.catchUp(ctx)
+}
+
+// catchUp processes the unread mails of the mailbox. Mails whose webhook call failed stay unread
+// and are retried by the sweep of the next start.
+func (e *GmailPushEndpoint) catchUp(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	mails, err := e.source.GetAllUnreadMail(ctx)
+	if err != nil {
+		return fmt.Errorf("could not fetch unread mails: %w", err)
+	}
+	slog.Info("processing unread mails received before the gmail watch", "account", e.account, "count", len(mails))
+	if failures := e.processor.ProcessMails(ctx, e.account, e.source, mails); failures > 0 {
+		slog.Error("some unread mails were not processed; they are retried on the next start", "account", e.account, "errors", failures)
+	}
+	return nil
+}
+
+// RenewLoop renews the watch every RenewInterval (or before it expires) until ctx is done.
+func (e *GmailPushEndpoint) RenewLoop(ctx context.Context) {
+	for {
+		timer := time.NewTimer(e.nextRenewal())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if err := e.renewWatch(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("could not renew gmail watch", "account", e.account, "error", err)
+		}
+	}
+}
+
+func (e *GmailPushEndpoint) nextRenewal() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	d := e.cfg.RenewIntervalDuration
+	if untilExpiry := time.Until(e.expires) - watchRenewMargin; untilExpiry < d {
+		d = untilExpiry
+	}
+	if d < time.Minute {
+		d = time.Minute
+	}
+	return d
+}
+
+func (e *GmailPushEndpoint) renewWatch(ctx context.Context) error {
+	historyID, expires, err := e.source.Watch(ctx, e.cfg.Topic, e.cfg.LabelIDs)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	// A renewal must not skip messages added since the last processed notification.
+	if e.historyID == 0 {
+		e.historyID = historyID
+	}
+	e.expires = expires
+	slog.Info("gmail watch registered", "account", e.account, "topic", e.cfg.Topic, "historyId", e.historyID, "expires", expires)
+	return nil
+}
+
+func (e *GmailPushEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if status, err := e.authorize(r); err != nil {
+		slog.Warn("rejected gmail push request", "account", e.account, "remote", r.RemoteAddr, "error", err)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	var envelope pushEnvelope
+	var notification gmailNotification
+	if err := json.NewDecoder(r.Body).Decode(&envelope); err != nil {
+		slog.Error("could not decode gmail push request", "account", e.account, "error", err)
+		http.Error(w, "invalid push message", http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal(envelope.Message.Data, &notification); err != nil {
+		slog.Error("could not decode gmail notification", "account", e.account, "messageId", envelope.Message.MessageID, "error", err)
+		http.Error(w, "invalid notification data", http.StatusBadRequest)
+		return
+	}
+
+	// Pub/Sub gives up on the delivery after its ack deadline; processing still has to finish.
+	ctx := context.WithoutCancel(r.Context())
+	if err := e.handleNotification(ctx, notification); err != nil {
+		slog.Error("gmail notification not fully processed; awaiting redelivery", "account", e.account,
+			"historyId", notification.HistoryID, "error", err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorize verifies the OIDC bearer token attached by the Pub/Sub push subscription.
+func (e *GmailPushEndpoint) authorize(r *http.Request) (int, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return http.StatusUnauthorized, errors.New("missing bearer token")
+	}
+	payload, err := e.validate(r.Context(), token, e.cfg.Audience)
+	if err != nil {
+		return http.StatusForbidden, err
+	}
+	email, _ := payload.Claims["email"].(string)
+	verified, _ := payload.Claims["email_verified"].(bool)
+	if !verified || !strings.EqualFold(email, e.cfg.ServiceAccountEmail) {
+		return http.StatusForbidden, errors.New("token was not issued for the configured service account")
+	}
+	return http.StatusOK, nil
+}
+
+// handleNotification processes the unread messages added since the checkpoint and advances it
+// only when all of them succeeded; mails handled before a failure are no longer unread on retry.
+func (e *GmailPushEndpoint) handleNotification(ctx context.Context, n gmailNotification) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if n.HistoryID != 0 && n.HistoryID <= e.historyID {
+		slog.Debug("gmail notification already processed", "account", e.account, "historyId", n.HistoryID)
+		return nil
+	}
+
+	mails, latest, err := e.source.GetMailsAddedSince(ctx, e.historyID, []string{"UNREAD"})
+	if errors.Is(err, mail.ErrHistoryExpired) {
+		slog.Warn("gmail history checkpoint expired; processing all unread mails", "account", e.account,
+			"historyId", e.historyID)
+		mails, err = e.source.GetAllUnreadMail(ctx)
+		latest = n.HistoryID
+	}
+	if err != nil {
+		return err
+	}
+
+	if failures := e.processor.ProcessMails(ctx, e.account, e.source, mails); failures > 0 {
+		return errors.New("webhook delivery failed for some mails")
+	}
+	if latest > e.historyID {
+		e.historyID = latest
+	}
+	return nil
+}
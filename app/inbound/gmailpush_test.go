@@ -0,0 +1,200 @@
+package inbound
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/api/idtoken"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
+	"github.com/jo-hoe/go-mail-webhook-service/app/mail"
+)
+
+// watchSourceStub serves a fixed history and records the checkpoints it was asked for.
+type watchSourceStub struct {
+	mail.MailClientService
+	historyErr  error
+	added       []mail.Mail
+	latest      uint64
+	unread      []mail.Mail
+	unreadErr   error
+	startedFrom []uint64
+}
+
+func (s *watchSourceStub) Watch(context.Context, string, []string) (uint64, time.Time, error) {
+	return 100, time.Now().Add(7 * 24 * time.Hour), nil
+}
+
+func (s *watchSourceStub) GetMailsAddedSince(_ context.Context, start uint64, _ []string) ([]mail.Mail, uint64, error) {
+	s.startedFrom = append(s.startedFrom, start)
+	return s.added, s.latest, s.historyErr
+}
+
+func (s *watchSourceStub) GetAllUnreadMail(context.Context) ([]mail.Mail, error) {
+	return s.unread, s.unreadErr
+}
+
+// processorStub records processed mails and reports the configured number of failures.
+type processorStub struct {
+	mails    []mail.Mail
+	failures int
+}
+
+func (p *processorStub) ProcessMails(_ context.Context, _ string, _ mail.MailClientService, mails []mail.Mail) int {
+	p.mails = append(p.mails, mails...)
+	return p.failures
+}
+
+// newTestPushEndpoint creates and starts an endpoint; the mails processed by the startup sweep are
+// not recorded in processor.
+func newTestPushEndpoint(t *testing.T, source *watchSourceStub, processor *processorStub) *GmailPushEndpoint {
+	t.Helper()
+	ep := newUnstartedPushEndpoint(source, processor)
+	if err := ep.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	processor.mails = nil
+	return ep
+}
+
+func newUnstartedPushEndpoint(source *watchSourceStub, processor *processorStub) *GmailPushEndpoint {
+	ep := NewGmailPushEndpoint("default", config.GmailPush{
+		Enabled:               true,
+		Topic:                 "projects/p/topics/gmail",
+		Audience:              "https://hooks.example.com/gmail/push",
+		ServiceAccountEmail:   "push@p.iam.gserviceaccount.com",
+		RenewIntervalDuration: time.Hour,
+	}, source, processor)
+	ep.validate = func(_ context.Context, token, audience string) (*idtoken.Payload, error) {
+		if token != "valid" || audience != "https://hooks.example.com/gmail/push" {
+			return nil, errors.New("invalid token")
+		}
+		return &idtoken.Payload{Claims: map[string]any{"email": "push@p.iam.gserviceaccount.com", "email_verified": true}}, nil
+	}
+	return ep
+}
+
+func pushRequest(token string, historyID string) *http.Request {
+	data := base64.StdEncoding.EncodeToString([]byte(`{"emailAddress":"me@example.com","historyId":` + historyID + `}`))
+	req := httptest.NewRequest(http.MethodPost, "/gmail/push", bytes.NewBufferString(`{"message":{"data":"`+data+`","messageId":"1"}}`))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+func TestGmailPushEndpoint_authorization(t *testing.T) {
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{name: "missing token", wantStatus: http.StatusUnauthorized},
+		{name: "invalid token", token: "forged", wantStatus: http.StatusForbidden},
+		{name: "valid token", token: "valid", wantStatus: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := newTestPushEndpoint(t, &watchSourceStub{latest: 105}, &processorStub{})
+
+			rec := httptest.NewRecorder()
+			ep.ServeHTTP(rec, pushRequest(tt.token, "105"))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestGmailPushEndpoint_checkpoint(t *testing.T) {
+	tests := []struct {
+		name           string
+		source         *watchSourceStub
+		failures       int
+		wantStatus     int
+		wantIDs        []string
+		wantCheckpoint uint64
+	}{
+		{
+			name:           "processes added mails and advances",
+			source:         &watchSourceStub{added: []mail.Mail{{Id: "m1"}}, latest: 105},
+			wantStatus:     http.StatusNoContent,
+			wantIDs:        []string{"m1"},
+			wantCheckpoint: 105,
+		},
+		{
+			name:           "failure keeps the checkpoint for redelivery",
+			source:         &watchSourceStub{added: []mail.Mail{{Id: "m1"}}, latest: 105},
+			failures:       1,
+			wantStatus:     http.StatusServiceUnavailable,
+			wantIDs:        []string{"m1"},
+			wantCheckpoint: 100,
+		},
+		{
+			name:           "expired history falls back to all unread mails",
+			source:         &watchSourceStub{historyErr: mail.ErrHistoryExpired, unread: []mail.Mail{{Id: "u1"}}},
+			wantStatus:     http.StatusNoContent,
+			wantIDs:        []string{"u1"},
+			wantCheckpoint: 105,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processor := &processorStub{failures: tt.failures}
+			ep := newTestPushEndpoint(t, tt.source, processor)
+
+			rec := httptest.NewRecorder()
+			ep.ServeHTTP(rec, pushRequest("valid", "105"))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if len(tt.source.startedFrom) != 1 || tt.source.startedFrom[0] != 100 {
+				t.Errorf("history requested from %v, want [100] from the watch", tt.source.startedFrom)
+			}
+			if len(processor.mails) != len(tt.wantIDs) || processor.mails[0].Id != tt.wantIDs[0] {
+				t.Errorf("processed %+v, want %v", processor.mails, tt.wantIDs)
+			}
+			if ep.historyID != tt.wantCheckpoint {
+				t.Errorf("checkpoint = %d, want %d", ep.historyID, tt.wantCheckpoint)
+			}
+		})
+	}
+}
+
+func TestGmailPushEndpoint_ignoresOldNotifications(t *testing.T) {
+	source := &watchSourceStub{latest: 105}
+	ep := newTestPushEndpoint(t, source, &processorStub{})
+
+	rec := httptest.NewRecorder()
+	ep.ServeHTTP(rec, pushRequest("valid", "90"))
+	if rec.Code != http.StatusNoContent || len(source.startedFrom) != 0 {
+		t.Errorf("status = %d, history calls = %v; want 204 without fetching", rec.Code, source.startedFrom)
+	}
+}
+
+func TestGmailPushEndpoint_startProcessesUnreadMails(t *testing.T) {
+	source := &watchSourceStub{unread: []mail.Mail{{Id: "u1"}, {Id: "u2"}}}
+	processor := &processorStub{failures: 1}
+	ep := newUnstartedPushEndpoint(source, processor)
+
+	if err := ep.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v, want failed webhook calls to be left for the next start", err)
+	}
+	if len(processor.mails) != 2 || processor.mails[0].Id != "u1" || processor.mails[1].Id != "u2" {
+		t.Errorf("processed %+v, want the unread mails u1 and u2", processor.mails)
+	}
+	if ep.historyID != 100 {
+		t.Errorf("checkpoint = %d, want 100 from the watch", ep.historyID)
+	}
+
+	source.unreadErr = errors.New("quota exceeded")
+	if err := newUnstartedPushEndpoint(source, &processorStub{}).Start(context.Background()); err == nil {
+		t.Error("Start() error = nil, want the fetch error")
+	}
+}
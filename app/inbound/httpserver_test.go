@@ -0,0 +1,314 @@
+package inbound
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
+)
+
+const (
+	testInboundUser       = "inbound"
+	testInboundPassword   = "s3cret"
+	testMailgunSigningKey = "key-0123456789"
+)
+
+func newTestHTTPServer(t *testing.T, handler MailHandler) *httptest.Server {
+	t.Helper()
+	srv, err := NewHTTPServer(config.HTTPInbound{
+		Enabled:             true,
+		RawPath:             "/inbound/raw",
+		MailgunPath:         "/inbound/mailgun",
+		SendGridPath:        "/inbound/sendgrid",
+		MaxMessageSizeBytes: 4096,
+		Username:            testInboundUser,
+		Password:            testInboundPassword,
+		MailgunSigningKey:   testMailgunSigningKey,
+	}, handler)
+	if err != nil {
+		t.Fatalf("NewHTTPServer() error = %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// signMailgun adds the timestamp, token and signature fields Mailgun signs with key at signedAt.
+func signMailgun(fields map[string]string, key string, signedAt time.Time) map[string]string {
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	token := "f3a9c1d2e4b5a6978812"
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(timestamp + token))
+	fields["timestamp"] = timestamp
+	fields["token"] = token
+	fields["signature"] = hex.EncodeToString(mac.Sum(nil))
+	return fields
+}
+
+// multipartBody builds a multipart form with the given fields and files (field name -> filename, content).
+func multipartBody(t *testing.T, fields map[string]string, files map[string][2]string) (*bytes.Buffer, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		if err := w.WriteField(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for field, f := range files {
+		fw, err := w.CreateFormFile(field, f[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(f[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf, w.FormDataContentType()
+}
+
+// postInbound posts body with the test credentials.
+func postInbound(t *testing.T, url, contentType string, body *bytes.Buffer) (int, inboundResult) {
+	t.Helper()
+	return postInboundAs(t, url, contentType, body, testInboundUser, testInboundPassword)
+}
+
+// postInboundAs posts body with the given Basic auth credentials, or none when user is empty.
+func postInboundAs(t *testing.T, url, contentType string, body *bytes.Buffer, user, password string) (int, inboundResult) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if user != "" {
+		req.SetBasicAuth(user, password)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var result inboundResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return resp.StatusCode, result
+}
+
+func TestHTTPServer_raw(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    *handlerStub
+		body       string
+		wantStatus int
+		want       inboundResult
+	}{
+		{
+			name:       "matched and delivered",
+			handler:    &handlerStub{matched: true},
+			body:       testMessage,
+			wantStatus: http.StatusOK,
+			want:       inboundResult{MailID: "abc@example.org", Matched: true, Delivered: true},
+		},
+		{
+			name:       "not matched",
+			handler:    &handlerStub{matched: false},
+			body:       testMessage,
+			wantStatus: http.StatusOK,
+			want:       inboundResult{MailID: "abc@example.org"},
+		},
+		{
+			name:       "delivery failure asks for a retry",
+			handler:    &handlerStub{matched: true, err: errors.New("callback returned 500")},
+			body:       testMessage,
+			wantStatus: http.StatusServiceUnavailable,
+			want:       inboundResult{MailID: "abc@example.org", Matched: true, Error: "callback returned 500"},
+		},
+		{
+			name:       "too large",
+			handler:    &handlerStub{matched: true},
+			body:       testMessage + strings.Repeat("x", 8192),
+			wantStatus: http.StatusRequestEntityTooLarge,
+			want:       inboundResult{Error: "http: request body too large"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestHTTPServer(t, tt.handler)
+
+			status, got := postInbound(t, ts.URL+"/inbound/raw", "message/rfc822", bytes.NewBufferString(tt.body))
+			if status != tt.wantStatus || got != tt.want {
+				t.Errorf("response = %d %+v, want %d %+v", status, got, tt.wantStatus, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPServer_mailgunFields(t *testing.T) {
+	handler := &handlerStub{matched: true}
+	ts := newTestHTTPServer(t, handler)
+
+	body, contentType := multipartBody(t, signMailgun(map[string]string{
+		"recipient":       "invoices@example.com",
+		"sender":          "bounce@example.org",
+		"from":            "Vendor <vendor@example.org>",
+		"subject":         "Invoice 42",
+		"body-plain":      "Amount: 10 EUR",
+		"message-headers": `[["Message-Id","<mg@example.org>"],["To","orders@example.com"],["Content-Type","multipart/mixed; boundary=x"]]`,
+	}, testMailgunSigningKey, time.Now()), map[string][2]string{
+		"attachment-2": {"second.txt", "2"},
+		"attachment-1": {"invoice.pdf", "%PDF"},
+	})
+	status, result := postInbound(t, ts.URL+"/inbound/mailgun", contentType, body)
+	if status != http.StatusOK || !result.Delivered {
+		t.Fatalf("response = %d %+v, want delivered", status, result)
+	}
+	m := handler.mails[0]
+	if m.Id != "mg@example.org" || m.Sender != "vendor@example.org" || m.Subject != "Invoice 42" || m.Body != "Amount: 10 EUR" {
+		t.Errorf("mail = %+v, want fields from the form", m)
+	}
+	if got := strings.Join(m.Recipients, ","); got != "invoices@example.com,orders@example.com" {
+		t.Errorf("Recipients = %q, want envelope and To", got)
+	}
+	if len(m.Attachments) != 2 || m.Attachments[0].Name != "invoice.pdf" || string(m.Attachments[1].Content) != "2" {
+		t.Errorf("Attachments = %+v, want attachment-1 and attachment-2 in order", m.Attachments)
+	}
+}
+
+func TestHTTPServer_mailgunRejectsInvalidRequestWith406(t *testing.T) {
+	ts := newTestHTTPServer(t, &handlerStub{matched: true})
+
+	fields := signMailgun(map[string]string{"message-headers": "not json"}, testMailgunSigningKey, time.Now())
+	body, contentType := multipartBody(t, fields, nil)
+	if status, _ := postInbound(t, ts.URL+"/inbound/mailgun", contentType, body); status != http.StatusNotAcceptable {
+		t.Errorf("status = %d, want 406 so that Mailgun does not retry", status)
+	}
+}
+
+func TestHTTPServer_sendGrid(t *testing.T) {
+	tests := []struct {
+		name      string
+		fields    map[string]string
+		files     map[string][2]string
+		wantBody  string
+		wantFiles int
+	}{
+		{
+			name: "parsed fields",
+			fields: map[string]string{
+				"headers":  "Message-ID: <abc@example.org>\nFrom: Vendor <vendor@example.org>\nTo: orders@example.com\nSubject: Invoice 42\n",
+				"envelope": `{"to":["invoices@example.com"],"from":"bounce@example.org"}`,
+				"text":     "Amount: 10 EUR",
+			},
+			files:     map[string][2]string{"attachment1": {"invoice.pdf", "%PDF"}},
+			wantBody:  "Amount: 10 EUR",
+			wantFiles: 1,
+		},
+		{
+			name: "raw mime",
+			fields: map[string]string{
+				"email":    testMessage,
+				"envelope": `{"to":["invoices@example.com"],"from":"bounce@example.org"}`,
+			},
+			wantBody: "Amount: 10 EUR\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &handlerStub{matched: true}
+			ts := newTestHTTPServer(t, handler)
+
+			body, contentType := multipartBody(t, tt.fields, tt.files)
+			status, result := postInbound(t, ts.URL+"/inbound/sendgrid", contentType, body)
+			if status != http.StatusOK || result.MailID != "abc@example.org" {
+				t.Fatalf("response = %d %+v, want 200 for abc@example.org", status, result)
+			}
+			m := handler.mails[0]
+			if m.Sender != "vendor@example.org" || m.Subject != "Invoice 42" || m.Body != tt.wantBody || len(m.Attachments) != tt.wantFiles {
+				t.Errorf("mail = %+v, want parsed SendGrid post", m)
+			}
+			if got := strings.Join(m.Recipients, ","); got != "invoices@example.com,orders@example.com" {
+				t.Errorf("Recipients = %q, want envelope and To", got)
+			}
+		})
+	}
+}
+
+func TestHTTPServer_mailgunRejectsReplayedToken(t *testing.T) {
+	handler := &handlerStub{matched: true}
+	ts := newTestHTTPServer(t, handler)
+
+	fields := signMailgun(map[string]string{"message-headers": `[["Message-Id","<mg@example.org>"]]`}, testMailgunSigningKey, time.Now())
+	for i, want := range []int{http.StatusOK, http.StatusUnauthorized} {
+		body, contentType := multipartBody(t, fields, nil)
+		if status, result := postInbound(t, ts.URL+"/inbound/mailgun", contentType, body); status != want {
+			t.Errorf("request %d: response = %d %+v, want %d", i+1, status, result, want)
+		}
+	}
+	if len(handler.mails) != 1 {
+		t.Errorf("handler received %d mails, want 1", len(handler.mails))
+	}
+}
+
+func Test_mailgunTokens(t *testing.T) {
+	seen := &mailgunTokens{expires: make(map[string]time.Time)}
+	now := time.Unix(1717200000, 0)
+	expiry := now.Add(mailgunSignatureMaxAge)
+	if !seen.use("a", expiry, now) || seen.use("a", expiry, now.Add(time.Minute)) {
+		t.Fatal("token must be accepted once within its window")
+	}
+	if !seen.use("b", expiry, expiry) || len(seen.expires) != 1 {
+		t.Errorf("expired tokens must be dropped, got %v", seen.expires)
+	}
+}
+
+func TestHTTPServer_rejectsUnauthenticatedRequests(t *testing.T) {
+	mailgunFields := map[string]string{"message-headers": `[["Message-Id","<mg@example.org>"]]`, "subject": "Invoice 42"}
+	tests := []struct {
+		name     string
+		path     string
+		fields   map[string]string
+		user     string
+		password string
+	}{
+		{name: "raw without credentials", path: "/inbound/raw"},
+		{name: "raw with wrong password", path: "/inbound/raw", user: testInboundUser, password: "guess"},
+		{name: "sendgrid without credentials", path: "/inbound/sendgrid", fields: map[string]string{"email": testMessage}},
+		{name: "mailgun without signature", path: "/inbound/mailgun", fields: mailgunFields},
+		{name: "mailgun signed with another key", path: "/inbound/mailgun", fields: signMailgun(map[string]string{}, "key-other", time.Now())},
+		{name: "mailgun with stale timestamp", path: "/inbound/mailgun", fields: signMailgun(map[string]string{}, testMailgunSigningKey, time.Now().Add(-time.Hour))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &handlerStub{matched: true}
+			ts := newTestHTTPServer(t, handler)
+
+			body, contentType := bytes.NewBufferString(testMessage), "message/rfc822"
+			if tt.fields != nil {
+				body, contentType = multipartBody(t, tt.fields, nil)
+			}
+			status, result := postInboundAs(t, ts.URL+tt.path, contentType, body, tt.user, tt.password)
+			if status != http.StatusUnauthorized || result.Error == "" {
+				t.Errorf("response = %d %+v, want 401 with an error", status, result)
+			}
+			if len(handler.mails) != 0 {
+				t.Errorf("handler received %d mails, want none", len(handler.mails))
+			}
+		})
+	}
+}
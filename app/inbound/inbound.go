@@ -0,0 +1,132 @@
+package inbound
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
+	"github.com/jo-hoe/go-mail-webhook-service/app/mail"
+)
+
+// MailHandler processes a single pushed mail.
+// It reports whether all selectors matched and returns an error when webhook delivery failed.
+type MailHandler interface {
+	HandleMail(ctx context.Context, m mail.Mail) (matched bool, err error)
+}
+
+// listener is a started inbound server that can be stopped.
+type listener interface {
+	ListenAndServe() error
+	Close() error
+}
+
+// Processor handles pushed mails and processes mails fetched after push notifications.
+type Processor interface {
+	MailHandler
+	MailProcessor
+}
+
+// Run starts all enabled inbound listeners and Gmail push endpoints and blocks until ctx is
+// cancelled or a listener fails. HTTP endpoints sharing a listen address are served together.
+func Run(ctx context.Context, cfg *config.Config, processor Processor) error {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	var listeners []listener
+	if cfg.Inbound.SMTP.Enabled {
+		srv, err := NewSMTPServer(cfg.Inbound.SMTP, processor)
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, srv)
+		slog.Info("smtp receiver listening", "address", cfg.Inbound.SMTP.ListenAddress, "starttls", srv.TLSConfig != nil)
+	}
+
+	muxes := map[string]*http.ServeMux{}
+	var addresses []string
+	muxFor := func(addr string) *http.ServeMux {
+		if muxes[addr] == nil {
+			muxes[addr] = http.NewServeMux()
+			addresses = append(addresses, addr)
+		}
+		return muxes[addr]
+	}
+	routes := map[string]bool{}
+	if c := cfg.Inbound.HTTP; c.Enabled {
+		if err := registerInboundRoutes(muxFor(c.ListenAddress), c, processor); err != nil {
+			return err
+		}
+		for _, p := range []string{c.RawPath, c.MailgunPath, c.SendGridPath} {
+			routes[c.ListenAddress+p] = true
+		}
+		slog.Info("http inbound-parse endpoint listening", "address", c.ListenAddress,
+			"rawPath", c.RawPath, "mailgunPath", c.MailgunPath, "sendgridPath", c.SendGridPath)
+	}
+
+	for _, acc := range cfg.MailClient.AllAccounts() {
+		push := acc.Gmail.Push
+		if !acc.Gmail.Enabled || !push.Enabled {
+			continue
+		}
+		if routes[push.ListenAddress+push.Path] {
+			return fmt.Errorf("gmail push path %s on %s of account %q is already in use", push.Path, push.ListenAddress, acc.Name)
+		}
+		routes[push.ListenAddress+push.Path] = true
+
+		svc, err := mail.NewMailClientService(mail.GmailClientType, acc.MailClient)
+		if err != nil {
+			return err
+		}
+		source, ok := svc.(gmailWatchSource)
+		if !ok {
+			return fmt.Errorf("mail client of account %q does not support gmail push", acc.Name)
+		}
+		ep := NewGmailPushEndpoint(acc.Name, push, source, processor)
+		if err := ep.Start(ctx); err != nil {
+			return fmt.Errorf("could not start gmail push for account %q: %w", acc.Name, err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ep.RenewLoop(ctx)
+		}()
+		muxFor(push.ListenAddress).Handle("POST "+push.Path, ep)
+		slog.Info("gmail push endpoint listening", "account", acc.Name, "address", push.ListenAddress, "path", push.Path)
+	}
+	for _, addr := range addresses {
+		listeners = append(listeners, newHTTPServer(addr, muxes[addr]))
+	}
+	if len(listeners) == 0 {
+		return errors.New("no inbound listener enabled")
+	}
+
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		wg.Add(1)
+		go func(l listener) {
+			defer wg.Done()
+			errs <- l.ListenAndServe()
+		}(l)
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errs:
+	}
+	cancel()
+	for _, l := range listeners {
+		if cerr := l.Close(); cerr != nil {
+			slog.Debug("error closing inbound listener", "error", cerr)
+		}
+	}
+	return err
+}
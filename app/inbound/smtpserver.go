@@ -0,0 +1,173 @@
+package inbound
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	gomail "net/mail"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-smtp"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
+	"github.com/jo-hoe/go-mail-webhook-service/app/mail"
+	"github.com/jo-hoe/go-mail-webhook-service/app/mail/message"
+)
+
+// smtpSessionTimeout bounds reads and writes of a single SMTP connection.
+const smtpSessionTimeout = 5 * time.Minute
+
+// NewSMTPServer creates an SMTP server that accepts mail for the allowed recipient domains
+// and hands every received message to handler. STARTTLS is offered when a certificate is configured.
+func NewSMTPServer(cfg config.SMTPInbound, handler MailHandler) (*smtp.Server, error) {
+	srv := smtp.NewServer(&smtpBackend{cfg: cfg, handler: handler})
+	srv.Addr = cfg.ListenAddress
+	srv.Domain = cfg.Domain
+	srv.MaxMessageBytes = int(cfg.MaxMessageSizeBytes)
+	srv.MaxRecipients = 100
+	srv.ReadTimeout = smtpSessionTimeout
+	srv.WriteTimeout = smtpSessionTimeout
+	srv.AuthDisabled = true
+	srv.ErrorLog = slogLogger{}
+
+	if cfg.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load inbound.smtp TLS certificate: %w", err)
+		}
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+	return srv, nil
+}
+
+// smtpBackend creates anonymous sessions; authentication is not supported.
+type smtpBackend struct {
+	cfg     config.SMTPInbound
+	handler MailHandler
+}
+
+func (b *smtpBackend) Login(_ *smtp.ConnectionState, _, _ string) (smtp.Session, error) {
+	return nil, smtp.ErrAuthUnsupported
+}
+
+func (b *smtpBackend) AnonymousLogin(state *smtp.ConnectionState) (smtp.Session, error) {
+	return &smtpSession{backend: b, remote: state.RemoteAddr.String()}, nil
+}
+
+// smtpSession holds the envelope of the message currently being received.
+type smtpSession struct {
+	backend *smtpBackend
+	remote  string
+	from    string
+	rcpts   []string
+}
+
+func (s *smtpSession) Mail(from string, _ smtp.MailOptions) error {
+	s.from = from
+	return nil
+}
+
+func (s *smtpSession) Rcpt(to string) error {
+	if at := strings.LastIndex(to, "@"); at > 0 {
+		domain := strings.ToLower(to[at+1:])
+		for _, allowed := range s.backend.cfg.AllowedRecipientDomains {
+			if domain == allowed {
+				s.rcpts = append(s.rcpts, to)
+				return nil
+			}
+		}
+	}
+	slog.Info("smtp recipient rejected", "recipient", to, "remote", s.remote)
+	return &smtp.SMTPError{Code: 550, EnhancedCode: smtp.EnhancedCode{5, 7, 1}, Message: "Recipient domain not accepted here"}
+}
+
+func (s *smtpSession) Data(r io.Reader) error {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	m, err := mailFromRaw(raw, s.from, s.rcpts)
+	if err != nil {
+		slog.Error("could not parse received message", "remote", s.remote, "error", err)
+		return &smtp.SMTPError{Code: 554, EnhancedCode: smtp.EnhancedCode{5, 6, 0}, Message: "Message could not be parsed"}
+	}
+
+	matched, err := s.backend.handler.HandleMail(context.Background(), m)
+	if err != nil {
+		slog.Error("webhook delivery for received message failed", "mailId", m.Id, "error", err)
+		return &smtp.SMTPError{Code: 451, EnhancedCode: smtp.EnhancedCode{4, 3, 0}, Message: "Webhook delivery failed, try again later"}
+	}
+	if !matched {
+		slog.Info("received message did not match selectors; discarding", "mailId", m.Id)
+	}
+	return nil
+}
+
+func (s *smtpSession) Reset() {
+	s.from = ""
+	s.rcpts = nil
+}
+
+func (s *smtpSession) Logout() error {
+	return nil
+}
+
+// mailFromRaw parses a pushed message and merges in its envelope.
+// Envelope recipients come first so that Bcc and forwarded deliveries can be matched;
+// the envelope sender is only used when the message has no From header.
+// Mail.Id is the Message-ID, or a content hash when absent.
+func mailFromRaw(raw []byte, envelopeFrom string, envelopeRcpts []string) (mail.Mail, error) {
+	id := ""
+	if msg, err := gomail.ReadMessage(bytes.NewReader(raw)); err == nil {
+		id = strings.Trim(strings.TrimSpace(msg.Header.Get("Message-ID")), "<>")
+	}
+	if id == "" {
+		sum := sha256.Sum256(raw)
+		id = "sha256-" + hex.EncodeToString(sum[:12])
+	}
+
+	m, err := message.Parse(id, raw)
+	if err != nil {
+		return mail.Mail{}, err
+	}
+	if m.Sender == "" {
+		m.Sender = envelopeFrom
+	}
+	m.Recipients = mergeRecipients(envelopeRcpts, m.Recipients)
+	m.ReceivedAt = time.Now().UTC()
+	return m, nil
+}
+
+// mergeRecipients concatenates the lists, dropping case-insensitive duplicates.
+func mergeRecipients(lists ...[]string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, list := range lists {
+		for _, r := range list {
+			key := strings.ToLower(r)
+			if r == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// slogLogger forwards go-smtp internal errors to slog.
+type slogLogger struct{}
+
+func (slogLogger) Printf(format string, v ...interface{}) {
+	slog.Error("smtp server error", "error", fmt.Sprintf(format, v...))
+}
+
+func (slogLogger) Println(v ...interface{}) {
+	slog.Error("smtp server error", "error", strings.TrimSpace(fmt.Sprintln(v...)))
+}
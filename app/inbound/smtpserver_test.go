@@ -0,0 +1,132 @@
+package inbound
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/emersion/go-smtp"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
+	"github.com/jo-hoe/go-mail-webhook-service/app/mail"
+)
+
+// handlerStub records the mails it receives and returns the configured result.
+type handlerStub struct {
+	mu      sync.Mutex
+	mails   []mail.Mail
+	matched bool
+	err     error
+}
+
+func (h *handlerStub) HandleMail(_ context.Context, m mail.Mail) (bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.mails = append(h.mails, m)
+	return h.matched, h.err
+}
+
+func startTestSMTPServer(t *testing.T, handler MailHandler) string {
+	t.Helper()
+	srv, err := NewSMTPServer(config.SMTPInbound{
+		Enabled:                 true,
+		Domain:                  "mx.example.com",
+		AllowedRecipientDomains: []string{"example.com"},
+		MaxMessageSizeBytes:     1024,
+	}, handler)
+	if err != nil {
+		t.Fatalf("NewSMTPServer() error = %v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(func() { _ = srv.Close() })
+	return l.Addr().String()
+}
+
+const testMessage = "From: Vendor <vendor@example.org>\r\n" +
+	"To: orders@example.com\r\n" +
+	"Message-ID: <abc@example.org>\r\n" +
+	"Subject: Invoice 42\r\n" +
+	"\r\n" +
+	"Amount: 10 EUR\r\n"
+
+func TestSMTPServer_acceptsAndHandsOverMail(t *testing.T) {
+	handler := &handlerStub{matched: true}
+	addr := startTestSMTPServer(t, handler)
+
+	err := smtp.SendMail(addr, nil, "bounce@example.org", []string{"invoices@EXAMPLE.com"}, strings.NewReader(testMessage))
+	if err != nil {
+		t.Fatalf("SendMail() error = %v", err)
+	}
+	if len(handler.mails) != 1 {
+		t.Fatalf("handler received %d mails, want 1", len(handler.mails))
+	}
+	m := handler.mails[0]
+	if m.Id != "abc@example.org" || m.Sender != "vendor@example.org" || m.Subject != "Invoice 42" {
+		t.Errorf("mail = %+v, want parsed headers", m)
+	}
+	if got := strings.Join(m.Recipients, ","); got != "invoices@EXAMPLE.com,orders@example.com" {
+		t.Errorf("Recipients = %q, want envelope recipient first", got)
+	}
+	if m.ReceivedAt.IsZero() {
+		t.Error("ReceivedAt should be set to the arrival time")
+	}
+}
+
+func TestSMTPServer_rejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  *handlerStub
+		rcpt     string
+		message  string
+		wantCode int
+	}{
+		{
+			name:     "recipient domain not allowed",
+			handler:  &handlerStub{matched: true},
+			rcpt:     "someone@elsewhere.org",
+			message:  testMessage,
+			wantCode: 550,
+		},
+		{
+			name:     "message too large",
+			handler:  &handlerStub{matched: true},
+			rcpt:     "orders@example.com",
+			message:  testMessage + strings.Repeat(strings.Repeat("x", 70)+"\r\n", 30),
+			wantCode: 552,
+		},
+		{
+			name:     "webhook delivery failure is temporary",
+			handler:  &handlerStub{matched: true, err: errors.New("callback returned 500")},
+			rcpt:     "orders@example.com",
+			message:  testMessage,
+			wantCode: 451,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := startTestSMTPServer(t, tt.handler)
+
+			err := smtp.SendMail(addr, nil, "bounce@example.org", []string{tt.rcpt}, strings.NewReader(tt.message))
+			var smtpErr *smtp.SMTPError
+			if !errors.As(err, &smtpErr) || smtpErr.Code != tt.wantCode {
+				t.Errorf("SendMail() error = %v, want SMTP code %d", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestSMTPServer_unmatchedMailIsAccepted(t *testing.T) {
+	handler := &handlerStub{matched: false}
+	addr := startTestSMTPServer(t, handler)
+
+	if err := smtp.SendMail(addr, nil, "", []string{"orders@example.com"}, strings.NewReader(testMessage)); err != nil {
+		t.Errorf("SendMail() error = %v, want unmatched mail to be accepted and discarded", err)
+	}
+}
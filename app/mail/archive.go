@@ -0,0 +1,225 @@
+package mail
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"strings"
+
+	"golang.org/x/text/encoding/charmap"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
+	"github.com/jo-hoe/go-mail-webhook-service/app/mail/message"
+)
+
+// errArchiveLimit reports that an archive exceeds the configured expansion limits.
+var errArchiveLimit = errors.New("archive exceeds the expansion limits")
+
+// archiveKind identifies the container format of an attachment from its content.
+type archiveKind int
+
+const (
+	notArchive archiveKind = iota
+	zipArchive
+	tarArchive
+	gzipArchive
+)
+
+func detectArchive(data []byte) archiveKind {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")), bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		return zipArchive
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		return gzipArchive
+	case len(data) >= 262 && string(data[257:262]) == "ustar":
+		return tarArchive
+	default:
+		return notArchive
+	}
+}
+
+// isArchive reports whether a file is a zip, tar or tar.gz archive by its name or declared type and
+// its content. Office documents are zip files too but are never expanded.
+func isArchive(name, contentType string, data []byte) bool {
+	if detectArchive(data) == notArchive {
+		return false
+	}
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	switch strings.ToLower(contentType) {
+	case "application/zip", "application/x-zip-compressed", "application/x-tar", "application/x-gtar",
+		"application/gzip", "application/x-gzip", "application/x-compressed-tar":
+		return true
+	}
+	return false
+}
+
+// ExpandArchiveAttachments replaces the zip, tar and tar.gz attachments of m and of its embedded
+// mails with their members matching cfg.Include. Nested archives are expanded up to cfg.MaxDepth
+// levels. An archive exceeding cfg.MaxEntries members or cfg.MaxTotalSizeBytes of uncompressed
+// data, or one that cannot be read, is kept unexpanded.
+func ExpandArchiveAttachments(m *Mail, cfg config.ArchiveExpansion) {
+	if !cfg.Enabled {
+		return
+	}
+	var expanded []Attachment
+	for _, a := range m.Attachments {
+		if !isArchive(a.Name, a.ContentType, a.Content) {
+			expanded = append(expanded, a)
+			continue
+		}
+		b := &archiveBudget{entries: cfg.MaxEntries, bytes: cfg.MaxTotalSizeBytes}
+		members, err := expandArchive(a.Content, cfg, 1, b)
+		if err != nil {
+			slog.Warn("forwarding archive unexpanded", "mailId", m.Id, "name", a.Name, "error", err)
+			expanded = append(expanded, a)
+			continue
+		}
+		slog.Debug("expanded archive attachment", "mailId", m.Id, "name", a.Name, "members", len(members))
+		expanded = append(expanded, members...)
+	}
+	m.Attachments = expanded
+	if len(m.Embedded) > 0 {
+		// Copy so that the embedded mails of the caller's Mail values stay unchanged.
+		m.Embedded = append([]Mail(nil), m.Embedded...)
+		for i := range m.Embedded {
+			ExpandArchiveAttachments(&m.Embedded[i], cfg)
+		}
+	}
+}
+
+// archiveBudget is the number of members and uncompressed bytes an archive may still produce.
+type archiveBudget struct {
+	entries int
+	bytes   int64
+}
+
+// read reads r completely, charging the budget; it never reads more than the remaining bytes.
+func (b *archiveBudget) read(r io.Reader) ([]byte, error) {
+	b.entries--
+	if b.entries < 0 {
+		return nil, fmt.Errorf("%w: more than the allowed number of members", errArchiveLimit)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, b.bytes+1))
+	if err != nil {
+		return nil, err
+	}
+	b.bytes -= int64(len(data))
+	if b.bytes < 0 {
+		return nil, fmt.Errorf("%w: uncompressed size over the limit", errArchiveLimit)
+	}
+	return data, nil
+}
+
+// expandArchive returns the members of the archive in data that match cfg.Include, expanding
+// nested archives while depth < cfg.MaxDepth.
+func expandArchive(data []byte, cfg config.ArchiveExpansion, depth int, b *archiveBudget) ([]Attachment, error) {
+	type member struct {
+		name string
+		data []byte
+	}
+	var members []member
+	switch detectArchive(data) {
+	case zipArchive:
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("read zip: %w", err)
+		}
+		if len(zr.File) > b.entries {
+			return nil, fmt.Errorf("%w: %d members", errArchiveLimit, len(zr.File))
+		}
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			if f.Flags&0x1 != 0 {
+				slog.Warn("skipping encrypted archive member", "name", f.Name)
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("open zip member %s: %w", f.Name, err)
+			}
+			content, err := b.read(rc)
+			_ = rc.Close()
+			if err != nil {
+				return nil, err
+			}
+			name := f.Name
+			if f.NonUTF8 {
+				// Zip names without the UTF-8 flag are in the DOS codepage.
+				if decoded, err := charmap.CodePage437.NewDecoder().String(name); err == nil {
+					name = decoded
+				}
+			}
+			members = append(members, member{name, content})
+		}
+	case gzipArchive:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("read gzip: %w", err)
+		}
+		// The decompressed tar stream counts towards the size limit like its members.
+		tarData, err := (&archiveBudget{entries: 1, bytes: b.bytes}).read(zr)
+		if err != nil {
+			return nil, err
+		}
+		if detectArchive(tarData) != tarArchive {
+			return nil, errors.New("gzip attachment does not contain a tar archive")
+		}
+		return expandArchive(tarData, cfg, depth, b)
+	case tarArchive:
+		tr := tar.NewReader(bytes.NewReader(data))
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("read tar: %w", err)
+			}
+			if h.Typeflag != tar.TypeReg {
+				continue
+			}
+			content, err := b.read(tr)
+			if err != nil {
+				return nil, err
+			}
+			members = append(members, member{h.Name, content})
+		}
+	default:
+		return nil, errors.New("not an archive")
+	}
+
+	var result []Attachment
+	for _, mb := range members {
+		name := path.Base(mb.name)
+		if strings.HasPrefix(mb.name, "__MACOSX/") || strings.HasPrefix(name, "._") {
+			// macOS resource forks are not part of the content.
+			continue
+		}
+		if depth < cfg.MaxDepth && isArchive(name, "", mb.data) {
+			nested, err := expandArchive(mb.data, cfg, depth+1, b)
+			if err != nil {
+				return nil, fmt.Errorf("nested archive %s: %w", mb.name, err)
+			}
+			result = append(result, nested...)
+			continue
+		}
+		if ok, _ := path.Match(strings.ToLower(cfg.Include), strings.ToLower(name)); !ok {
+			continue
+		}
+		result = append(result, message.NewAttachment(name, mb.data, "", "", false))
+	}
+	return result, nil
+}
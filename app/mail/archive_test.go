@@ -0,0 +1,185 @@
+package mail
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"testing"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
+	"github.com/jo-hoe/go-mail-webhook-service/app/mail/message"
+)
+
+type archiveFile struct {
+	name string
+	data string
+}
+
+func zipArchiveOf(t *testing.T, files ...archiveFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, f := range files {
+		fw, err := w.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(f.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarGzArchiveOf(t *testing.T, files ...archiveFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0o644, Size: int64(len(f.data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func attachmentNames(atts []Attachment) []string {
+	var names []string
+	for _, a := range atts {
+		names = append(names, a.Name)
+	}
+	return names
+}
+
+func TestExpandArchiveAttachments(t *testing.T) {
+	invoices := zipArchiveOf(t,
+		archiveFile{"invoices/invoice-1.pdf", "%PDF-1"},
+		archiveFile{"invoices/INVOICE-2.PDF", "%PDF-2"},
+		archiveFile{"readme.txt", "see attached"},
+		archiveFile{"__MACOSX/invoices/._invoice-1.pdf", "fork"},
+	)
+	nested := zipArchiveOf(t,
+		archiveFile{"outer.pdf", "%PDF-outer"},
+		archiveFile{"inner.zip", string(zipArchiveOf(t, archiveFile{"inner.pdf", "%PDF-inner"}))},
+	)
+	enabled := config.ArchiveExpansion{Enabled: true, Include: "*", MaxDepth: 2, MaxEntries: 100, MaxTotalSizeBytes: 1 << 20}
+	withInclude := func(cfg config.ArchiveExpansion, include string) config.ArchiveExpansion {
+		cfg.Include = include
+		return cfg
+	}
+
+	tests := []struct {
+		name  string
+		atts  []Attachment
+		cfg   config.ArchiveExpansion
+		want  []string
+		check func(t *testing.T, atts []Attachment)
+	}{
+		{
+			name: "disabled",
+			atts: []Attachment{message.NewAttachment("invoices.zip", invoices, "application/zip", "", false)},
+			cfg:  config.ArchiveExpansion{},
+			want: []string{"invoices.zip"},
+		},
+		{
+			name: "zip filtered by glob",
+			atts: []Attachment{
+				message.NewAttachment("cover.txt", []byte("hello"), "text/plain", "", false),
+				message.NewAttachment("invoices.zip", invoices, "application/zip", "", false),
+			},
+			cfg:  withInclude(enabled, "*.pdf"),
+			want: []string{"cover.txt", "invoice-1.pdf", "INVOICE-2.PDF"},
+			check: func(t *testing.T, atts []Attachment) {
+				if string(atts[1].Content) != "%PDF-1" || atts[1].ContentType != "application/pdf" {
+					t.Errorf("member = %q (%s), want the PDF content", atts[1].Content, atts[1].ContentType)
+				}
+			},
+		},
+		{
+			name: "tar.gz",
+			atts: []Attachment{message.NewAttachment("reports.tar.gz", tarGzArchiveOf(t,
+				archiveFile{"q1.csv", "a,b"}, archiveFile{"q2.csv", "c,d"}), "application/gzip", "", false)},
+			cfg:  enabled,
+			want: []string{"q1.csv", "q2.csv"},
+		},
+		{
+			name: "nested archive within maxDepth",
+			atts: []Attachment{message.NewAttachment("nested.zip", nested, "application/zip", "", false)},
+			cfg:  enabled,
+			want: []string{"outer.pdf", "inner.pdf"},
+		},
+		{
+			name: "nested archive beyond maxDepth kept as a member",
+			atts: []Attachment{message.NewAttachment("nested.zip", nested, "application/zip", "", false)},
+			cfg:  func() config.ArchiveExpansion { c := enabled; c.MaxDepth = 1; return c }(),
+			want: []string{"outer.pdf", "inner.zip"},
+		},
+		{
+			name: "too many entries kept unexpanded",
+			atts: []Attachment{message.NewAttachment("invoices.zip", invoices, "application/zip", "", false)},
+			cfg:  func() config.ArchiveExpansion { c := enabled; c.MaxEntries = 2; return c }(),
+			want: []string{"invoices.zip"},
+		},
+		{
+			name: "too large kept unexpanded",
+			atts: []Attachment{message.NewAttachment("invoices.zip", invoices, "application/zip", "", false)},
+			cfg:  func() config.ArchiveExpansion { c := enabled; c.MaxTotalSizeBytes = 10; return c }(),
+			want: []string{"invoices.zip"},
+		},
+		{
+			name: "office documents are not expanded",
+			atts: []Attachment{message.NewAttachment("report.docx", zipArchiveOf(t, archiveFile{"word/document.xml", "<w/>"}),
+				"application/vnd.openxmlformats-officedocument.wordprocessingml.document", "", false)},
+			cfg:  enabled,
+			want: []string{"report.docx"},
+		},
+		{
+			name: "corrupt archive kept unexpanded",
+			atts: []Attachment{message.NewAttachment("broken.zip", []byte("PK\x03\x04garbage"), "application/zip", "", false)},
+			cfg:  enabled,
+			want: []string{"broken.zip"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Mail{Id: "1", Attachments: tt.atts}
+			ExpandArchiveAttachments(&m, tt.cfg)
+			if got := attachmentNames(m.Attachments); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("attachments = %v, want %v", got, tt.want)
+			}
+			if tt.check != nil {
+				tt.check(t, m.Attachments)
+			}
+		})
+	}
+}
+
+func TestExpandArchiveAttachments_embeddedMails(t *testing.T) {
+	archive := zipArchiveOf(t, archiveFile{"invoice.pdf", "%PDF-"})
+	inner := Mail{Id: "1", Attachments: []Attachment{message.NewAttachment("invoice.zip", archive, "application/zip", "", false)}}
+	m := Mail{Id: "1", Embedded: []Mail{inner}}
+
+	ExpandArchiveAttachments(&m, config.ArchiveExpansion{Enabled: true, Include: "*", MaxDepth: 1, MaxEntries: 10, MaxTotalSizeBytes: 1024})
+
+	if got := attachmentNames(m.Embedded[0].Attachments); !reflect.DeepEqual(got, []string{"invoice.pdf"}) {
+		t.Errorf("embedded attachments = %v, want [invoice.pdf]", got)
+	}
+	if got := attachmentNames(inner.Attachments); !reflect.DeepEqual(got, []string{"invoice.zip"}) {
+		t.Errorf("caller's embedded mail changed to %v", got)
+	}
+}
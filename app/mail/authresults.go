@@ -0,0 +1,306 @@
+package mail
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
+	"github.com/jo-hoe/go-mail-webhook-service/app/mail/message"
+)
+
+// AuthResult, AuthResults and AuthVerdict are defined in package message since Mail holds the verdict.
+type (
+	AuthResult  = message.AuthResult
+	AuthResults = message.AuthResults
+	AuthVerdict = message.AuthVerdict
+)
+
+// AuthenticateSender sets the Authentication verdict of m. Only the topmost Authentication-Results
+// of a service in cfg.TrustedAuthServIDs is evaluated, since senders can add such headers
+// themselves, also with a trusted authserv-id below the receiver's; without any, no sender is
+// authenticated. When it reports arc=pass, the ARC-Authentication-Results of the highest ARC
+// instance are evaluated too if cfg.TrustedARCSealers sealed it, so that mails passing through a
+// trusted mailing list or forwarder keep their original verdict.
+//
+// The verdict of embedded mails is left unauthenticated: the headers of an attached message were
+// written by whoever attached it.
+func AuthenticateSender(m *Mail, cfg config.SenderAuthentication) {
+	v := AuthVerdict{Domain: fromDomain(*m)}
+	sealers := make(map[int]string)
+	for _, h := range m.Headers {
+		switch strings.ToLower(h.Name) {
+		case "authentication-results":
+			if r, ok := parseAuthResults(h.Value, false); ok {
+				v.Results = append(v.Results, r)
+			}
+		case "arc-authentication-results":
+			if r, ok := parseAuthResults(h.Value, true); ok {
+				v.ARCResults = append(v.ARCResults, r)
+			}
+		case "arc-seal":
+			if i, d := parseARCSeal(h.Value); i > 0 {
+				sealers[i] = d
+			}
+		}
+	}
+
+	trusted := trustedAuthResults(v.Results, cfg.TrustedAuthServIDs)
+	v.SPF = summarizeAuthResults(trusted, "spf")
+	v.DKIM = summarizeAuthResults(trusted, "dkim")
+	v.DMARC = summarizeAuthResults(trusted, "dmarc")
+	v.ARC = summarizeAuthResults(trusted, "arc")
+	switch {
+	case v.Domain == "":
+		v.Reason = "no single From address"
+	case len(trusted) == 0:
+		v.Reason = "no trusted Authentication-Results"
+	default:
+		v.AuthServID = trusted[0].AuthServID
+		for _, r := range trusted {
+			if reason, ok := authenticatesDomain(r, v.Domain); ok {
+				v.Pass, v.Reason, v.AuthServID = true, reason, r.AuthServID
+				break
+			}
+		}
+		if !v.Pass && v.ARC == "pass" {
+			if r, ok := latestARCResults(v.ARCResults); ok && slices.Contains(cfg.TrustedARCSealers, sealers[r.Instance]) {
+				if reason, ok := authenticatesDomain(r, v.Domain); ok {
+					v.Pass, v.AuthServID = true, r.AuthServID
+					v.Reason = fmt.Sprintf("arc=pass i=%d d=%s: %s", r.Instance, sealers[r.Instance], reason)
+				}
+			}
+		}
+		if !v.Pass {
+			v.Reason = "no aligned dkim=pass or dmarc=pass"
+		}
+	}
+	m.Authentication = v
+}
+
+// fromDomain returns the lower-cased domain of the single From address of m, or "".
+func fromDomain(m Mail) string {
+	values := m.HeaderValues("From")
+	if len(values) != 1 {
+		return ""
+	}
+	list, err := message.AddressParser.ParseList(values[0])
+	if err != nil || len(list) != 1 {
+		return ""
+	}
+	return addressDomain(list[0].Address)
+}
+
+func addressDomain(addr string) string {
+	i := strings.LastIndex(addr, "@")
+	if i < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSuffix(addr[i+1:], "."))
+}
+
+// trustedAuthResults returns the topmost result added by a service in trusted, the one written by
+// the last trusted hop. Results below it are ignored even with a trusted authserv-id, since they
+// were already in the message when it arrived there.
+func trustedAuthResults(results []AuthResults, trusted []string) []AuthResults {
+	for _, r := range results {
+		if slices.Contains(trusted, r.AuthServID) {
+			return []AuthResults{r}
+		}
+	}
+	return nil
+}
+
+// latestARCResults returns the topmost ARC-Authentication-Results of the highest ARC instance, the
+// one added by the last sealer.
+func latestARCResults(results []AuthResults) (AuthResults, bool) {
+	latest, ok := AuthResults{}, false
+	for _, r := range results {
+		if r.Instance > latest.Instance {
+			latest, ok = r, true
+		}
+	}
+	return latest, ok
+}
+
+// summarizeAuthResults returns "pass" when any result of method passed, the first result otherwise.
+func summarizeAuthResults(results []AuthResults, method string) string {
+	summary := ""
+	for _, r := range results {
+		for _, res := range r.Results {
+			if res.Method != method {
+				continue
+			}
+			if res.Result == "pass" {
+				return "pass"
+			}
+			if summary == "" {
+				summary = res.Result
+			}
+		}
+	}
+	return summary
+}
+
+// authenticatesDomain reports whether r holds dmarc=pass with header.from domain or dkim=pass for a signing
+// domain in relaxed alignment with it (the same domain, or one a subdomain of the other).
+func authenticatesDomain(r AuthResults, domain string) (string, bool) {
+	for _, res := range r.Results {
+		if res.Result != "pass" {
+			continue
+		}
+		switch res.Method {
+		case "dmarc":
+			if strings.ToLower(res.Properties["header.from"]) == domain {
+				return "dmarc=pass", true
+			}
+		case "dkim":
+			d := strings.ToLower(res.Properties["header.d"])
+			if d == "" {
+				// Gmail reports the signing identity instead, e.g. header.i=@example.com.
+				d = addressDomain(res.Properties["header.i"])
+			}
+			if d != "" && (d == domain || strings.HasSuffix(domain, "."+d) || strings.HasSuffix(d, "."+domain)) {
+				return "dkim=pass header.d=" + d, true
+			}
+		}
+	}
+	return "", false
+}
+
+// parseAuthResults parses an Authentication-Results value such as
+// "mx.example.org; spf=pass smtp.mailfrom=example.com; dkim=pass (ok) header.d=example.com".
+// ARC-Authentication-Results values start with the instance, e.g. "i=1; lists.example.org; ...".
+func parseAuthResults(value string, arc bool) (AuthResults, bool) {
+	segments := message.SplitHeaderParams(stripHeaderComments(value))
+	var r AuthResults
+	if arc {
+		k, v, ok := strings.Cut(strings.TrimSpace(segments[0]), "=")
+		if !ok || strings.TrimSpace(strings.ToLower(k)) != "i" {
+			return AuthResults{}, false
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || n < 1 || len(segments) < 2 {
+			return AuthResults{}, false
+		}
+		r.Instance = n
+		segments = segments[1:]
+	}
+	fields := strings.Fields(segments[0])
+	if len(fields) == 0 {
+		return AuthResults{}, false
+	}
+	r.AuthServID = strings.ToLower(fields[0])
+
+	for _, seg := range segments[1:] {
+		tokens := authResultTokens(seg)
+		if len(tokens) == 0 {
+			continue
+		}
+		method, result, ok := strings.Cut(tokens[0], "=")
+		if !ok {
+			// "none" when no method applied.
+			continue
+		}
+		method, _, _ = strings.Cut(method, "/")
+		res := AuthResult{Method: strings.ToLower(method), Result: strings.ToLower(result), Properties: map[string]string{}}
+		for _, t := range tokens[1:] {
+			k, v, ok := strings.Cut(t, "=")
+			if !ok || !strings.Contains(k, ".") {
+				continue
+			}
+			res.Properties[strings.ToLower(k)] = message.UnquoteParam(v)
+		}
+		r.Results = append(r.Results, res)
+	}
+	return r, true
+}
+
+// authResultTokens splits a result such as `dkim = pass header.d="example.com"` at white space
+// outside quoted strings, keeping white space around "=" within the token.
+func authResultTokens(s string) []string {
+	var tokens []string
+	var cur strings.Builder
+	quoted := false
+	s = strings.TrimSpace(s)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case quoted && c == '\\' && i+1 < len(s):
+			cur.WriteByte(c)
+			i++
+			c = s[i]
+		case !quoted && (c == ' ' || c == '\t' || c == '\r' || c == '\n'):
+			j := i
+			for j < len(s) && strings.IndexByte(" \t\r\n", s[j]) >= 0 {
+				j++
+			}
+			if strings.HasSuffix(cur.String(), "=") || (j < len(s) && s[j] == '=') {
+				i = j - 1
+				continue
+			}
+			if cur.Len() > 0 {
+				tokens = append(tokens, cur.String())
+				cur.Reset()
+			}
+			i = j - 1
+			continue
+		}
+		cur.WriteByte(c)
+	}
+	if cur.Len() > 0 {
+		tokens = append(tokens, cur.String())
+	}
+	return tokens
+}
+
+// stripHeaderComments replaces the (possibly nested) RFC 5322 comments outside quoted strings with a space.
+func stripHeaderComments(s string) string {
+	var b strings.Builder
+	depth, quoted := 0, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && (quoted || depth > 0) && i+1 < len(s):
+			if depth == 0 {
+				b.WriteByte(c)
+				b.WriteByte(s[i+1])
+			}
+			i++
+		case depth == 0 && c == '"':
+			quoted = !quoted
+			b.WriteByte(c)
+		case !quoted && c == '(':
+			depth++
+		case !quoted && c == ')' && depth > 0:
+			depth--
+			if depth == 0 {
+				b.WriteByte(' ')
+			}
+		case depth == 0:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// parseARCSeal returns the instance (i=) and lower-cased signing domain (d=) of an ARC-Seal value.
+func parseARCSeal(value string) (int, string) {
+	instance, domain := 0, ""
+	for _, tag := range strings.Split(value, ";") {
+		k, v, ok := strings.Cut(tag, "=")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(k) {
+		case "i":
+			instance, _ = strconv.Atoi(strings.TrimSpace(v))
+		case "d":
+			domain = strings.ToLower(strings.TrimSpace(v))
+		}
+	}
+	return instance, domain
+}
@@ -0,0 +1,281 @@
+package mail
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
+)
+
+func TestParseAuthResults(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		arc   bool
+		want  AuthResults
+	}{
+		{
+			name:  "gmail",
+			value: "mx.google.com;\tdkim=pass header.i=@example.com header.s=s1 header.b=abc;\tspf=pass (google.com: domain of orders@example.com designates 192.0.2.1 as permitted sender) smtp.mailfrom=orders@example.com;\tdmarc=pass (p=REJECT sp=REJECT dis=NONE) header.from=example.com",
+			want: AuthResults{AuthServID: "mx.google.com", Results: []AuthResult{
+				{Method: "dkim", Result: "pass", Properties: map[string]string{"header.i": "@example.com", "header.s": "s1", "header.b": "abc"}},
+				{Method: "spf", Result: "pass", Properties: map[string]string{"smtp.mailfrom": "orders@example.com"}},
+				{Method: "dmarc", Result: "pass", Properties: map[string]string{"header.from": "example.com"}},
+			}},
+		},
+		{
+			name:  "version, reason, quoted values and spaces around equals",
+			value: `MX.Example.NET 1; dkim/1 = fail reason="signature; did not verify" header.d = "example.com"; spf=softfail (a (nested) comment) smtp.mailfrom=example.com`,
+			want: AuthResults{AuthServID: "mx.example.net", Results: []AuthResult{
+				{Method: "dkim", Result: "fail", Properties: map[string]string{"header.d": "example.com"}},
+				{Method: "spf", Result: "softfail", Properties: map[string]string{"smtp.mailfrom": "example.com"}},
+			}},
+		},
+		{
+			name:  "no result",
+			value: "mx.example.net; none",
+			want:  AuthResults{AuthServID: "mx.example.net"},
+		},
+		{
+			name:  "arc",
+			value: "i=2; lists.example.org; dmarc=pass header.from=example.com",
+			arc:   true,
+			want: AuthResults{AuthServID: "lists.example.org", Instance: 2, Results: []AuthResult{
+				{Method: "dmarc", Result: "pass", Properties: map[string]string{"header.from": "example.com"}},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseAuthResults(tt.value, tt.arc)
+			if !ok {
+				t.Fatalf("parseAuthResults() ok = false")
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseAuthResults() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, ok := parseAuthResults("lists.example.org; dmarc=pass", true); ok {
+		t.Error("parseAuthResults() accepted ARC-Authentication-Results without instance")
+	}
+}
+
+func TestAuthenticateSender(t *testing.T) {
+	const listSeal = "i=1; a=rsa-sha256; t=1700000000; cv=none; d=lists.example.org; s=arc; b=abc"
+	trustMX := config.SenderAuthentication{TrustedAuthServIDs: []string{"mx.example.net", "mx.google.com"}}
+	tests := []struct {
+		name       string
+		headers    []Header
+		cfg        config.SenderAuthentication
+		wantPass   bool
+		wantReason string
+	}{
+		{
+			name: "aligned dkim",
+			headers: []Header{
+				{Name: "Authentication-Results", Value: "mx.example.net; spf=fail smtp.mailfrom=bounce.example.com; dkim=pass header.d=example.com"},
+				{Name: "From", Value: "Orders <orders@Example.com>"},
+			},
+			cfg:        trustMX,
+			wantPass:   true,
+			wantReason: "dkim=pass header.d=example.com",
+		},
+		{
+			name: "dkim of a parent domain is aligned",
+			headers: []Header{
+				{Name: "Authentication-Results", Value: "mx.google.com; dkim=pass header.i=@example.com"},
+				{Name: "From", Value: "orders@mail.example.com"},
+			},
+			cfg:        trustMX,
+			wantPass:   true,
+			wantReason: "dkim=pass header.d=example.com",
+		},
+		{
+			name: "dmarc",
+			headers: []Header{
+				{Name: "Authentication-Results", Value: "mx.example.net; dkim=none; dmarc=pass header.from=example.com"},
+				{Name: "From", Value: "orders@example.com"},
+			},
+			cfg:        trustMX,
+			wantPass:   true,
+			wantReason: "dmarc=pass",
+		},
+		{
+			name: "unaligned dkim and spf only",
+			headers: []Header{
+				{Name: "Authentication-Results", Value: "mx.example.net; spf=pass smtp.mailfrom=example.com; dkim=pass header.d=mailer.example.net"},
+				{Name: "From", Value: "orders@example.com"},
+			},
+			cfg:        trustMX,
+			wantReason: "no aligned dkim=pass or dmarc=pass",
+		},
+		{
+			name: "forged header below the receiver's is ignored",
+			headers: []Header{
+				{Name: "Authentication-Results", Value: "mx.example.net; dkim=fail header.d=example.com; dmarc=fail"},
+				{Name: "Authentication-Results", Value: "mx.example.net; dkim=pass header.d=example.com; dmarc=pass header.from=example.com"},
+				{Name: "From", Value: "orders@example.com"},
+			},
+			cfg:        trustMX,
+			wantReason: "no aligned dkim=pass or dmarc=pass",
+		},
+		{
+			name: "dmarc without header.from",
+			headers: []Header{
+				{Name: "Authentication-Results", Value: "mx.example.net; dmarc=pass"},
+				{Name: "From", Value: "orders@example.com"},
+			},
+			cfg:        trustMX,
+			wantReason: "no aligned dkim=pass or dmarc=pass",
+		},
+		{
+			name: "dmarc for another domain",
+			headers: []Header{
+				{Name: "Authentication-Results", Value: "mx.example.net; dmarc=pass header.from=example.net"},
+				{Name: "From", Value: "orders@example.com"},
+			},
+			cfg:        trustMX,
+			wantReason: "no aligned dkim=pass or dmarc=pass",
+		},
+		{
+			name: "header written by a directly delivering sender",
+			headers: []Header{
+				{Name: "Authentication-Results", Value: "evil.example; dmarc=pass header.from=ourvendor.com"},
+				{Name: "From", Value: "orders@ourvendor.com"},
+			},
+			cfg:        config.SenderAuthentication{Required: true},
+			wantReason: "no trusted Authentication-Results",
+		},
+		{
+			name: "untrusted authserv-id",
+			headers: []Header{
+				{Name: "Authentication-Results", Value: "attacker.example; dmarc=pass"},
+				{Name: "From", Value: "orders@example.com"},
+			},
+			cfg:        config.SenderAuthentication{TrustedAuthServIDs: []string{"mx.example.net"}},
+			wantReason: "no trusted Authentication-Results",
+		},
+		{
+			name: "trusted authserv-id below other headers",
+			headers: []Header{
+				{Name: "Authentication-Results", Value: "relay.example.net; dkim=none"},
+				{Name: "Authentication-Results", Value: "mx.example.net; dmarc=pass header.from=example.com"},
+				{Name: "From", Value: "orders@example.com"},
+			},
+			cfg:        config.SenderAuthentication{TrustedAuthServIDs: []string{"mx.example.net"}},
+			wantPass:   true,
+			wantReason: "dmarc=pass",
+		},
+		{
+			name: "arc from a trusted sealer",
+			headers: []Header{
+				{Name: "Authentication-Results", Value: "mx.example.net; dkim=fail header.d=example.com; dmarc=fail; arc=pass"},
+				{Name: "ARC-Seal", Value: listSeal},
+				{Name: "ARC-Authentication-Results", Value: "i=1; lists.example.org; dkim=pass header.d=example.com"},
+				{Name: "From", Value: "orders@example.com"},
+			},
+			cfg:        config.SenderAuthentication{TrustedAuthServIDs: trustMX.TrustedAuthServIDs, TrustedARCSealers: []string{"lists.example.org"}},
+			wantPass:   true,
+			wantReason: "arc=pass i=1 d=lists.example.org: dkim=pass header.d=example.com",
+		},
+		{
+			name: "arc results of an earlier instance are ignored",
+			headers: []Header{
+				{Name: "Authentication-Results", Value: "mx.example.net; dmarc=fail; arc=pass"},
+				{Name: "ARC-Seal", Value: "i=2; a=rsa-sha256; cv=pass; d=forwarder.example.com; s=arc; b=def"},
+				{Name: "ARC-Authentication-Results", Value: "i=2; forwarder.example.com; dmarc=fail"},
+				{Name: "ARC-Seal", Value: listSeal},
+				{Name: "ARC-Authentication-Results", Value: "i=1; lists.example.org; dmarc=pass header.from=example.com"},
+				{Name: "From", Value: "orders@example.com"},
+			},
+			cfg:        config.SenderAuthentication{TrustedAuthServIDs: trustMX.TrustedAuthServIDs, TrustedARCSealers: []string{"lists.example.org"}},
+			wantReason: "no aligned dkim=pass or dmarc=pass",
+		},
+		{
+			name: "arc from an untrusted sealer",
+			headers: []Header{
+				{Name: "Authentication-Results", Value: "mx.example.net; dmarc=fail; arc=pass"},
+				{Name: "ARC-Seal", Value: listSeal},
+				{Name: "ARC-Authentication-Results", Value: "i=1; lists.example.org; dmarc=pass"},
+				{Name: "From", Value: "orders@example.com"},
+			},
+			cfg:        config.SenderAuthentication{TrustedAuthServIDs: trustMX.TrustedAuthServIDs, TrustedARCSealers: []string{"forwarder.example.com"}},
+			wantReason: "no aligned dkim=pass or dmarc=pass",
+		},
+		{
+			name: "broken arc chain",
+			headers: []Header{
+				{Name: "Authentication-Results", Value: "mx.example.net; dmarc=fail; arc=fail"},
+				{Name: "ARC-Seal", Value: listSeal},
+				{Name: "ARC-Authentication-Results", Value: "i=1; lists.example.org; dmarc=pass"},
+				{Name: "From", Value: "orders@example.com"},
+			},
+			cfg:        config.SenderAuthentication{TrustedAuthServIDs: trustMX.TrustedAuthServIDs, TrustedARCSealers: []string{"lists.example.org"}},
+			wantReason: "no aligned dkim=pass or dmarc=pass",
+		},
+		{
+			name:       "no authentication results",
+			headers:    []Header{{Name: "From", Value: "orders@example.com"}},
+			wantReason: "no trusted Authentication-Results",
+		},
+		{
+			name: "several from addresses",
+			headers: []Header{
+				{Name: "Authentication-Results", Value: "mx.example.net; dmarc=pass"},
+				{Name: "From", Value: "orders@example.com, attacker@example.net"},
+			},
+			wantReason: "no single From address",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Mail{Id: "1", Headers: tt.headers}
+			AuthenticateSender(&m, tt.cfg)
+			v := m.Authentication
+			if v.Pass != tt.wantPass || v.Reason != tt.wantReason {
+				t.Errorf("verdict = (%v, %q), want (%v, %q)", v.Pass, v.Reason, tt.wantPass, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestAuthenticateSender_summary(t *testing.T) {
+	m := Mail{Id: "1", Headers: []Header{
+		{Name: "Authentication-Results", Value: "mx.example.net; spf=softfail smtp.mailfrom=example.com; dkim=fail header.d=example.com; dkim=pass header.d=example.com; dmarc=pass header.from=example.com"},
+		{Name: "From", Value: "orders@example.com"},
+	}}
+	AuthenticateSender(&m, config.SenderAuthentication{TrustedAuthServIDs: []string{"mx.example.net"}})
+
+	v := m.Authentication
+	if v.Domain != "example.com" || v.AuthServID != "mx.example.net" {
+		t.Errorf("Domain, AuthServID = %q, %q, want example.com, mx.example.net", v.Domain, v.AuthServID)
+	}
+	if v.SPF != "softfail" || v.DKIM != "pass" || v.DMARC != "pass" || v.ARC != "" {
+		t.Errorf("SPF, DKIM, DMARC, ARC = %q, %q, %q, %q, want softfail, pass, pass, empty", v.SPF, v.DKIM, v.DMARC, v.ARC)
+	}
+	if len(v.Results) != 1 || len(v.Results[0].Results) != 4 {
+		t.Errorf("Results = %+v, want the four results of the header", v.Results)
+	}
+}
+
+func TestAuthenticateSender_embeddedMailsStayUnauthenticated(t *testing.T) {
+	// The headers of an attached message were written by whoever attached it.
+	forged := Mail{Id: "1/1", Headers: []Header{
+		{Name: "Authentication-Results", Value: "mx.example.net; dmarc=pass header.from=bank.example"},
+		{Name: "From", Value: "payments@bank.example"},
+	}}
+	m := Mail{Id: "1", Embedded: []Mail{forged}, Headers: []Header{
+		{Name: "Authentication-Results", Value: "mx.example.net; dmarc=pass header.from=example.com"},
+		{Name: "From", Value: "orders@example.com"},
+	}}
+	AuthenticateSender(&m, config.SenderAuthentication{TrustedAuthServIDs: []string{"mx.example.net"}})
+
+	if !m.Authentication.Pass {
+		t.Errorf("outer verdict = %+v, want pass", m.Authentication)
+	}
+	if m.Innermost().Authentication.Pass {
+		t.Errorf("embedded verdict = %+v, want unauthenticated", m.Innermost().Authentication)
+	}
+}
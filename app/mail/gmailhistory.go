@@ -0,0 +1,274 @@
+package mail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// ErrHistoryExpired is returned when a start history ID is too old for users.history.list;
+// callers must fall back to a full sync.
+var ErrHistoryExpired = errors.New("gmail history ID expired")
+
+// Watch starts (or renews) Gmail push notifications to the Pub/Sub topic for the given labels.
+// It returns the mailbox history ID at the time of the call and the expiration of the watch.
+func (s *GmailService) Watch(ctx context.Context, topic string, labelIDs []string) (uint64, time.Time, error) {
+	svc, err := s.getGmailService(ctx, gmail.GmailModifyScope)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	req := &gmail.WatchRequest{TopicName: topic, LabelIds: labelIDs, LabelFilterBehavior: "include"}
+	resp, err := gmailCall(ctx, s.limiter, gmailUnitsWatch, svc.Users.Watch(s.userID(), req).Context(ctx).Do)
+	if err != nil {
+		return 0, time.Time{}, s.wrapGmailError(err, "watch mailbox", "")
+	}
+	return resp.HistoryId, time.UnixMilli(resp.Expiration).UTC(), nil
+}
+
+// GetMailsAddedSince returns the messages added to the mailbox after startHistoryID together
+// with the history ID to continue from. Messages that are gone by the time they are fetched
+// and messages lacking any of requiredLabels (e.g. "UNREAD") are skipped.
+func (s *GmailService) GetMailsAddedSince(ctx context.Context, startHistoryID uint64, requiredLabels []string) ([]Mail, uint64, error) {
+	svc, err := s.getGmailService(ctx, gmail.GmailModifyScope)
+	if err != nil {
+		return nil, 0, err
+	}
+	ids, latest, err := s.listAddedSince(ctx, svc, startHistoryID)
+	if err != nil {
+		return nil, 0, err
+	}
+	mails, err := s.getMessages(ctx, svc, ids, requiredLabels, gmailFormatFull)
+	if err != nil {
+		return nil, 0, err
+	}
+	return mails, latest, nil
+}
+
+// listAddedSince pages through users.history.list and returns the deduplicated ids of the
+// added messages together with the latest history ID.
+func (s *GmailService) listAddedSince(ctx context.Context, svc *gmail.Service, startHistoryID uint64) ([]string, uint64, error) {
+	var ids []string
+	seen := make(map[string]bool)
+	latest := startHistoryID
+	pageToken := ""
+	for {
+		call := svc.Users.History.List(s.userID()).StartHistoryId(startHistoryID).HistoryTypes("messageAdded").Context(ctx)
+		if pageToken != "" {
+			call = call.PageToken(pageToken)
+		}
+		resp, err := gmailCall(ctx, s.limiter, gmailUnitsHistoryList, call.Do)
+		if err != nil {
+			var gErr *googleapi.Error
+			if errors.As(err, &gErr) && gErr.Code == http.StatusNotFound {
+				return nil, 0, fmt.Errorf("list history since %d: %w", startHistoryID, ErrHistoryExpired)
+			}
+			return nil, 0, s.wrapGmailError(err, "list history", "")
+		}
+		for _, h := range resp.History {
+			for _, added := range h.MessagesAdded {
+				if added.Message != nil && !seen[added.Message.Id] {
+					seen[added.Message.Id] = true
+					ids = append(ids, added.Message.Id)
+				}
+			}
+		}
+		if resp.HistoryId > latest {
+			latest = resp.HistoryId
+		}
+		if resp.NextPageToken == "" {
+			return ids, latest, nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+// getMessages fetches the given messages in format with up to concurrency requests in parallel,
+// skipping those that no longer exist or lack any of requiredLabels. The order of ids is kept.
+func (s *GmailService) getMessages(ctx context.Context, svc *gmail.Service, ids []string, requiredLabels []string, format string) ([]Mail, error) {
+	fetched := make([]*Mail, len(ids))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(s.concurrency, 1))
+	for i, id := range ids {
+		g.Go(func() error {
+			msg, err := gmailCall(gctx, s.limiter, gmailUnitsMessagesGet,
+				svc.Users.Messages.Get(s.userID(), id).Format(format).Context(gctx).Do)
+			if err != nil {
+				var gErr *googleapi.Error
+				if errors.As(err, &gErr) && gErr.Code == http.StatusNotFound {
+					slog.Info("message no longer exists; skipping", "mailId", id)
+					return nil
+				}
+				return s.wrapGmailError(err, "get message", id)
+			}
+			if hasAllLabels(msg.LabelIds, requiredLabels) {
+				m := s.toMail(gctx, svc, msg, format == gmailFormatFull)
+				fetched[i] = &m
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	result := make([]Mail, 0, len(ids))
+	for _, m := range fetched {
+		if m != nil {
+			result = append(result, *m)
+		}
+	}
+	return result, nil
+}
+
+// gmailCheckpoint is the persisted state of the incremental history sync.
+type gmailCheckpoint struct {
+	HistoryID uint64 `json:"historyId,string"`
+	// Retry holds the ids of mails whose delivery failed; they are fetched again on the next sync.
+	Retry []string `json:"retry,omitempty"`
+}
+
+// syncHistory returns the messages added since the checkpointed history ID plus the mails to retry.
+// Without a checkpoint, or when it has expired, all mails matching the query are returned instead.
+// The reached history ID is persisted by CommitCheckpoint.
+func (s *GmailService) syncHistory(ctx context.Context, svc *gmail.Service, format string) ([]Mail, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = nil
+
+	cp, err := s.loadCheckpoint()
+	if err != nil {
+		return nil, err
+	}
+	if cp != nil {
+		ids, latest, err := s.listAddedSince(ctx, svc, cp.HistoryID)
+		switch {
+		case err == nil:
+			mails, err := s.getMessages(ctx, svc, ids, s.history.LabelIDs, format)
+			if err != nil {
+				return nil, err
+			}
+			retries, err := s.getMessages(ctx, svc, excluding(cp.Retry, ids), nil, format)
+			if err != nil {
+				return nil, err
+			}
+			s.pending = &gmailCheckpoint{HistoryID: latest}
+			return append(retries, mails...), nil
+		case errors.Is(err, ErrHistoryExpired):
+			slog.Warn("gmail history checkpoint expired; running a full sync", "path", s.history.CheckpointPath, "historyId", cp.HistoryID)
+		default:
+			return nil, err
+		}
+	} else {
+		slog.Info("no gmail history checkpoint; running a full sync", "path", s.history.CheckpointPath)
+	}
+
+	// Read the history ID before listing so that messages arriving meanwhile are picked up next time.
+	profile, err := gmailCall(ctx, s.limiter, gmailUnitsGetProfile, svc.Users.GetProfile(s.userID()).Context(ctx).Do)
+	if err != nil {
+		return nil, s.wrapGmailError(err, "get profile", "")
+	}
+	// The checkpoint covers every mail up to the profile's history ID, so maxMessages does not
+	// apply here: mails cut off by it would never show up in a later history listing.
+	ids, err := s.listByQuery(ctx, svc, 0)
+	if err != nil {
+		return nil, err
+	}
+	mails, err := s.getMessages(ctx, svc, ids, nil, format)
+	if err != nil {
+		return nil, err
+	}
+	s.pending = &gmailCheckpoint{HistoryID: profile.HistoryId}
+	return mails, nil
+}
+
+// CommitCheckpoint persists the history ID reached by the last sync together with the mails to retry.
+// It does nothing unless history sync is enabled and a sync has completed since the last commit.
+func (s *GmailService) CommitCheckpoint(_ context.Context, retry []Mail) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending == nil {
+		return nil
+	}
+	cp := *s.pending
+	for _, m := range retry {
+		cp.Retry = append(cp.Retry, m.Id)
+	}
+	if err := s.saveCheckpoint(cp); err != nil {
+		return err
+	}
+	s.pending = nil
+	return nil
+}
+
+// loadCheckpoint reads the checkpoint file; it returns nil when the file does not exist yet.
+func (s *GmailService) loadCheckpoint() (*gmailCheckpoint, error) {
+	data, err := os.ReadFile(filepath.Clean(s.history.CheckpointPath)) // #nosec G304 -- path comes from trusted configuration
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gmail history checkpoint %s: %w", s.history.CheckpointPath, err)
+	}
+	var cp gmailCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("failed to parse gmail history checkpoint %s: %w", s.history.CheckpointPath, err)
+	}
+	return &cp, nil
+}
+
+// saveCheckpoint atomically replaces the checkpoint file.
+func (s *GmailService) saveCheckpoint(cp gmailCheckpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp := s.history.CheckpointPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write gmail history checkpoint %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, s.history.CheckpointPath); err != nil {
+		return fmt.Errorf("failed to replace gmail history checkpoint %s: %w", s.history.CheckpointPath, err)
+	}
+	return nil
+}
+
+// excluding returns the ids not contained in other.
+func excluding(ids, other []string) []string {
+	skip := make(map[string]bool, len(other))
+	for _, id := range other {
+		skip[id] = true
+	}
+	var result []string
+	for _, id := range ids {
+		if !skip[id] {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+func hasAllLabels(labels, required []string) bool {
+	for _, r := range required {
+		found := false
+		for _, l := range labels {
+			if l == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,255 @@
+package mail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/option"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
+)
+
+// newFakeGmail starts an httptest stand-in for the Gmail watch, history and messages endpoints.
+func newFakeGmail(t *testing.T, historyStatus int) *GmailService {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /gmail/v1/users/me/watch", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req["topicName"] != "projects/p/topics/gmail" {
+			http.Error(w, "bad watch request", http.StatusBadRequest)
+			return
+		}
+		_, _ = io.WriteString(w, `{"historyId":"100","expiration":"1717243200000"}`)
+	})
+	mux.HandleFunc("GET /gmail/v1/users/me/history", func(w http.ResponseWriter, r *http.Request) {
+		if historyStatus != http.StatusOK {
+			w.WriteHeader(historyStatus)
+			_, _ = io.WriteString(w, `{"error":{"code":404,"message":"Requested entity was not found."}}`)
+			return
+		}
+		if r.URL.Query().Get("startHistoryId") != "100" || r.URL.Query().Get("historyTypes") != "messageAdded" {
+			t.Errorf("history query = %v, want startHistoryId=100 and messageAdded", r.URL.Query())
+		}
+		if r.URL.Query().Get("pageToken") == "" {
+			_, _ = io.WriteString(w, `{"history":[{"messagesAdded":[{"message":{"id":"m1"}},{"message":{"id":"m2"}}]}],"historyId":"104","nextPageToken":"p2"}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"history":[{"messagesAdded":[{"message":{"id":"m1"}},{"message":{"id":"gone"}}]}],"historyId":"105"}`)
+	})
+	mux.HandleFunc("GET /gmail/v1/users/me/profile", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"emailAddress":"me@example.com","historyId":"200"}`)
+	})
+	mux.HandleFunc("GET /gmail/v1/users/me/messages", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"messages":[{"id":"m2"}]}`)
+	})
+	mux.HandleFunc("GET /gmail/v1/users/me/messages/{id}", func(w http.ResponseWriter, r *http.Request) {
+		labels := `["INBOX","UNREAD"]`
+		switch r.PathValue("id") {
+		case "gone":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, `{"error":{"code":404,"message":"Not Found"}}`)
+			return
+		case "m2":
+			labels = `["INBOX"]`
+		}
+		_, _ = io.WriteString(w, `{"id":"`+r.PathValue("id")+`","labelIds":`+labels+`,"internalDate":"1717200000000",
+			"payload":{"headers":[{"name":"From","value":"Vendor <vendor@example.com>"},{"name":"Subject","value":"Invoice"}],
+			"parts":[{"mimeType":"text/plain","body":{"data":"Ym9keQ=="}}]}}`)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return &GmailService{clientOptions: []option.ClientOption{
+		option.WithEndpoint(srv.URL + "/"),
+		option.WithHTTPClient(srv.Client()),
+	}}
+}
+
+func TestGmailService_Watch(t *testing.T) {
+	svc := newFakeGmail(t, http.StatusOK)
+
+	historyID, expiration, err := svc.Watch(context.Background(), "projects/p/topics/gmail", []string{"INBOX"})
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	if historyID != 100 || !expiration.Equal(time.UnixMilli(1717243200000)) {
+		t.Errorf("Watch() = %d, %v; want 100 and the returned expiration", historyID, expiration)
+	}
+}
+
+func TestGmailService_GetMailsAddedSince(t *testing.T) {
+	tests := []struct {
+		name           string
+		requiredLabels []string
+		wantIDs        []string
+	}{
+		{name: "all added messages", wantIDs: []string{"m1", "m2"}},
+		{name: "only unread", requiredLabels: []string{"UNREAD"}, wantIDs: []string{"m1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newFakeGmail(t, http.StatusOK)
+
+			mails, latest, err := svc.GetMailsAddedSince(context.Background(), 100, tt.requiredLabels)
+			if err != nil {
+				t.Fatalf("GetMailsAddedSince() error = %v", err)
+			}
+			if latest != 105 {
+				t.Errorf("latest history ID = %d, want 105 from the last page", latest)
+			}
+			var ids []string
+			for _, m := range mails {
+				ids = append(ids, m.Id)
+			}
+			if len(ids) != len(tt.wantIDs) || (len(ids) > 0 && ids[0] != tt.wantIDs[0]) {
+				t.Errorf("ids = %v, want %v (deduplicated, deleted skipped)", ids, tt.wantIDs)
+			}
+			if mails[0].Body != "body" || mails[0].Sender != "vendor@example.com" {
+				t.Errorf("mails[0] = %+v, want parsed message", mails[0])
+			}
+		})
+	}
+}
+
+func TestGmailService_GetMailsAddedSince_expired(t *testing.T) {
+	svc := newFakeGmail(t, http.StatusNotFound)
+
+	_, _, err := svc.GetMailsAddedSince(context.Background(), 100, nil)
+	if !errors.Is(err, ErrHistoryExpired) {
+		t.Errorf("GetMailsAddedSince() error = %v, want ErrHistoryExpired", err)
+	}
+}
+
+func TestGmailService_historySync(t *testing.T) {
+	tests := []struct {
+		name           string
+		checkpoint     string
+		historyStatus  int
+		wantIDs        []string
+		wantCheckpoint string
+	}{
+		{
+			name:           "initial full sync",
+			historyStatus:  http.StatusOK,
+			wantIDs:        []string{"m2"},
+			wantCheckpoint: `{"historyId":"200","retry":["m2"]}`,
+		},
+		{
+			name:           "added since checkpoint regardless of read state",
+			checkpoint:     `{"historyId":"100","retry":["r1"]}`,
+			historyStatus:  http.StatusOK,
+			wantIDs:        []string{"r1", "m1", "m2"},
+			wantCheckpoint: `{"historyId":"105","retry":["m2"]}`,
+		},
+		{
+			name:           "expired checkpoint falls back to full sync",
+			checkpoint:     `{"historyId":"100"}`,
+			historyStatus:  http.StatusNotFound,
+			wantIDs:        []string{"m2"},
+			wantCheckpoint: `{"historyId":"200","retry":["m2"]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newFakeGmail(t, tt.historyStatus)
+			path := filepath.Join(t.TempDir(), "checkpoint.json")
+			if tt.checkpoint != "" {
+				if err := os.WriteFile(path, []byte(tt.checkpoint), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			svc.history = config.GmailHistory{Enabled: true, CheckpointPath: path, LabelIDs: []string{"INBOX"}}
+
+			mails, err := svc.GetAllUnreadMail(context.Background())
+			if err != nil {
+				t.Fatalf("GetAllUnreadMail() error = %v", err)
+			}
+			var ids []string
+			for _, m := range mails {
+				ids = append(ids, m.Id)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.wantIDs, ",") {
+				t.Errorf("ids = %v, want %v", ids, tt.wantIDs)
+			}
+			if data, err := os.ReadFile(path); tt.checkpoint != "" && (err != nil || string(data) != tt.checkpoint) {
+				t.Errorf("checkpoint changed before commit: %s", data)
+			}
+
+			// m2 failed delivery and must be retried by the next sync.
+			if err := svc.CommitCheckpoint(context.Background(), []Mail{{Id: "m2"}}); err != nil {
+				t.Fatalf("CommitCheckpoint() error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil || string(data) != tt.wantCheckpoint {
+				t.Errorf("checkpoint = %s (%v), want %s", data, err, tt.wantCheckpoint)
+			}
+		})
+	}
+}
+
+func TestGmailService_fullSyncIgnoresMaxMessages(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /gmail/v1/users/me/profile", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"emailAddress":"me@example.com","historyId":"200"}`)
+	})
+	mux.HandleFunc("GET /gmail/v1/users/me/messages", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("pageToken") == "" {
+			_, _ = io.WriteString(w, `{"messages":[{"id":"m1"}],"nextPageToken":"p2"}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"messages":[{"id":"m2"}]}`)
+	})
+	mux.HandleFunc("GET /gmail/v1/users/me/messages/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"id":"`+r.PathValue("id")+`","labelIds":["INBOX","UNREAD"],"payload":{"headers":[]}}`)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		name           string
+		history        bool
+		wantIDs        []string
+		wantCheckpoint string
+	}{
+		{name: "listing is truncated", wantIDs: []string{"m1"}},
+		{name: "full sync lists all pages", history: true, wantIDs: []string{"m1", "m2"}, wantCheckpoint: `{"historyId":"200"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "checkpoint.json")
+			svc := &GmailService{
+				maxMessages: 1,
+				history:     config.GmailHistory{Enabled: tt.history, CheckpointPath: path},
+				clientOptions: []option.ClientOption{
+					option.WithEndpoint(srv.URL + "/"),
+					option.WithHTTPClient(srv.Client()),
+				},
+			}
+			mails, err := svc.GetAllUnreadMail(context.Background())
+			if err != nil {
+				t.Fatalf("GetAllUnreadMail() error = %v", err)
+			}
+			var ids []string
+			for _, m := range mails {
+				ids = append(ids, m.Id)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.wantIDs, ",") {
+				t.Errorf("ids = %v, want %v", ids, tt.wantIDs)
+			}
+			if err := svc.CommitCheckpoint(context.Background(), nil); err != nil {
+				t.Fatalf("CommitCheckpoint() error = %v", err)
+			}
+			if data, _ := os.ReadFile(path); string(data) != tt.wantCheckpoint {
+				t.Errorf("checkpoint = %q, want %q", data, tt.wantCheckpoint)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/api/googleapi"
+)
+
+// Quota units charged per Gmail API method (https://developers.google.com/gmail/api/reference/quota).
+const (
+	gmailUnitsGetProfile     = 1
+	gmailUnitsHistoryList    = 2
+	gmailUnitsMessagesList   = 5
+	gmailUnitsMessagesGet    = 5
+	gmailUnitsAttachmentsGet = 5
+	gmailUnitsModify         = 5
+	gmailUnitsDelete         = 10
+	gmailUnitsWatch          = 100
+)
+
+const (
+	// DefaultGmailConcurrency is the default number of parallel Gmail API requests.
+	DefaultGmailConcurrency = 8
+	// DefaultGmailQuotaUnitsPerSecond is Gmail's per-user quota budget.
+	DefaultGmailQuotaUnitsPerSecond = 250
+
+	// gmailMaxRetries is how often a rate-limited request is retried before giving up.
+	gmailMaxRetries = 5
+	// gmailInitialBackoff is the first wait after a rate-limited request without Retry-After.
+	gmailInitialBackoff = time.Second
+)
+
+// gmailLimiter bounds the number of in-flight Gmail API requests and spends quota units from a
+// token bucket refilled at the configured per-second budget.
+type gmailLimiter struct {
+	sem     chan struct{}
+	bucket  *rate.Limiter
+	backoff time.Duration
+}
+
+func newGmailLimiter(concurrency, unitsPerSecond int) *gmailLimiter {
+	if concurrency <= 0 {
+		concurrency = DefaultGmailConcurrency
+	}
+	if unitsPerSecond <= 0 {
+		unitsPerSecond = DefaultGmailQuotaUnitsPerSecond
+	}
+	return &gmailLimiter{
+		sem:     make(chan struct{}, concurrency),
+		bucket:  rate.NewLimiter(rate.Limit(unitsPerSecond), unitsPerSecond),
+		backoff: gmailInitialBackoff,
+	}
+}
+
+// gmailCall runs one Gmail API request within the limits of l. Rate-limited requests (429 or
+// 403 userRateLimitExceeded) are retried after Retry-After or an exponential backoff.
+// A nil limiter runs the request directly.
+func gmailCall[T any](ctx context.Context, l *gmailLimiter, units int, do func(...googleapi.CallOption) (T, error)) (T, error) {
+	if l == nil {
+		return do()
+	}
+	if units > l.bucket.Burst() {
+		units = l.bucket.Burst()
+	}
+	backoff := l.backoff
+	for attempt := 0; ; attempt++ {
+		var zero T
+		if err := l.bucket.WaitN(ctx, units); err != nil {
+			return zero, err
+		}
+		select {
+		case l.sem <- struct{}{}:
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		}
+		resp, err := do()
+		<-l.sem
+
+		wait, limited := gmailRetryAfter(err)
+		if !limited || attempt >= gmailMaxRetries {
+			return resp, err
+		}
+		if wait <= 0 {
+			wait = backoff
+			backoff *= 2
+		}
+		slog.Warn("gmail rate limit exceeded; backing off", "wait", wait, "attempt", attempt+1)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return zero, ctx.Err()
+		}
+	}
+}
+
+// gmailRetryAfter reports whether err is a rate limit error and how long the server asked to wait.
+func gmailRetryAfter(err error) (time.Duration, bool) {
+	var gErr *googleapi.Error
+	if !errors.As(err, &gErr) {
+		return 0, false
+	}
+	limited := gErr.Code == http.StatusTooManyRequests
+	if gErr.Code == http.StatusForbidden {
+		for _, item := range gErr.Errors {
+			if item.Reason == "userRateLimitExceeded" || item.Reason == "rateLimitExceeded" {
+				limited = true
+			}
+		}
+	}
+	if !limited {
+		return 0, false
+	}
+	v := gErr.Header.Get("Retry-After")
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t), true
+	}
+	return 0, true
+}
@@ -0,0 +1,93 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+func TestGmailRetryAfter(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantWait    time.Duration
+		wantLimited bool
+	}{
+		{name: "not an API error", err: errors.New("boom")},
+		{name: "not found", err: &googleapi.Error{Code: http.StatusNotFound}},
+		{
+			name:        "429 with Retry-After seconds",
+			err:         &googleapi.Error{Code: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"7"}}},
+			wantWait:    7 * time.Second,
+			wantLimited: true,
+		},
+		{
+			name:        "403 userRateLimitExceeded without Retry-After",
+			err:         &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "userRateLimitExceeded"}}},
+			wantLimited: true,
+		},
+		{
+			name: "403 insufficient permissions",
+			err:  &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "insufficientPermissions"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wait, limited := gmailRetryAfter(tt.err)
+			if wait != tt.wantWait || limited != tt.wantLimited {
+				t.Errorf("gmailRetryAfter() = %v, %v; want %v, %v", wait, limited, tt.wantWait, tt.wantLimited)
+			}
+		})
+	}
+}
+
+func TestGmailCall_retriesRateLimitedRequests(t *testing.T) {
+	l := newGmailLimiter(2, 100)
+	l.backoff = time.Millisecond
+	calls := 0
+
+	got, err := gmailCall(context.Background(), l, gmailUnitsMessagesGet, func(...googleapi.CallOption) (string, error) {
+		calls++
+		if calls < 3 {
+			return "", &googleapi.Error{Code: http.StatusTooManyRequests}
+		}
+		return "ok", nil
+	})
+	if err != nil || got != "ok" || calls != 3 {
+		t.Errorf("gmailCall() = %q, %v after %d calls; want ok after 3", got, err, calls)
+	}
+}
+
+func TestGmailCall_boundsConcurrency(t *testing.T) {
+	l := newGmailLimiter(2, 1000)
+	var inFlight, maxInFlight atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = gmailCall(context.Background(), l, gmailUnitsMessagesGet, func(...googleapi.CallOption) (int, error) {
+				n := inFlight.Add(1)
+				for {
+					m := maxInFlight.Load()
+					if n <= m || maxInFlight.CompareAndSwap(m, n) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				inFlight.Add(-1)
+				return 0, nil
+			})
+		}()
+	}
+	wg.Wait()
+	if maxInFlight.Load() > 2 {
+		t.Errorf("max in-flight requests = %d, want at most 2", maxInFlight.Load())
+	}
+}
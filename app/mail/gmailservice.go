@@ -6,11 +6,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
+	"io/fs"
 	"log/slog"
-	gomail "net/mail"
+	"mime"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/oauth2"
@@ -18,51 +21,238 @@ import (
 	"google.golang.org/api/gmail/v1"
 	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
+	"github.com/jo-hoe/go-mail-webhook-service/app/mail/message"
 )
 
 const (
 	CredentialsFileName = "client_secret.json"
 	TokenFileName       = "request.token"
+
+	// DefaultGmailQuery selects the mails processed when no query is configured.
+	DefaultGmailQuery = "is:unread"
+
+	// maxGmailPageSize is the largest page size accepted by users.messages.list.
+	maxGmailPageSize = 500
+
+	gmailFormatFull     = "full"
+	gmailFormatMetadata = "metadata"
+	gmailFormatRaw      = "raw"
 )
 
 // GmailService implements MailClientService using the Gmail API.
 type GmailService struct {
 	credentialsPath string
+	// serviceAccountKeyFile and subject select service-account auth impersonating subject.
+	serviceAccountKeyFile string
+	subject               string
+	// query is the Gmail search query; empty uses DefaultGmailQuery.
+	query            string
+	includeSpamTrash bool
+	// maxMessages caps the mails listed per run across all pages; 0 means no cap.
+	maxMessages int
+	// concurrency bounds the messages fetched in parallel; limiter bounds requests and quota.
+	concurrency int
+	limiter     *gmailLimiter
+	// tokenStore selects where the user OAuth token is loaded from and refreshed tokens are saved.
+	tokenStore config.GmailTokenStore
+	// history enables incremental sync from a checkpointed history ID.
+	history config.GmailHistory
+	// clientOptions replaces the credential files when set (e.g. a test endpoint).
+	clientOptions []option.ClientOption
+
+	// mu guards pending, the checkpoint reached by the last history sync until it is committed.
+	mu      sync.Mutex
+	pending *gmailCheckpoint
+
+	// serviceMu guards services, the API clients created on first use per OAuth scope. They share
+	// one token source, so the token is loaded and refreshed once rather than per call.
+	serviceMu sync.Mutex
+	services  map[string]*gmail.Service
+}
+
+// NewGmailService creates a GmailService from the Gmail client configuration. Credentials are
+// read from cfg.CredentialsPath (default DefaultCredentialsPath) and the mails matching the
+// query built by GmailSearchQuery are listed.
+func NewGmailService(cfg config.GmailClient) *GmailService {
+	path := cfg.CredentialsPath
+	if path == "" {
+		path = DefaultCredentialsPath
+	}
+	svc := &GmailService{
+		credentialsPath:  path,
+		query:            GmailSearchQuery(cfg),
+		includeSpamTrash: cfg.IncludeSpamTrash,
+		maxMessages:      cfg.MaxMessages,
+		history:          cfg.History,
+		tokenStore:       cfg.TokenStore,
+		concurrency:      cfg.Concurrency,
+		limiter:          newGmailLimiter(cfg.Concurrency, cfg.QuotaUnitsPerSecond),
+	}
+	if cfg.ServiceAccount.Enabled {
+		svc.serviceAccountKeyFile = cfg.ServiceAccount.KeyFile
+		if svc.serviceAccountKeyFile == "" {
+			svc.serviceAccountKeyFile = filepath.Join(path, ServiceAccountKeyFileName)
+		}
+		svc.subject = cfg.ServiceAccount.Subject
+	}
+	return svc
 }
 
-// NewGmailService creates a GmailService that reads credentials from credentialsPath.
-func NewGmailService(credentialsPath string) *GmailService {
-	return &GmailService{credentialsPath: credentialsPath}
+// userID is the mailbox addressed by API calls: the impersonated subject or the token owner ("me").
+func (s *GmailService) userID() string {
+	if s.subject != "" {
+		return s.subject
+	}
+	return "me"
+}
+
+// GmailSearchQuery combines the configured query with the label:, newer_than: and in: clauses.
+func GmailSearchQuery(cfg config.GmailClient) string {
+	var parts []string
+	if q := strings.TrimSpace(cfg.Query); q != "" {
+		parts = append(parts, q)
+	}
+	for _, l := range cfg.Labels {
+		// Gmail search expects spaces in label names to be written as dashes.
+		parts = append(parts, "label:"+strings.ReplaceAll(strings.TrimSpace(l), " ", "-"))
+	}
+	if cfg.NewerThan != "" {
+		parts = append(parts, "newer_than:"+cfg.NewerThan)
+	}
+	if cfg.In != "" {
+		parts = append(parts, "in:"+cfg.In)
+	}
+	return strings.Join(parts, " ")
 }
 
 func (s *GmailService) GetAllUnreadMail(ctx context.Context) ([]Mail, error) {
+	return s.fetchMails(ctx, gmailFormatFull)
+}
+
+// GetAllUnreadMailMetadata lists the same mails as GetAllUnreadMail using format=metadata,
+// i.e. with headers only and without body or attachments.
+func (s *GmailService) GetAllUnreadMailMetadata(ctx context.Context) ([]Mail, error) {
+	return s.fetchMails(ctx, gmailFormatMetadata)
+}
+
+// LoadMailContent downloads the body of a mail listed by GetAllUnreadMailMetadata and, when
+// withAttachments is set, its attachments.
+func (s *GmailService) LoadMailContent(ctx context.Context, m Mail, withAttachments bool) (Mail, error) {
 	svc, err := s.getGmailService(ctx, gmail.GmailModifyScope)
 	if err != nil {
-		return nil, err
+		return Mail{}, err
 	}
+	full, err := gmailCall(ctx, s.limiter, gmailUnitsMessagesGet,
+		svc.Users.Messages.Get(s.userID(), m.Id).Format(gmailFormatFull).Context(ctx).Do)
+	if err != nil {
+		return Mail{}, s.wrapGmailError(err, "get message", m.Id)
+	}
+	return s.toMail(ctx, svc, full, withAttachments), nil
+}
 
-	resp, err := svc.Users.Messages.List("me").Q("is:unread").Do()
+func (s *GmailService) fetchMails(ctx context.Context, format string) ([]Mail, error) {
+	svc, err := s.getGmailService(ctx, gmail.GmailModifyScope)
+	if err != nil {
+		return nil, err
+	}
+	if s.history.Enabled {
+		return s.syncHistory(ctx, svc, format)
+	}
+	ids, err := s.listByQuery(ctx, svc, s.maxMessages)
 	if err != nil {
-		return nil, s.wrapGmailError(err, "list unread messages", "")
+		return nil, err
+	}
+	return s.getMessages(ctx, svc, ids, nil, format)
+}
+
+// listByQuery returns the ids of the messages matching the configured search query, following
+// all result pages up to limit mails; 0 means no limit.
+func (s *GmailService) listByQuery(ctx context.Context, svc *gmail.Service, limit int) ([]string, error) {
+	query := s.query
+	if query == "" {
+		query = DefaultGmailQuery
 	}
 
-	result := make([]Mail, 0, len(resp.Messages))
-	for _, msg := range resp.Messages {
-		full, err := svc.Users.Messages.Get("me", msg.Id).Format("full").Do()
+	var ids []string
+	pageToken := ""
+	for {
+		call := svc.Users.Messages.List(s.userID()).Q(query).IncludeSpamTrash(s.includeSpamTrash).Context(ctx)
+		if remaining := limit - len(ids); limit > 0 && remaining < maxGmailPageSize {
+			call = call.MaxResults(int64(remaining))
+		} else {
+			call = call.MaxResults(maxGmailPageSize)
+		}
+		if pageToken != "" {
+			call = call.PageToken(pageToken)
+		}
+		resp, err := gmailCall(ctx, s.limiter, gmailUnitsMessagesList, call.Do)
 		if err != nil {
-			return nil, err
+			return nil, s.wrapGmailError(err, "list unread messages", "")
 		}
-		result = append(result, Mail{
-			Id:          msg.Id,
-			Sender:      extractSender(full.Payload.Headers),
-			Recipients:  extractRecipients(full.Payload.Headers),
-			Subject:     extractSubject(full.Payload.Headers),
-			Body:        extractPlainTextBody(full.Payload.Parts),
-			Attachments: extractAttachments(svc, "me", msg.Id, full.Payload.Parts),
-			ReceivedAt:  extractReceivedAt(full.InternalDate),
-		})
-	}
-	return result, nil
+		for _, msg := range resp.Messages {
+			ids = append(ids, msg.Id)
+		}
+		if resp.NextPageToken == "" {
+			return ids, nil
+		}
+		if limit > 0 && len(ids) >= limit {
+			slog.Warn("gmail listing reached maxMessages; remaining mails are processed in later runs",
+				"maxMessages", limit, "query", query)
+			return ids, nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+// toMail converts a fetched message. Body and attachments are only present for format=full;
+// attachments are downloaded when withAttachments is set.
+func (s *GmailService) toMail(ctx context.Context, svc *gmail.Service, msg *gmail.Message, withAttachments bool) Mail {
+	m := Mail{
+		Id:         msg.Id,
+		Sender:     extractSender(msg.Payload.Headers),
+		Recipients: extractRecipients(msg.Payload.Headers),
+		Subject:    extractSubject(msg.Payload.Headers),
+		Body:       extractBodyPart(msg.Payload.Parts, "text/plain"),
+		HTMLBody:   extractBodyPart(msg.Payload.Parts, "text/html"),
+		ReceivedAt: extractReceivedAt(msg.InternalDate),
+
+		ThreadID:     msg.ThreadId,
+		LabelIDs:     msg.LabelIds,
+		Snippet:      html.UnescapeString(msg.Snippet),
+		SizeEstimate: msg.SizeEstimate,
+	}
+	headers := make([]Header, 0, len(msg.Payload.Headers))
+	for _, h := range msg.Payload.Headers {
+		headers = append(headers, Header{Name: h.Name, Value: h.Value})
+	}
+	message.ApplyHeaders(&m, headers)
+	message.ApplyHTMLFallback(&m)
+	if withAttachments {
+		m.Attachments = s.extractAttachments(ctx, svc, msg.Id, msg.Payload.Parts)
+		message.ExpandTNEFAttachments(&m)
+		message.EmbedAttachedMails(&m)
+	}
+	return m
+}
+
+// GetRawMail downloads the RFC 822 source of m using format=raw.
+func (s *GmailService) GetRawMail(ctx context.Context, m Mail) ([]byte, error) {
+	svc, err := s.getGmailService(ctx, gmail.GmailModifyScope)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := gmailCall(ctx, s.limiter, gmailUnitsMessagesGet,
+		svc.Users.Messages.Get(s.userID(), m.Id).Format(gmailFormatRaw).Context(ctx).Do)
+	if err != nil {
+		return nil, s.wrapGmailError(err, "get raw message", m.Id)
+	}
+	raw, err := base64.URLEncoding.DecodeString(msg.Raw)
+	if err != nil {
+		return nil, fmt.Errorf("decode raw message (mail %s): %w", m.Id, err)
+	}
+	return raw, nil
 }
 
 func (s *GmailService) MarkMailAsRead(ctx context.Context, mail Mail) error {
@@ -71,7 +261,7 @@ func (s *GmailService) MarkMailAsRead(ctx context.Context, mail Mail) error {
 		return err
 	}
 	req := &gmail.ModifyMessageRequest{RemoveLabelIds: []string{"UNREAD"}}
-	_, err = svc.Users.Messages.Modify("me", mail.Id, req).Do()
+	_, err = gmailCall(ctx, s.limiter, gmailUnitsModify, svc.Users.Messages.Modify(s.userID(), mail.Id, req).Context(ctx).Do)
 	if err != nil {
 		return s.wrapGmailError(err, "mark message as read", mail.Id)
 	}
@@ -83,7 +273,10 @@ func (s *GmailService) DeleteMail(ctx context.Context, mail Mail) error {
 	if err != nil {
 		return err
 	}
-	if err := svc.Users.Messages.Delete("me", mail.Id).Do(); err != nil {
+	deleteCall := svc.Users.Messages.Delete(s.userID(), mail.Id).Context(ctx)
+	if _, err := gmailCall(ctx, s.limiter, gmailUnitsDelete, func(opts ...googleapi.CallOption) (struct{}, error) {
+		return struct{}{}, deleteCall.Do(opts...)
+	}); err != nil {
 		return s.wrapGmailError(err, "delete message", mail.Id)
 	}
 	return nil
@@ -97,6 +290,10 @@ func (s *GmailService) wrapGmailError(err error, action, mailID string) error {
 		ctx = fmt.Sprintf("%s (mail %s)", action, mailID)
 	}
 	var gErr *googleapi.Error
+	if errors.As(err, &gErr) && (gErr.Code == 401 || gErr.Code == 403) && s.serviceAccountKeyFile != "" {
+		return fmt.Errorf("%s: gmail API returned %d — service account key at %s may be invalid or lack domain-wide delegation of the gmail.modify scope for %s: %w",
+			ctx, gErr.Code, s.serviceAccountKeyFile, s.subject, err)
+	}
 	if errors.As(err, &gErr) && (gErr.Code == 401 || gErr.Code == 403) {
 		return fmt.Errorf("%s: gmail API returned %d — OAuth token at %s may be invalid or revoked; regenerate using cli/gmail: %w",
 			ctx, gErr.Code, tokenPath, err)
@@ -109,73 +306,35 @@ func extractSubject(headers []*gmail.MessagePartHeader) string {
 }
 
 func extractSender(headers []*gmail.MessagePartHeader) string {
-	raw := findHeader(headers, "From")
-	if addr, err := gomail.ParseAddress(raw); err == nil && addr != nil {
-		return addr.Address
-	}
-	return raw
+	return message.SenderAddress(findHeader(headers, "From"))
 }
 
 // extractRecipients collects unique recipient addresses from Delivered-To, To, and Cc headers.
-// Bcc is intentionally excluded as it is typically not visible to recipients.
 func extractRecipients(headers []*gmail.MessagePartHeader) []string {
-	seen := make(map[string]bool)
-	var recipients []string
-
-	addAddress := func(raw string) {
-		if addr, err := gomail.ParseAddress(raw); err == nil && addr != nil && addr.Address != "" {
-			if !seen[addr.Address] {
-				seen[addr.Address] = true
-				recipients = append(recipients, addr.Address)
-			}
-			return
-		}
-		v := strings.TrimSpace(raw)
-		if v != "" && !seen[v] {
-			seen[v] = true
-			recipients = append(recipients, v)
-		}
-	}
-
-	addAddressList := func(raw string) {
-		if list, err := gomail.ParseAddressList(raw); err == nil {
-			for _, a := range list {
-				if a != nil && a.Address != "" && !seen[a.Address] {
-					seen[a.Address] = true
-					recipients = append(recipients, a.Address)
-				}
-			}
-			return
-		}
-		// Fallback: comma-separated raw strings.
-		for _, p := range strings.Split(raw, ",") {
-			addAddress(p)
-		}
-	}
-
+	converted := make([]Header, 0, len(headers))
 	for _, h := range headers {
-		switch h.Name {
-		case "Delivered-To":
-			addAddress(h.Value)
-		case "To", "Cc":
-			addAddressList(h.Value)
-		}
+		converted = append(converted, Header{Name: h.Name, Value: h.Value})
 	}
-	return recipients
+	return message.RecipientAddresses(converted)
 }
 
-func extractPlainTextBody(parts []*gmail.MessagePart) string {
+// extractBodyPart returns the decoded content of the first non-attachment part of mimeType.
+func extractBodyPart(parts []*gmail.MessagePart, mimeType string) string {
 	for _, part := range parts {
-		if part.MimeType == "text/plain" {
+		if part.MimeType == mimeType && part.Filename == "" && part.Body != nil {
 			data, err := base64.URLEncoding.DecodeString(part.Body.Data)
 			if err != nil {
 				slog.Error("error decoding body data", "error", err)
 				continue
 			}
-			return string(data)
+			var label string
+			if _, params, err := mime.ParseMediaType(findHeader(part.Headers, "Content-Type")); err == nil {
+				label = params["charset"]
+			}
+			return message.DecodeText(data, mimeType, label)
 		}
 		if len(part.Parts) > 0 {
-			if body := extractPlainTextBody(part.Parts); body != "" {
+			if body := extractBodyPart(part.Parts, mimeType); body != "" {
 				return body
 			}
 		}
@@ -183,30 +342,77 @@ func extractPlainTextBody(parts []*gmail.MessagePart) string {
 	return ""
 }
 
-// extractAttachments walks message parts recursively and collects file attachments.
-func extractAttachments(svc *gmail.Service, user, msgID string, parts []*gmail.MessagePart) []Attachment {
-	var result []Attachment
-	for _, part := range parts {
-		if part.Filename != "" && part.Body != nil && part.Body.AttachmentId != "" {
-			att, err := svc.Users.Messages.Attachments.Get(user, msgID, part.Body.AttachmentId).Do()
+// extractAttachments walks message parts recursively and downloads the file attachments in parallel.
+func (s *GmailService) extractAttachments(ctx context.Context, svc *gmail.Service, msgID string, parts []*gmail.MessagePart) []Attachment {
+	var files []*gmail.MessagePart
+	var walk func(parts []*gmail.MessagePart)
+	walk = func(parts []*gmail.MessagePart) {
+		for _, part := range parts {
+			if part.Filename != "" && part.Body != nil && part.Body.AttachmentId != "" {
+				files = append(files, part)
+				// A forwarded message is parsed as a whole, including its own attachments.
+				if message.IsMessageType(part.MimeType) {
+					continue
+				}
+			}
+			walk(part.Parts)
+		}
+	}
+	walk(parts)
+
+	downloaded := make([]*Attachment, len(files))
+	var wg sync.WaitGroup
+	for i, part := range files {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			att, err := gmailCall(ctx, s.limiter, gmailUnitsAttachmentsGet,
+				svc.Users.Messages.Attachments.Get(s.userID(), msgID, part.Body.AttachmentId).Context(ctx).Do)
 			if err != nil {
 				slog.Error("error retrieving attachment", "filename", part.Filename, "error", err)
-				continue
+				return
 			}
 			data, err := base64.URLEncoding.DecodeString(att.Data)
 			if err != nil {
 				slog.Error("error decoding attachment", "filename", part.Filename, "error", err)
-				continue
+				return
 			}
-			result = append(result, Attachment{Name: part.Filename, Content: data})
-		}
-		if len(part.Parts) > 0 {
-			result = append(result, extractAttachments(svc, user, msgID, part.Parts)...)
+			a := message.AttachmentFromPart(gmailPartFilename(part), data, gmailPartHeader(part.Headers))
+			downloaded[i] = &a
+		}()
+	}
+	wg.Wait()
+
+	var result []Attachment
+	for _, a := range downloaded {
+		if a != nil {
+			result = append(result, *a)
 		}
 	}
 	return result
 }
 
+// gmailPartHeader adapts the headers of a Gmail message part to message.PartHeader.
+type gmailPartHeader []*gmail.MessagePartHeader
+
+func (h gmailPartHeader) Get(key string) string {
+	for _, v := range h {
+		if strings.EqualFold(v.Name, key) {
+			return v.Value
+		}
+	}
+	return ""
+}
+
+// gmailPartFilename decodes the filename from the part headers like for raw messages,
+// falling back to the filename reported by Gmail.
+func gmailPartFilename(part *gmail.MessagePart) string {
+	if name := message.PartFilename(gmailPartHeader(part.Headers)); name != "" {
+		return name
+	}
+	return message.DecodeHeaderValue(part.Filename)
+}
+
 // findHeader returns the value of the first header matching name, or "" if absent.
 func findHeader(headers []*gmail.MessagePartHeader, name string) string {
 	for _, h := range headers {
@@ -222,16 +428,47 @@ func extractReceivedAt(internalDateMs int64) time.Time {
 	return time.UnixMilli(internalDateMs).UTC()
 }
 
+// getGmailService returns the API client for scope, creating it on first use.
 func (s *GmailService) getGmailService(ctx context.Context, scope ...string) (*gmail.Service, error) {
-	cfg, err := GetGmailConfig(s.credentialsPath, scope...)
-	if err != nil {
-		return nil, err
+	key := strings.Join(scope, " ")
+	s.serviceMu.Lock()
+	defer s.serviceMu.Unlock()
+	if svc, ok := s.services[key]; ok {
+		return svc, nil
 	}
-	ts, err := s.getTokenSource(ctx, cfg)
+	svc, err := s.newGmailService(ctx, scope...)
 	if err != nil {
 		return nil, err
 	}
-	return gmail.NewService(ctx, option.WithTokenSource(ts))
+	if s.services == nil {
+		s.services = make(map[string]*gmail.Service)
+	}
+	s.services[key] = svc
+	return svc, nil
+}
+
+func (s *GmailService) newGmailService(ctx context.Context, scope ...string) (*gmail.Service, error) {
+	// The service is cached, so neither it nor its token source may be bound to the call's cancellation.
+	ctx = context.WithoutCancel(ctx)
+	if s.clientOptions != nil {
+		return gmail.NewService(ctx, s.clientOptions...)
+	}
+	var ts oauth2.TokenSource
+	if s.serviceAccountKeyFile != "" {
+		var err error
+		if ts, err = serviceAccountTokenSource(ctx, s.serviceAccountKeyFile, s.subject, scope...); err != nil {
+			return nil, err
+		}
+	} else {
+		cfg, err := GetGmailConfig(s.credentialsPath, scope...)
+		if err != nil {
+			return nil, err
+		}
+		if ts, err = s.getTokenSource(ctx, cfg); err != nil {
+			return nil, err
+		}
+	}
+	return gmail.NewService(ctx, option.WithTokenSource(oauth2.ReuseTokenSource(nil, ts)))
 }
 
 // GetGmailConfig reads the OAuth client configuration from the credentials directory.
@@ -259,10 +496,15 @@ func tokenFromFile(path string) (*oauth2.Token, error) {
 	return token, json.NewDecoder(f).Decode(token)
 }
 
-// tokenSavingSource wraps a TokenSource and persists refreshed tokens to disk.
+// tokenSavingSource wraps a TokenSource and persists refreshed tokens to the token store.
 type tokenSavingSource struct {
 	oauth2.TokenSource
-	path string
+	ctx   context.Context
+	store TokenStore
+
+	mu sync.Mutex
+	// last is the access token persisted (or loaded) most recently.
+	last string
 }
 
 func (s *tokenSavingSource) Token() (*oauth2.Token, error) {
@@ -270,34 +512,34 @@ func (s *tokenSavingSource) Token() (*oauth2.Token, error) {
 	if err != nil {
 		return nil, err
 	}
-	f, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
-	if err != nil {
-		if strings.Contains(strings.ToLower(err.Error()), "read-only file system") || os.IsPermission(err) {
-			slog.Warn("token not persisted (read-only or permission denied)", "path", s.path, "error", err)
-		} else {
-			slog.Error("failed to open token file for writing", "path", s.path, "error", err)
-		}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t.AccessToken == s.last {
 		return t, nil
 	}
-	defer func() {
-		if cerr := f.Close(); cerr != nil {
-			slog.Error("error closing token file", "error", cerr)
+	if err := s.store.Save(s.ctx, t); err != nil {
+		if errors.Is(err, fs.ErrPermission) || strings.Contains(strings.ToLower(err.Error()), "read-only file system") {
+			slog.Warn("token not persisted (read-only or permission denied)", "store", s.store.String(), "error", err)
+		} else {
+			slog.Error("failed to persist refreshed token", "store", s.store.String(), "error", err)
 		}
-	}()
-	if err := json.NewEncoder(f).Encode(t); err != nil {
-		slog.Error("failed to encode token", "path", s.path, "error", err)
+		return t, nil
 	}
+	s.last = t.AccessToken
 	return t, nil
 }
 
 func (s *GmailService) getTokenSource(ctx context.Context, cfg *oauth2.Config) (oauth2.TokenSource, error) {
-	tokenPath := filepath.Join(s.credentialsPath, TokenFileName)
-	token, err := tokenFromFile(tokenPath)
+	store, err := NewTokenStore(s.tokenStore, filepath.Join(s.credentialsPath, TokenFileName))
 	if err != nil {
-		return nil, fmt.Errorf("failed to read OAuth token from %s: %w; regenerate using cli/gmail", tokenPath, err)
+		return nil, err
+	}
+	token, err := store.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OAuth token from %s: %w; regenerate using cli/gmail", store, err)
 	}
 	if token.Expiry.Before(time.Now().Add(-time.Minute)) && token.RefreshToken == "" {
-		return nil, fmt.Errorf("OAuth token at %s is expired with no refresh_token; re-authorize using cli/gmail", tokenPath)
+		return nil, fmt.Errorf("OAuth token at %s is expired with no refresh_token; re-authorize using cli/gmail", store)
 	}
-	return &tokenSavingSource{TokenSource: cfg.TokenSource(ctx, token), path: tokenPath}, nil
-}
\ No newline at end of file
+	return &tokenSavingSource{TokenSource: cfg.TokenSource(ctx, token), ctx: ctx, store: store, last: token.AccessToken}, nil
+}
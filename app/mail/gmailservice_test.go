@@ -1,10 +1,19 @@
 package mail
 
 import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/option"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
 )
 
 func Test_extractReceivedAt(t *testing.T) {
@@ -137,3 +146,202 @@ func Test_extractRecipients(t *testing.T) {
 		})
 	}
 }
+
+func Test_extractBodyPart(t *testing.T) {
+	parts := []*gmail.MessagePart{{
+		MimeType: "multipart/alternative",
+		Parts: []*gmail.MessagePart{
+			{
+				MimeType: "text/plain",
+				Headers:  []*gmail.MessagePartHeader{{Name: "Content-Type", Value: "text/plain; charset=iso-8859-1"}},
+				Body:     &gmail.MessagePartBody{Data: base64.URLEncoding.EncodeToString([]byte("Gr\xfc\xdfe"))},
+			},
+			{
+				MimeType: "text/html",
+				Headers:  []*gmail.MessagePartHeader{{Name: "Content-Type", Value: "text/html; charset=utf-8"}},
+				Body:     &gmail.MessagePartBody{Data: base64.URLEncoding.EncodeToString([]byte("<p>Grüße</p>"))},
+			},
+		},
+	}}
+	if got := extractBodyPart(parts, "text/plain"); got != "Grüße" {
+		t.Errorf("extractBodyPart(text/plain) = %q, want the body decoded from ISO-8859-1", got)
+	}
+	if got := extractBodyPart(parts, "text/html"); got != "<p>Grüße</p>" {
+		t.Errorf("extractBodyPart(text/html) = %q, want <p>Grüße</p>", got)
+	}
+}
+
+func TestGmailSearchQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.GmailClient
+		want string
+	}{
+		{name: "empty", want: ""},
+		{name: "query only", cfg: config.GmailClient{Query: "is:unread"}, want: "is:unread"},
+		{
+			name: "all clauses",
+			cfg:  config.GmailClient{Query: "is:unread", Labels: []string{"Invoices", "Vendor Bills"}, NewerThan: "7d", In: "anywhere"},
+			want: "is:unread label:Invoices label:Vendor-Bills newer_than:7d in:anywhere",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GmailSearchQuery(tt.cfg); got != tt.want {
+				t.Errorf("GmailSearchQuery() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGmailService_GetAllUnreadMail_pagination(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxMessages int
+		wantIDs     []string
+	}{
+		{name: "follows all pages", wantIDs: []string{"a", "b", "c"}},
+		{name: "stops at the cap", maxMessages: 2, wantIDs: []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /gmail/v1/users/me/messages", func(w http.ResponseWriter, r *http.Request) {
+				q := r.URL.Query()
+				if q.Get("q") != "is:unread label:Invoices" || q.Get("includeSpamTrash") != "true" {
+					t.Errorf("list query = %v, want configured query and includeSpamTrash", q)
+				}
+				switch q.Get("pageToken") {
+				case "":
+					_, _ = io.WriteString(w, `{"messages":[{"id":"a"},{"id":"b"}],"nextPageToken":"p2"}`)
+				case "p2":
+					_, _ = io.WriteString(w, `{"messages":[{"id":"c"}]}`)
+				}
+			})
+			mux.HandleFunc("GET /gmail/v1/users/me/messages/{id}", func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.WriteString(w, `{"id":"`+r.PathValue("id")+`","payload":{"headers":[]}}`)
+			})
+			srv := httptest.NewServer(mux)
+			t.Cleanup(srv.Close)
+
+			svc := NewGmailService(config.GmailClient{Query: "is:unread", Labels: []string{"Invoices"}, IncludeSpamTrash: true, MaxMessages: tt.maxMessages})
+			svc.clientOptions = []option.ClientOption{option.WithEndpoint(srv.URL + "/"), option.WithHTTPClient(srv.Client())}
+
+			mails, err := svc.GetAllUnreadMail(context.Background())
+			if err != nil {
+				t.Fatalf("GetAllUnreadMail() error = %v", err)
+			}
+			var ids []string
+			for _, m := range mails {
+				ids = append(ids, m.Id)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.wantIDs, ",") {
+				t.Errorf("ids = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestGmailService_twoPhaseFetch(t *testing.T) {
+	var formats []string
+	attachmentDownloads := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /gmail/v1/users/me/messages", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"messages":[{"id":"m1"}]}`)
+	})
+	mux.HandleFunc("GET /gmail/v1/users/me/messages/{id}", func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("format")
+		formats = append(formats, format)
+		if format == "metadata" {
+			_, _ = io.WriteString(w, `{"id":"m1","payload":{"headers":[{"name":"Subject","value":"Invoice"}]}}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"id":"m1","payload":{"headers":[{"name":"Subject","value":"Invoice"}],"parts":[
+			{"mimeType":"text/plain","body":{"data":"Ym9keQ=="}},
+			{"filename":"invoice.pdf","body":{"attachmentId":"a1"}}]}}`)
+	})
+	mux.HandleFunc("GET /gmail/v1/users/me/messages/m1/attachments/a1", func(w http.ResponseWriter, r *http.Request) {
+		attachmentDownloads++
+		_, _ = io.WriteString(w, `{"data":"JVBERg=="}`)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	svc := &GmailService{clientOptions: []option.ClientOption{option.WithEndpoint(srv.URL + "/"), option.WithHTTPClient(srv.Client())}}
+
+	mails, err := svc.GetAllUnreadMailMetadata(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllUnreadMailMetadata() error = %v", err)
+	}
+	if len(mails) != 1 || mails[0].Subject != "Invoice" || mails[0].Body != "" {
+		t.Fatalf("mails = %+v, want headers only", mails)
+	}
+
+	m, err := svc.LoadMailContent(context.Background(), mails[0], false)
+	if err != nil || m.Body != "body" || len(m.Attachments) != 0 || attachmentDownloads != 0 {
+		t.Errorf("LoadMailContent(without attachments) = %+v, %v; downloads %d", m, err, attachmentDownloads)
+	}
+	m, err = svc.LoadMailContent(context.Background(), mails[0], true)
+	if err != nil || len(m.Attachments) != 1 || string(m.Attachments[0].Content) != "%PDF" {
+		t.Errorf("LoadMailContent(with attachments) = %+v, %v", m, err)
+	}
+	if strings.Join(formats, ",") != "metadata,full,full" {
+		t.Errorf("requested formats = %v, want metadata first", formats)
+	}
+}
+
+func TestGmailService_messageMetadata(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /gmail/v1/users/me/messages", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"messages":[{"id":"a"}]}`)
+	})
+	mux.HandleFunc("GET /gmail/v1/users/me/messages/a", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"id":"a","threadId":"t1","labelIds":["INBOX","UNREAD"],
+			"snippet":"Your order &amp; invoice","sizeEstimate":2048,"payload":{"headers":[
+			{"name":"From","value":"Shop Team <shop@example.com>"},
+			{"name":"Message-ID","value":"<reply-2@example.com>"},
+			{"name":"In-Reply-To","value":"<order-1@example.com>"},
+			{"name":"References","value":"<order-1@example.com>"}]}}`)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	svc := NewGmailService(config.GmailClient{Query: "is:unread"})
+	svc.clientOptions = []option.ClientOption{option.WithEndpoint(srv.URL + "/"), option.WithHTTPClient(srv.Client())}
+
+	mails, err := svc.GetAllUnreadMailMetadata(context.Background())
+	if err != nil || len(mails) != 1 {
+		t.Fatalf("GetAllUnreadMailMetadata() = %v, %v; want one mail", mails, err)
+	}
+	m := mails[0]
+	if m.ThreadID != "t1" || strings.Join(m.LabelIDs, ",") != "INBOX,UNREAD" || m.Snippet != "Your order & invoice" || m.SizeEstimate != 2048 {
+		t.Errorf("thread/labels/snippet/size = %q, %v, %q, %d", m.ThreadID, m.LabelIDs, m.Snippet, m.SizeEstimate)
+	}
+	if m.SenderName != "Shop Team" || m.MessageID != "reply-2@example.com" || m.InReplyTo != "order-1@example.com" {
+		t.Errorf("sender name/message IDs = %q, %q, %q", m.SenderName, m.MessageID, m.InReplyTo)
+	}
+	if len(m.Headers) != 4 || m.Header("message-id") != "<reply-2@example.com>" {
+		t.Errorf("Headers = %v, want all four headers", m.Headers)
+	}
+}
+
+func TestGmailService_GetRawMail(t *testing.T) {
+	const raw = "From: shop@example.com\r\nSubject: Invoice\r\n\r\nbody"
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /gmail/v1/users/me/messages/m1", func(w http.ResponseWriter, r *http.Request) {
+		if format := r.URL.Query().Get("format"); format != "raw" {
+			t.Errorf("format = %q, want raw", format)
+		}
+		_, _ = io.WriteString(w, `{"id":"m1","raw":"`+base64.URLEncoding.EncodeToString([]byte(raw))+`"}`)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	svc := &GmailService{clientOptions: []option.ClientOption{option.WithEndpoint(srv.URL + "/"), option.WithHTTPClient(srv.Client())}}
+
+	got, err := svc.GetRawMail(context.Background(), Mail{Id: "m1"})
+	if err != nil {
+		t.Fatalf("GetRawMail() error = %v", err)
+	}
+	if string(got) != raw {
+		t.Errorf("GetRawMail() = %q, want %q", got, raw)
+	}
+}
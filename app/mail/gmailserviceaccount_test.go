@@ -0,0 +1,170 @@
+package mail
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/option"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
+)
+
+// writeServiceAccountKey writes a service account key whose token_uri points at tokenURL.
+func writeServiceAccountKey(t *testing.T, key *rsa.PrivateKey, tokenURL string) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyJSON, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "mail-webhook@project.iam.gserviceaccount.com",
+		"private_key_id": "key-1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":      tokenURL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), ServiceAccountKeyFileName)
+	if err := os.WriteFile(path, keyJSON, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestServiceAccountTokenSource(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			http.Error(w, "unsupported grant", http.StatusBadRequest)
+			return
+		}
+		parts := strings.Split(r.Form.Get("assertion"), ".")
+		if len(parts) != 3 {
+			http.Error(w, "malformed assertion", http.StatusBadRequest)
+			return
+		}
+		sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		var claims map[string]any
+		_ = json.Unmarshal(payload, &claims)
+		if claims["iss"] != "mail-webhook@project.iam.gserviceaccount.com" || claims["sub"] != "invoices@example.com" ||
+			claims["scope"] != gmail.GmailModifyScope || claims["aud"] != "http://"+r.Host+"/token" {
+			http.Error(w, "unexpected claims", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"access_token":"delegated-token","token_type":"Bearer","expires_in":3600}`)
+	}))
+	t.Cleanup(srv.Close)
+	keyFile := writeServiceAccountKey(t, key, srv.URL+"/token")
+
+	ts, err := serviceAccountTokenSource(context.Background(), keyFile, "invoices@example.com", gmail.GmailModifyScope)
+	if err != nil {
+		t.Fatalf("serviceAccountTokenSource() error = %v", err)
+	}
+	tok, err := ts.Token()
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	if tok.AccessToken != "delegated-token" {
+		t.Errorf("AccessToken = %q, want delegated-token", tok.AccessToken)
+	}
+}
+
+func TestGmailService_serviceAccountAddressesSubject(t *testing.T) {
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		_, _ = io.WriteString(w, `{}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	svc := NewGmailService(config.GmailClient{ServiceAccount: config.GmailServiceAccount{Enabled: true, Subject: "invoices@example.com"}})
+	if svc.serviceAccountKeyFile != filepath.Join(DefaultCredentialsPath, ServiceAccountKeyFileName) {
+		t.Errorf("serviceAccountKeyFile = %q, want default in the credentials directory", svc.serviceAccountKeyFile)
+	}
+	svc.clientOptions = []option.ClientOption{option.WithEndpoint(srv.URL + "/"), option.WithHTTPClient(srv.Client())}
+
+	if _, err := svc.GetAllUnreadMail(context.Background()); err != nil {
+		t.Fatalf("GetAllUnreadMail() error = %v", err)
+	}
+	if gotPath != "/gmail/v1/users/invoices@example.com/messages" {
+		t.Errorf("request path = %q, want the impersonated mailbox instead of me", gotPath)
+	}
+}
+
+func TestGmailService_reusesServiceAcrossCalls(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exchanges, modified atomic.Int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		exchanges.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"access_token":"delegated-token","token_type":"Bearer","expires_in":3600}`)
+	})
+	mux.HandleFunc("POST /gmail/v1/users/invoices@example.com/messages/{id}/modify", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer delegated-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		modified.Add(1)
+		_, _ = io.WriteString(w, `{}`)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	svc := NewGmailService(config.GmailClient{ServiceAccount: config.GmailServiceAccount{
+		Enabled: true, KeyFile: writeServiceAccountKey(t, key, srv.URL+"/token"), Subject: "invoices@example.com",
+	}})
+	api, err := svc.getGmailService(context.Background(), gmail.GmailModifyScope)
+	if err != nil {
+		t.Fatalf("getGmailService() error = %v", err)
+	}
+	api.BasePath = srv.URL + "/"
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := svc.MarkMailAsRead(context.Background(), Mail{Id: "m" + strconv.Itoa(i)}); err != nil {
+				t.Errorf("MarkMailAsRead() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if modified.Load() != 8 || exchanges.Load() != 1 {
+		t.Errorf("modified = %d, token exchanges = %d; want 8 calls sharing one exchange", modified.Load(), exchanges.Load())
+	}
+}
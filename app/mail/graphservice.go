@@ -0,0 +1,262 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
+	"github.com/jo-hoe/go-mail-webhook-service/app/mail/message"
+)
+
+const (
+	// graphScope requests the application permissions granted to the app registration.
+	graphScope = "https://graph.microsoft.com/.default"
+	// graphPageSize is the number of messages requested per list page.
+	graphPageSize = 50
+)
+
+// GraphService implements MailClientService using the Microsoft Graph mail API.
+// Messages are downloaded as MIME via /$value so that parsing matches the other raw backends.
+// Mail.Id holds the Graph message ID.
+type GraphService struct {
+	cfg config.GraphClient
+	// httpClient overrides the base transport of the OAuth2 client; nil uses http.DefaultClient.
+	httpClient *http.Client
+	// tokenMu guards tokenSource, which is created on first use and caches the access token
+	// until it expires.
+	tokenMu     sync.Mutex
+	tokenSource oauth2.TokenSource
+}
+
+// NewGraphService creates a GraphService for the given configuration.
+func NewGraphService(cfg config.GraphClient) *GraphService {
+	return &GraphService{cfg: cfg}
+}
+
+// graphMessageList is one page of a Graph messages collection.
+type graphMessageList struct {
+	Value []struct {
+		ID               string    `json:"id"`
+		ReceivedDateTime time.Time `json:"receivedDateTime"`
+	} `json:"value"`
+	NextLink string `json:"@odata.nextLink"`
+}
+
+func (s *GraphService) GetAllUnreadMail(ctx context.Context) ([]Mail, error) {
+	client, err := s.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("$filter", "isRead eq false")
+	query.Set("$select", "id,receivedDateTime")
+	query.Set("$top", fmt.Sprint(graphPageSize))
+	next := s.userURL("mailFolders", s.cfg.Folder, "messages") + "?" + query.Encode()
+
+	var result []Mail
+	for next != "" {
+		var page graphMessageList
+		if err := s.doJSON(ctx, client, http.MethodGet, next, nil, &page); err != nil {
+			return nil, s.wrapGraphError(err, "list unread messages", "")
+		}
+		for _, item := range page.Value {
+			raw, err := s.getMIME(ctx, client, item.ID)
+			if err != nil {
+				return nil, s.wrapGraphError(err, "get message content", item.ID)
+			}
+			m, err := message.Parse(item.ID, raw)
+			if err != nil {
+				slog.Error("error parsing graph message", "mailId", item.ID, "error", err)
+				continue
+			}
+			if !item.ReceivedDateTime.IsZero() {
+				m.ReceivedAt = item.ReceivedDateTime.UTC()
+			}
+			result = append(result, m)
+		}
+		next = page.NextLink
+	}
+	if result == nil {
+		result = []Mail{}
+	}
+	return result, nil
+}
+
+func (s *GraphService) MarkMailAsRead(ctx context.Context, mail Mail) error {
+	client, err := s.client(ctx)
+	if err != nil {
+		return err
+	}
+	body := map[string]any{"isRead": true}
+	if err := s.doJSON(ctx, client, http.MethodPatch, s.userURL("messages", mail.Id), body, nil); err != nil {
+		return s.wrapGraphError(err, "mark message as read", mail.Id)
+	}
+	return nil
+}
+
+// DeleteMail moves the message to the Deleted Items folder, mirroring a user delete in Outlook.
+func (s *GraphService) DeleteMail(ctx context.Context, mail Mail) error {
+	client, err := s.client(ctx)
+	if err != nil {
+		return err
+	}
+	body := map[string]any{"destinationId": "deleteditems"}
+	if err := s.doJSON(ctx, client, http.MethodPost, s.userURL("messages", mail.Id, "move"), body, nil); err != nil {
+		return s.wrapGraphError(err, "delete message", mail.Id)
+	}
+	return nil
+}
+
+// client returns an HTTP client authenticating with the client-credentials flow.
+func (s *GraphService) client(ctx context.Context) (*http.Client, error) {
+	ts, err := s.tokens()
+	if err != nil {
+		return nil, err
+	}
+	if s.httpClient != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, s.httpClient)
+	}
+	return oauth2.NewClient(ctx, ts), nil
+}
+
+// tokens returns the shared client-credentials token source, creating it on first use. Token
+// requests are not bound to the context of the call that happens to refresh the token.
+func (s *GraphService) tokens() (oauth2.TokenSource, error) {
+	s.tokenMu.Lock()
+	defer s.tokenMu.Unlock()
+	if s.tokenSource != nil {
+		return s.tokenSource, nil
+	}
+	secret, err := resolvePassword(s.cfg.ClientSecret, s.cfg.ClientSecretFile, "Graph client")
+	if err != nil {
+		return nil, err
+	}
+	cc := &clientcredentials.Config{
+		ClientID:     s.cfg.ClientID,
+		ClientSecret: secret,
+		TokenURL:     s.cfg.TokenURL,
+		Scopes:       []string{graphScope},
+	}
+	ctx := context.Background()
+	if s.httpClient != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, s.httpClient)
+	}
+	s.tokenSource = cc.TokenSource(ctx)
+	return s.tokenSource, nil
+}
+
+// userURL joins escaped path segments below /users/{user}.
+func (s *GraphService) userURL(segments ...string) string {
+	parts := []string{strings.TrimRight(s.cfg.BaseURL, "/"), "users", url.PathEscape(s.cfg.User)}
+	for _, seg := range segments {
+		parts = append(parts, url.PathEscape(seg))
+	}
+	return strings.Join(parts, "/")
+}
+
+// getMIME downloads the RFC 822 representation of a message.
+func (s *GraphService) getMIME(ctx context.Context, client *http.Client, id string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.userURL("messages", id)+"/$value", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+	if resp.StatusCode != http.StatusOK {
+		return nil, newGraphStatusError(resp)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// doJSON sends an optional JSON body and decodes a JSON response into out when out is non-nil.
+func (s *GraphService) doJSON(ctx context.Context, client *http.Client, method, target string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return newGraphStatusError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// graphStatusError carries the HTTP status and error message returned by Graph.
+type graphStatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *graphStatusError) Error() string {
+	return fmt.Sprintf("graph API returned %d: %s", e.StatusCode, e.Message)
+}
+
+func newGraphStatusError(resp *http.Response) error {
+	var payload struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	msg := strings.TrimSpace(string(b))
+	if json.Unmarshal(b, &payload) == nil && payload.Error.Code != "" {
+		msg = payload.Error.Code + ": " + payload.Error.Message
+	}
+	return &graphStatusError{StatusCode: resp.StatusCode, Message: msg}
+}
+
+// wrapGraphError returns a descriptive error, identifying auth failures (401/403) separately.
+func (s *GraphService) wrapGraphError(err error, action, mailID string) error {
+	ctx := action
+	if mailID != "" {
+		ctx = fmt.Sprintf("%s (mail %s)", action, mailID)
+	}
+	var gErr *graphStatusError
+	if errors.As(err, &gErr) && (gErr.StatusCode == 401 || gErr.StatusCode == 403) {
+		return fmt.Errorf("%s: %w — check that app %s has the Mail.ReadWrite application permission for %s",
+			ctx, err, s.cfg.ClientID, s.cfg.User)
+	}
+	return fmt.Errorf("%s: %w", ctx, err)
+}
+
+func closeBody(resp *http.Response) {
+	if cerr := resp.Body.Close(); cerr != nil {
+		slog.Error("error closing response body", "error", cerr)
+	}
+}
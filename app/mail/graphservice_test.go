@@ -0,0 +1,173 @@
+package mail
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
+)
+
+// fakeGraph is an httptest stand-in for the Entra ID token endpoint and the Graph mail API.
+type fakeGraph struct {
+	mu      sync.Mutex
+	unread  map[string]bool
+	moved   map[string]string
+	tokens  int
+	authErr bool
+}
+
+func (f *fakeGraph) handler(t *testing.T) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "client_credentials" {
+			http.Error(w, "bad grant", http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.tokens++
+		f.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"access_token":"tok","token_type":"Bearer","expires_in":3600}`)
+	})
+	auth := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer tok" || f.authErr {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = io.WriteString(w, `{"error":{"code":"InvalidAuthenticationToken","message":"denied"}}`)
+				return
+			}
+			next(w, r)
+		}
+	}
+	mux.HandleFunc("GET /v1.0/users/orders@example.com/mailFolders/inbox/messages", auth(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("$filter"); got != "isRead eq false" {
+			t.Errorf("$filter = %q, want isRead eq false", got)
+		}
+		// Serve one message per page to exercise @odata.nextLink.
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		page := map[string]any{"value": []any{}}
+		if r.URL.Query().Get("page") == "" {
+			if f.unread["m1"] {
+				page["value"] = []any{map[string]any{"id": "m1", "receivedDateTime": "2024-05-01T10:00:00Z"}}
+			}
+			page["@odata.nextLink"] = "http://" + r.Host + r.URL.Path + "?$filter=isRead+eq+false&page=2"
+		} else if f.unread["m2"] {
+			page["value"] = []any{map[string]any{"id": "m2", "receivedDateTime": "2024-05-02T10:00:00Z"}}
+		}
+		_ = json.NewEncoder(w).Encode(page)
+	}))
+	mux.HandleFunc("GET /v1.0/users/orders@example.com/messages/{id}/$value", auth(func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		_, _ = io.WriteString(w, "From: Vendor <vendor@example.com>\r\nSubject: Invoice "+id+"\r\n\r\nbody "+id+"\r\n")
+	}))
+	mux.HandleFunc("PATCH /v1.0/users/orders@example.com/messages/{id}", auth(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]bool
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || !body["isRead"] {
+			http.Error(w, "expected isRead true", http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		delete(f.unread, r.PathValue("id"))
+		f.mu.Unlock()
+		_, _ = io.WriteString(w, `{}`)
+	}))
+	mux.HandleFunc("POST /v1.0/users/orders@example.com/messages/{id}/move", auth(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.moved[r.PathValue("id")] = body["destinationId"]
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, `{}`)
+	}))
+	return mux
+}
+
+func newTestGraphService(t *testing.T) (*GraphService, *fakeGraph) {
+	t.Helper()
+	f := &fakeGraph{unread: map[string]bool{"m1": true, "m2": true}, moved: map[string]string{}}
+	srv := httptest.NewServer(f.handler(t))
+	t.Cleanup(srv.Close)
+	svc := NewGraphService(config.GraphClient{
+		Enabled:      true,
+		ClientID:     "app",
+		ClientSecret: "secret",
+		User:         "orders@example.com",
+		Folder:       "inbox",
+		BaseURL:      srv.URL + "/v1.0",
+		TokenURL:     srv.URL + "/token",
+	})
+	svc.httpClient = srv.Client()
+	return svc, f
+}
+
+func TestGraphService_GetAllUnreadMail(t *testing.T) {
+	svc, _ := newTestGraphService(t)
+
+	mails, err := svc.GetAllUnreadMail(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllUnreadMail() error = %v", err)
+	}
+	if len(mails) != 2 {
+		t.Fatalf("GetAllUnreadMail() returned %d mails, want 2 across both pages", len(mails))
+	}
+	if mails[0].Id != "m1" || mails[0].Subject != "Invoice m1" || mails[0].Sender != "vendor@example.com" {
+		t.Errorf("mails[0] = %+v, want m1 from vendor", mails[0])
+	}
+	if !mails[1].ReceivedAt.Equal(time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("ReceivedAt = %v, want receivedDateTime", mails[1].ReceivedAt)
+	}
+}
+
+func TestGraphService_MarkMailAsRead(t *testing.T) {
+	svc, f := newTestGraphService(t)
+
+	if err := svc.MarkMailAsRead(context.Background(), Mail{Id: "m1"}); err != nil {
+		t.Fatalf("MarkMailAsRead() error = %v", err)
+	}
+	mails, err := svc.GetAllUnreadMail(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllUnreadMail() error = %v", err)
+	}
+	if len(mails) != 1 || mails[0].Id != "m2" {
+		t.Errorf("GetAllUnreadMail() after markRead = %+v, want only m2", mails)
+	}
+	if f.tokens != 1 {
+		t.Errorf("token requests = %d, want 1 shared across calls", f.tokens)
+	}
+}
+
+func TestGraphService_DeleteMail_movesToDeletedItems(t *testing.T) {
+	svc, f := newTestGraphService(t)
+
+	if err := svc.DeleteMail(context.Background(), Mail{Id: "m2"}); err != nil {
+		t.Fatalf("DeleteMail() error = %v", err)
+	}
+	if f.moved["m2"] != "deleteditems" {
+		t.Errorf("moved = %v, want m2 -> deleteditems", f.moved)
+	}
+}
+
+func TestGraphService_authErrorIsDescriptive(t *testing.T) {
+	svc, f := newTestGraphService(t)
+	f.authErr = true
+
+	_, err := svc.GetAllUnreadMail(context.Background())
+	if err == nil {
+		t.Fatal("GetAllUnreadMail() should fail on 401")
+	}
+	if !strings.Contains(err.Error(), "Mail.ReadWrite") || !strings.Contains(err.Error(), "InvalidAuthenticationToken") {
+		t.Errorf("error = %q, want permission hint and Graph error code", err)
+	}
+}
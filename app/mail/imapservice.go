@@ -0,0 +1,252 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/commands"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
+	"github.com/jo-hoe/go-mail-webhook-service/app/mail/message"
+)
+
+// IMAPService implements MailClientService against a generic IMAP server.
+// Mail.Id holds the message UID within the configured folder.
+type IMAPService struct {
+	cfg config.IMAPClient
+	// pendingMu guards pendingRead and pendingDelete, the UIDs queued by MarkMailAsRead and
+	// DeleteMail since the last CommitCheckpoint.
+	pendingMu     sync.Mutex
+	pendingRead   []uint32
+	pendingDelete []uint32
+}
+
+// NewIMAPService creates an IMAPService for the given configuration.
+func NewIMAPService(cfg config.IMAPClient) *IMAPService {
+	return &IMAPService{cfg: cfg}
+}
+
+func (s *IMAPService) GetAllUnreadMail(ctx context.Context) ([]Mail, error) {
+	c, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer s.logout(c)
+
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{imap.SeenFlag}
+	uids, err := c.UidSearch(criteria)
+	if err != nil {
+		return nil, fmt.Errorf("search unseen messages in %s: %w", s.cfg.Folder, err)
+	}
+	if len(uids) == 0 {
+		return []Mail{}, nil
+	}
+
+	seqset := uidSet(uids)
+	// BODY.PEEK[] leaves \Seen untouched so that only MarkMailAsRead flags a mail.
+	section := &imap.BodySectionName{Peek: true}
+	items := []imap.FetchItem{imap.FetchUid, imap.FetchInternalDate, section.FetchItem()}
+
+	messages := make(chan *imap.Message, len(uids))
+	done := make(chan error, 1)
+	go func() {
+		done <- c.UidFetch(seqset, items, messages)
+	}()
+
+	result := make([]Mail, 0, len(uids))
+	for msg := range messages {
+		body := msg.GetBody(section)
+		if body == nil {
+			slog.Error("imap server returned no body", "uid", msg.Uid)
+			continue
+		}
+		raw, err := io.ReadAll(body)
+		if err != nil {
+			slog.Error("error reading imap message body", "uid", msg.Uid, "error", err)
+			continue
+		}
+		m, err := message.Parse(strconv.FormatUint(uint64(msg.Uid), 10), raw)
+		if err != nil {
+			slog.Error("error parsing imap message", "uid", msg.Uid, "error", err)
+			continue
+		}
+		if !msg.InternalDate.IsZero() {
+			m.ReceivedAt = msg.InternalDate.UTC()
+		}
+		result = append(result, m)
+	}
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("fetch unseen messages in %s: %w", s.cfg.Folder, err)
+	}
+	return result, nil
+}
+
+// MarkMailAsRead queues the message to be flagged \Seen by CommitCheckpoint.
+func (s *IMAPService) MarkMailAsRead(_ context.Context, mail Mail) error {
+	uid, err := parseIMAPUID(mail.Id)
+	if err != nil {
+		return fmt.Errorf("mark message as read (mail %s): %w", mail.Id, err)
+	}
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	s.pendingRead = append(s.pendingRead, uid)
+	return nil
+}
+
+// DeleteMail queues the message to be deleted by CommitCheckpoint.
+func (s *IMAPService) DeleteMail(_ context.Context, mail Mail) error {
+	uid, err := parseIMAPUID(mail.Id)
+	if err != nil {
+		return fmt.Errorf("delete message (mail %s): %w", mail.Id, err)
+	}
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	s.pendingDelete = append(s.pendingDelete, uid)
+	return nil
+}
+
+// CommitCheckpoint applies the actions queued by MarkMailAsRead and DeleteMail in one session,
+// so that the mails processed concurrently do not each open their own. Deleted messages are
+// removed with UID EXPUNGE, leaving other messages flagged \Deleted in the folder alone; servers
+// without UIDPLUS keep them flagged \Deleted and \Seen until the folder is expunged otherwise.
+// Failed mails need no bookkeeping since they are still unseen.
+func (s *IMAPService) CommitCheckpoint(ctx context.Context, _ []Mail) error {
+	s.pendingMu.Lock()
+	read, deleted := s.pendingRead, s.pendingDelete
+	s.pendingRead, s.pendingDelete = nil, nil
+	s.pendingMu.Unlock()
+	if len(read) == 0 && len(deleted) == 0 {
+		return nil
+	}
+
+	c, err := s.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("apply processed actions to %d messages: %w", len(read)+len(deleted), err)
+	}
+	defer s.logout(c)
+	if len(read) > 0 {
+		if err := addFlags(c, read, imap.SeenFlag); err != nil {
+			return fmt.Errorf("mark %d messages as read: %w", len(read), err)
+		}
+	}
+	if len(deleted) > 0 {
+		if err := s.deleteMessages(c, deleted); err != nil {
+			return fmt.Errorf("delete %d messages: %w", len(deleted), err)
+		}
+	}
+	return nil
+}
+
+// deleteMessages flags the messages \Deleted and \Seen and expunges exactly them when the
+// server supports UIDPLUS.
+func (s *IMAPService) deleteMessages(c *client.Client, uids []uint32) error {
+	if err := addFlags(c, uids, imap.DeletedFlag, imap.SeenFlag); err != nil {
+		return err
+	}
+	uidPlus, err := c.Support("UIDPLUS")
+	if err != nil {
+		return fmt.Errorf("capability: %w", err)
+	}
+	if !uidPlus {
+		slog.Warn("imap server does not support UIDPLUS; deleted messages stay flagged until the folder is expunged",
+			"folder", s.cfg.Folder, "count", len(uids))
+		return nil
+	}
+	status, err := c.Execute(&commands.Uid{Cmd: &uidExpunge{uids: uidSet(uids)}}, nil)
+	if err == nil {
+		err = status.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("uid expunge: %w", err)
+	}
+	return nil
+}
+
+// uidExpunge is the EXPUNGE command with a UID set, sent as UID EXPUNGE (RFC 4315).
+type uidExpunge struct {
+	uids *imap.SeqSet
+}
+
+func (cmd *uidExpunge) Command() *imap.Command {
+	return &imap.Command{Name: "EXPUNGE", Arguments: []interface{}{cmd.uids}}
+}
+
+// addFlags adds flags to the messages with the given UIDs.
+func addFlags(c *client.Client, uids []uint32, flags ...string) error {
+	values := make([]interface{}, 0, len(flags))
+	for _, f := range flags {
+		values = append(values, f)
+	}
+	return c.UidStore(uidSet(uids), imap.FormatFlagsOp(imap.AddFlags, true), values, nil)
+}
+
+func uidSet(uids []uint32) *imap.SeqSet {
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uids...)
+	return seqset
+}
+
+func parseIMAPUID(id string) (uint32, error) {
+	uid, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid IMAP UID: %w", err)
+	}
+	return uint32(uid), nil
+}
+
+// connect dials the server, authenticates, and selects the configured folder read-write.
+func (s *IMAPService) connect(ctx context.Context) (*client.Client, error) {
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	tlsConfig := newTLSConfig(s.cfg.Host, s.cfg.InsecureSkipVerify)
+	dialer := newDialer(ctx)
+
+	var (
+		c   *client.Client
+		err error
+	)
+	switch s.cfg.Security {
+	case "none", "starttls":
+		c, err = client.DialWithDialer(dialer, addr)
+	default:
+		c, err = client.DialWithDialerTLS(dialer, addr, tlsConfig)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("connect to IMAP server %s: %w", addr, err)
+	}
+	c.Timeout = serverIOTimeout
+	if s.cfg.Security == "starttls" {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			s.logout(c)
+			return nil, fmt.Errorf("starttls with IMAP server %s: %w", addr, err)
+		}
+	}
+
+	password, err := resolvePassword(s.cfg.Password, s.cfg.PasswordFile, "IMAP")
+	if err != nil {
+		s.logout(c)
+		return nil, err
+	}
+	if err := c.Login(s.cfg.Username, password); err != nil {
+		s.logout(c)
+		return nil, fmt.Errorf("login to IMAP server %s as %s: %w", addr, s.cfg.Username, err)
+	}
+	if _, err := c.Select(s.cfg.Folder, false); err != nil {
+		s.logout(c)
+		return nil, fmt.Errorf("select IMAP folder %s: %w", s.cfg.Folder, err)
+	}
+	return c, nil
+}
+
+func (s *IMAPService) logout(c *client.Client) {
+	if err := c.Logout(); err != nil && err != client.ErrAlreadyLoggedOut {
+		slog.Debug("imap logout failed", "error", err)
+	}
+}
@@ -0,0 +1,235 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/server"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
+)
+
+const testIMAPMessage = "From: Alice <alice@example.com>\r\n" +
+	"To: orders@example.com\r\n" +
+	"Subject: Order 42 confirmed\r\n" +
+	"Date: Wed, 11 May 2016 14:31:59 +0000\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"b1\"\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"Total: $12.50\r\n" +
+	"--b1\r\n" +
+	"Content-Type: application/pdf; name=\"invoice-42.pdf\"\r\n" +
+	"Content-Disposition: attachment; filename=\"invoice-42.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0xLjQ=\r\n" +
+	"--b1--\r\n"
+
+// startTestIMAPServer serves an in-memory IMAP backend with the given extensions and returns a
+// matching client config. The backend's INBOX contains one seen seed message plus one unseen
+// testIMAPMessage.
+func startTestIMAPServer(t *testing.T, exts ...server.Extension) (config.IMAPClient, *memory.Backend) {
+	t.Helper()
+	be := memory.New()
+	user, err := be.Login(nil, "username", "password")
+	if err != nil {
+		t.Fatalf("login to memory backend: %v", err)
+	}
+	inbox, err := user.GetMailbox("INBOX")
+	if err != nil {
+		t.Fatalf("get INBOX: %v", err)
+	}
+	if err := inbox.CreateMessage(nil, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), bytes.NewBufferString(testIMAPMessage)); err != nil {
+		t.Fatalf("create message: %v", err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := server.New(be)
+	srv.AllowInsecureAuth = true
+	srv.Enable(exts...)
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	addr := l.Addr().(*net.TCPAddr)
+	return config.IMAPClient{
+		Enabled:  true,
+		Host:     "127.0.0.1",
+		Port:     addr.Port,
+		Security: "none",
+		Username: "username",
+		Password: "password",
+		Folder:   "INBOX",
+	}, be
+}
+
+func TestIMAPService_GetAllUnreadMail(t *testing.T) {
+	cfg, _ := startTestIMAPServer(t)
+	svc := NewIMAPService(cfg)
+
+	mails, err := svc.GetAllUnreadMail(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllUnreadMail() error = %v", err)
+	}
+	if len(mails) != 1 {
+		t.Fatalf("GetAllUnreadMail() returned %d mails, want 1", len(mails))
+	}
+	m := mails[0]
+	if m.Sender != "alice@example.com" {
+		t.Errorf("Sender = %q, want alice@example.com", m.Sender)
+	}
+	if m.Subject != "Order 42 confirmed" {
+		t.Errorf("Subject = %q, want %q", m.Subject, "Order 42 confirmed")
+	}
+	if m.Body != "Total: $12.50" {
+		t.Errorf("Body = %q, want %q", m.Body, "Total: $12.50")
+	}
+	if len(m.Attachments) != 1 || m.Attachments[0].Name != "invoice-42.pdf" || string(m.Attachments[0].Content) != "%PDF-1.4" {
+		t.Errorf("Attachments = %+v, want one invoice-42.pdf with PDF header", m.Attachments)
+	}
+	if !m.ReceivedAt.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("ReceivedAt = %v, want INTERNALDATE", m.ReceivedAt)
+	}
+
+	// Fetching must not implicitly set \Seen.
+	again, err := svc.GetAllUnreadMail(context.Background())
+	if err != nil || len(again) != 1 {
+		t.Fatalf("second GetAllUnreadMail() = %d mails, %v; want 1, nil", len(again), err)
+	}
+}
+
+func TestIMAPService_MarkMailAsRead(t *testing.T) {
+	cfg, _ := startTestIMAPServer(t)
+	svc := NewIMAPService(cfg)
+
+	mails, err := svc.GetAllUnreadMail(context.Background())
+	if err != nil || len(mails) != 1 {
+		t.Fatalf("GetAllUnreadMail() = %d mails, %v; want 1, nil", len(mails), err)
+	}
+	if err := svc.MarkMailAsRead(context.Background(), mails[0]); err != nil {
+		t.Fatalf("MarkMailAsRead() error = %v", err)
+	}
+	if mails, err = svc.GetAllUnreadMail(context.Background()); err != nil || len(mails) != 1 {
+		t.Fatalf("GetAllUnreadMail() before commit = %d mails, %v; want 1, nil", len(mails), err)
+	}
+	if err := svc.CommitCheckpoint(context.Background(), nil); err != nil {
+		t.Fatalf("CommitCheckpoint() error = %v", err)
+	}
+	mails, err = svc.GetAllUnreadMail(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllUnreadMail() error = %v", err)
+	}
+	if len(mails) != 0 {
+		t.Errorf("GetAllUnreadMail() after markRead returned %d mails, want 0", len(mails))
+	}
+}
+
+func TestIMAPService_DeleteMail(t *testing.T) {
+	tests := []struct {
+		name string
+		exts []server.Extension
+		// wantMessages counts the messages left in INBOX; the seed message is flagged \Deleted
+		// by another client and must survive.
+		wantMessages uint32
+	}{
+		{name: "uid expunge", exts: []server.Extension{uidPlusExtension{}}, wantMessages: 1},
+		{name: "without UIDPLUS only flagged", wantMessages: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, be := startTestIMAPServer(t, tt.exts...)
+			user, _ := be.Login(nil, "username", "password")
+			inbox, _ := user.GetMailbox("INBOX")
+			seed := inbox.(*memory.Mailbox).Messages[0]
+			seed.Flags = append(seed.Flags, imap.DeletedFlag)
+			svc := NewIMAPService(cfg)
+
+			mails, err := svc.GetAllUnreadMail(context.Background())
+			if err != nil || len(mails) != 1 {
+				t.Fatalf("GetAllUnreadMail() = %d mails, %v; want 1, nil", len(mails), err)
+			}
+			if err := svc.DeleteMail(context.Background(), mails[0]); err != nil {
+				t.Fatalf("DeleteMail() error = %v", err)
+			}
+			if err := svc.CommitCheckpoint(context.Background(), nil); err != nil {
+				t.Fatalf("CommitCheckpoint() error = %v", err)
+			}
+
+			status, err := inbox.Status([]imap.StatusItem{imap.StatusMessages})
+			if err != nil {
+				t.Fatalf("Status() error = %v", err)
+			}
+			if status.Messages != tt.wantMessages {
+				t.Errorf("INBOX has %d messages after delete, want %d", status.Messages, tt.wantMessages)
+			}
+			if mails, err := svc.GetAllUnreadMail(context.Background()); err != nil || len(mails) != 0 {
+				t.Errorf("GetAllUnreadMail() after delete = %d mails, %v; want 0, nil", len(mails), err)
+			}
+		})
+	}
+}
+
+// uidPlusExtension implements UID EXPUNGE of UIDPLUS (RFC 4315) for the memory backend.
+type uidPlusExtension struct{}
+
+func (uidPlusExtension) Capabilities(server.Conn) []string { return []string{"UIDPLUS"} }
+
+func (uidPlusExtension) Command(name string) server.HandlerFactory {
+	if name != "EXPUNGE" {
+		return nil
+	}
+	return func() server.Handler { return &uidExpungeHandler{} }
+}
+
+type uidExpungeHandler struct {
+	uids *imap.SeqSet
+}
+
+func (h *uidExpungeHandler) Parse(fields []interface{}) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	set, ok := fields[0].(string)
+	if !ok {
+		return errors.New("UID EXPUNGE expects a UID set")
+	}
+	var err error
+	h.uids, err = imap.ParseSeqSet(set)
+	return err
+}
+
+func (h *uidExpungeHandler) Handle(server.Conn) error {
+	return errors.New("only UID EXPUNGE is expected")
+}
+
+func (h *uidExpungeHandler) UidHandle(conn server.Conn) error {
+	mbox := conn.Context().Mailbox.(*memory.Mailbox)
+	kept := mbox.Messages[:0]
+	for _, msg := range mbox.Messages {
+		if !h.uids.Contains(msg.Uid) || !slices.Contains(msg.Flags, imap.DeletedFlag) {
+			kept = append(kept, msg)
+		}
+	}
+	mbox.Messages = kept
+	return nil
+}
+
+func TestIMAPService_invalidUID(t *testing.T) {
+	svc := NewIMAPService(config.IMAPClient{Host: "127.0.0.1", Port: 1})
+	err := svc.MarkMailAsRead(context.Background(), Mail{Id: "not-a-uid"})
+	if err == nil {
+		t.Fatal("MarkMailAsRead() with non-numeric id should fail")
+	}
+}
@@ -0,0 +1,518 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
+	"github.com/jo-hoe/go-mail-webhook-service/app/mail/message"
+)
+
+const (
+	jmapCapabilityCore = "urn:ietf:params:jmap:core"
+	jmapCapabilityMail = "urn:ietf:params:jmap:mail"
+	// jmapSeenKeyword is the keyword marking an Email as read (RFC 8621 section 4.1.1).
+	jmapSeenKeyword = "$seen"
+	// jmapPageSize is the number of Email ids requested per Email/query call.
+	jmapPageSize = 50
+)
+
+// jmapEmailProperties are the Email properties fetched by GetAllUnreadMail.
+var jmapEmailProperties = []string{
+	"id", "from", "to", "cc", "header:Delivered-To:asText:all", "subject", "receivedAt",
+	"textBody", "htmlBody", "attachments", "bodyValues", "headers",
+}
+
+// JMAPService implements MailClientService using JMAP (RFC 8620/8621), e.g. Fastmail or Stalwart.
+// Mail.Id holds the JMAP Email id.
+type JMAPService struct {
+	cfg config.JMAPClient
+	// httpClient is used for all requests; nil uses http.DefaultClient.
+	httpClient *http.Client
+}
+
+// NewJMAPService creates a JMAPService for the given configuration.
+func NewJMAPService(cfg config.JMAPClient) *JMAPService {
+	return &JMAPService{cfg: cfg}
+}
+
+// jmapSession is the subset of the JMAP session resource used by this service.
+type jmapSession struct {
+	APIURL          string            `json:"apiUrl"`
+	DownloadURL     string            `json:"downloadUrl"`
+	PrimaryAccounts map[string]string `json:"primaryAccounts"`
+
+	accountID string
+}
+
+// jmapCall is one method call of a JMAP request: name, arguments and call id.
+type jmapCall struct {
+	Name string
+	Args map[string]any
+	ID   string
+}
+
+func (c jmapCall) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]any{c.Name, c.Args, c.ID})
+}
+
+type jmapEmailAddress struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type jmapBodyPart struct {
+	PartID      string `json:"partId"`
+	BlobID      string `json:"blobId"`
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Disposition string `json:"disposition"`
+	CID         string `json:"cid"`
+}
+
+// jmapEmailHeader is a header field in its raw form, with folding white space.
+type jmapEmailHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type jmapEmail struct {
+	ID          string             `json:"id"`
+	From        []jmapEmailAddress `json:"from"`
+	To          []jmapEmailAddress `json:"to"`
+	Cc          []jmapEmailAddress `json:"cc"`
+	DeliveredTo []string           `json:"header:Delivered-To:asText:all"`
+	Subject     string             `json:"subject"`
+	ReceivedAt  time.Time          `json:"receivedAt"`
+	TextBody    []jmapBodyPart     `json:"textBody"`
+	HTMLBody    []jmapBodyPart     `json:"htmlBody"`
+	Attachments []jmapBodyPart     `json:"attachments"`
+	BodyValues  map[string]struct {
+		Value string `json:"value"`
+	} `json:"bodyValues"`
+	Headers []jmapEmailHeader `json:"headers"`
+}
+
+func (s *JMAPService) GetAllUnreadMail(ctx context.Context) ([]Mail, error) {
+	session, err := s.session(ctx)
+	if err != nil {
+		return nil, s.wrapJMAPError(err, "get session", "")
+	}
+	mailboxID, err := s.mailboxID(ctx, session, s.cfg.Mailbox)
+	if err != nil {
+		return nil, s.wrapJMAPError(err, "find mailbox", "")
+	}
+
+	var result []Mail
+	for position := 0; ; {
+		responses, err := s.call(ctx, session,
+			jmapCall{Name: "Email/query", ID: "q", Args: map[string]any{
+				"accountId": session.accountID,
+				"filter":    map[string]any{"inMailbox": mailboxID, "notKeyword": jmapSeenKeyword},
+				"sort":      []any{map[string]any{"property": "receivedAt", "isAscending": true}},
+				"position":  position,
+				"limit":     jmapPageSize,
+			}},
+			jmapCall{Name: "Email/get", ID: "g", Args: map[string]any{
+				"accountId":           session.accountID,
+				"#ids":                map[string]any{"resultOf": "q", "name": "Email/query", "path": "/ids"},
+				"properties":          jmapEmailProperties,
+				"fetchTextBodyValues": true,
+				"fetchHTMLBodyValues": true,
+			}},
+		)
+		if err != nil {
+			return nil, s.wrapJMAPError(err, "list unread messages", "")
+		}
+		var query struct {
+			IDs []string `json:"ids"`
+		}
+		var get struct {
+			List []jmapEmail `json:"list"`
+		}
+		if err := json.Unmarshal(responses["q"], &query); err != nil {
+			return nil, fmt.Errorf("list unread messages: %w", err)
+		}
+		if err := json.Unmarshal(responses["g"], &get); err != nil {
+			return nil, fmt.Errorf("list unread messages: %w", err)
+		}
+		for _, email := range get.List {
+			m, err := s.toMail(ctx, session, email)
+			if err != nil {
+				return nil, s.wrapJMAPError(err, "download attachment", email.ID)
+			}
+			result = append(result, m)
+		}
+		if len(query.IDs) < jmapPageSize {
+			break
+		}
+		position += len(query.IDs)
+	}
+	if result == nil {
+		result = []Mail{}
+	}
+	return result, nil
+}
+
+// GetRawMail downloads the RFC 822 source of m from the blob of the Email.
+func (s *JMAPService) GetRawMail(ctx context.Context, m Mail) ([]byte, error) {
+	session, err := s.session(ctx)
+	if err != nil {
+		return nil, s.wrapJMAPError(err, "get session", "")
+	}
+	responses, err := s.call(ctx, session, jmapCall{Name: "Email/get", ID: "g", Args: map[string]any{
+		"accountId":  session.accountID,
+		"ids":        []string{m.Id},
+		"properties": []string{"blobId"},
+	}})
+	if err != nil {
+		return nil, s.wrapJMAPError(err, "get raw message", m.Id)
+	}
+	var get struct {
+		List []struct {
+			BlobID string `json:"blobId"`
+		} `json:"list"`
+	}
+	if err := json.Unmarshal(responses["g"], &get); err != nil {
+		return nil, fmt.Errorf("get raw message (mail %s): %w", m.Id, err)
+	}
+	if len(get.List) == 0 {
+		return nil, fmt.Errorf("get raw message (mail %s): not found", m.Id)
+	}
+	raw, err := s.download(ctx, session, jmapBodyPart{BlobID: get.List[0].BlobID, Type: "message/rfc822", Name: "message.eml"})
+	if err != nil {
+		return nil, s.wrapJMAPError(err, "download raw message", m.Id)
+	}
+	return raw, nil
+}
+
+// MarkMailAsRead sets the $seen keyword on the Email.
+func (s *JMAPService) MarkMailAsRead(ctx context.Context, mail Mail) error {
+	session, err := s.session(ctx)
+	if err != nil {
+		return s.wrapJMAPError(err, "get session", "")
+	}
+	patch := map[string]any{"keywords/" + jmapSeenKeyword: true}
+	if err := s.updateEmail(ctx, session, mail.Id, patch); err != nil {
+		return s.wrapJMAPError(err, "mark message as read", mail.Id)
+	}
+	return nil
+}
+
+// DeleteMail moves the Email to the mailbox with the trash role, or destroys it when deleteMode is "destroy".
+func (s *JMAPService) DeleteMail(ctx context.Context, mail Mail) error {
+	session, err := s.session(ctx)
+	if err != nil {
+		return s.wrapJMAPError(err, "get session", "")
+	}
+	if s.cfg.DeleteMode == "destroy" {
+		responses, err := s.call(ctx, session, jmapCall{Name: "Email/set", ID: "d", Args: map[string]any{
+			"accountId": session.accountID,
+			"destroy":   []string{mail.Id},
+		}})
+		if err == nil {
+			err = jmapSetFailure(responses["d"], "notDestroyed", mail.Id)
+		}
+		if err != nil {
+			return s.wrapJMAPError(err, "delete message", mail.Id)
+		}
+		return nil
+	}
+
+	trashID, err := s.mailboxID(ctx, session, "trash")
+	if err != nil {
+		return s.wrapJMAPError(err, "find trash mailbox", mail.Id)
+	}
+	if err := s.updateEmail(ctx, session, mail.Id, map[string]any{"mailboxIds": map[string]bool{trashID: true}}); err != nil {
+		return s.wrapJMAPError(err, "delete message", mail.Id)
+	}
+	return nil
+}
+
+// toMail maps a JMAP Email onto Mail, downloading attachment blobs.
+func (s *JMAPService) toMail(ctx context.Context, session *jmapSession, email jmapEmail) (Mail, error) {
+	m := Mail{
+		Id:         email.ID,
+		Subject:    email.Subject,
+		ReceivedAt: email.ReceivedAt.UTC(),
+	}
+	if len(email.From) > 0 {
+		m.Sender = email.From[0].Email
+	}
+
+	var recipients []Header
+	for _, v := range email.DeliveredTo {
+		recipients = append(recipients, Header{Name: "Delivered-To", Value: strings.TrimSpace(v)})
+	}
+	for _, a := range append(append([]jmapEmailAddress{}, email.To...), email.Cc...) {
+		recipients = append(recipients, Header{Name: "To", Value: a.Email})
+	}
+	m.Recipients = message.RecipientAddresses(recipients)
+
+	fields := make([]Header, 0, len(email.Headers))
+	for _, h := range email.Headers {
+		value := strings.NewReplacer("\r\n", "", "\n", "").Replace(h.Value)
+		fields = append(fields, Header{Name: h.Name, Value: strings.TrimSpace(value)})
+	}
+	message.ApplyHeaders(&m, fields)
+
+	for _, part := range email.TextBody {
+		if part.Type == "text/plain" {
+			m.Body = email.BodyValues[part.PartID].Value
+			break
+		}
+	}
+	for _, part := range email.HTMLBody {
+		if part.Type == "text/html" {
+			m.HTMLBody = email.BodyValues[part.PartID].Value
+			break
+		}
+	}
+	message.ApplyHTMLFallback(&m)
+
+	// Unnamed parts are kept too: a forwarded message/rfc822 part often has no filename.
+	for _, part := range email.Attachments {
+		if part.BlobID == "" {
+			continue
+		}
+		content, err := s.download(ctx, session, part)
+		if err != nil {
+			return Mail{}, err
+		}
+		inline := part.Disposition == "inline" || (part.Disposition == "" && part.CID != "")
+		m.Attachments = append(m.Attachments, message.NewAttachment(part.Name, content, part.Type, part.CID, inline))
+	}
+	message.ExpandTNEFAttachments(&m)
+	message.EmbedAttachedMails(&m)
+	return m, nil
+}
+
+// mailboxID returns the id of the mailbox with the given role, e.g. "inbox" or "trash".
+func (s *JMAPService) mailboxID(ctx context.Context, session *jmapSession, role string) (string, error) {
+	responses, err := s.call(ctx, session, jmapCall{Name: "Mailbox/query", ID: "m", Args: map[string]any{
+		"accountId": session.accountID,
+		"filter":    map[string]any{"role": role},
+	}})
+	if err != nil {
+		return "", err
+	}
+	var query struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.Unmarshal(responses["m"], &query); err != nil {
+		return "", err
+	}
+	if len(query.IDs) == 0 {
+		return "", fmt.Errorf("no mailbox with role %q", role)
+	}
+	return query.IDs[0], nil
+}
+
+// updateEmail applies a PatchObject to one Email.
+func (s *JMAPService) updateEmail(ctx context.Context, session *jmapSession, id string, patch map[string]any) error {
+	responses, err := s.call(ctx, session, jmapCall{Name: "Email/set", ID: "u", Args: map[string]any{
+		"accountId": session.accountID,
+		"update":    map[string]any{id: patch},
+	}})
+	if err != nil {
+		return err
+	}
+	return jmapSetFailure(responses["u"], "notUpdated", id)
+}
+
+// jmapSetFailure returns the SetError reported for id under key ("notUpdated" / "notDestroyed"), if any.
+func jmapSetFailure(response json.RawMessage, key, id string) error {
+	var set map[string]json.RawMessage
+	if err := json.Unmarshal(response, &set); err != nil {
+		return err
+	}
+	var failed map[string]jmapError
+	if raw, ok := set[key]; ok && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &failed); err != nil {
+			return err
+		}
+	}
+	if setErr, ok := failed[id]; ok {
+		return &setErr
+	}
+	return nil
+}
+
+// session fetches the JMAP session resource and resolves the primary mail account.
+func (s *JMAPService) session(ctx context.Context) (*jmapSession, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.cfg.SessionURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	var session jmapSession
+	if err := s.do(req, &session); err != nil {
+		return nil, err
+	}
+	session.accountID = session.PrimaryAccounts[jmapCapabilityMail]
+	if session.accountID == "" {
+		return nil, fmt.Errorf("session has no primary account for %s", jmapCapabilityMail)
+	}
+	// apiUrl and downloadUrl may be relative to the session resource.
+	base, err := url.Parse(s.cfg.SessionURL)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range []*string{&session.APIURL, &session.DownloadURL} {
+		ref, err := url.Parse(*u)
+		if err != nil {
+			return nil, err
+		}
+		*u = base.ResolveReference(ref).String()
+	}
+	// The download URL is an RFC 6570 template; ResolveReference escapes its braces.
+	session.DownloadURL = strings.NewReplacer("%7B", "{", "%7D", "}").Replace(session.DownloadURL)
+	return &session, nil
+}
+
+// call sends one JMAP request and returns the method response arguments keyed by call id.
+func (s *JMAPService) call(ctx context.Context, session *jmapSession, calls ...jmapCall) (map[string]json.RawMessage, error) {
+	body, err := json.Marshal(map[string]any{
+		"using":       []string{jmapCapabilityCore, jmapCapabilityMail},
+		"methodCalls": calls,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, session.APIURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp struct {
+		MethodResponses [][3]json.RawMessage `json:"methodResponses"`
+	}
+	if err := s.do(req, &resp); err != nil {
+		return nil, err
+	}
+	responses := make(map[string]json.RawMessage, len(resp.MethodResponses))
+	for _, r := range resp.MethodResponses {
+		var name, id string
+		if err := json.Unmarshal(r[0], &name); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(r[2], &id); err != nil {
+			return nil, err
+		}
+		if name == "error" {
+			var methodErr jmapError
+			if err := json.Unmarshal(r[1], &methodErr); err != nil {
+				return nil, err
+			}
+			return nil, &methodErr
+		}
+		responses[id] = r[1]
+	}
+	for _, c := range calls {
+		if _, ok := responses[c.ID]; !ok {
+			return nil, fmt.Errorf("no response for %s", c.Name)
+		}
+	}
+	return responses, nil
+}
+
+// download fetches the content of a blob via the session download URL template. Unnamed blobs
+// are requested as "attachment" since the name is a path segment in common templates.
+func (s *JMAPService) download(ctx context.Context, session *jmapSession, part jmapBodyPart) ([]byte, error) {
+	name := part.Name
+	if name == "" {
+		name = "attachment"
+	}
+	target := strings.NewReplacer(
+		"{accountId}", url.PathEscape(session.accountID),
+		"{blobId}", url.PathEscape(part.BlobID),
+		"{type}", url.QueryEscape(part.Type),
+		"{name}", url.PathEscape(name),
+	).Replace(session.DownloadURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	var content []byte
+	if err := s.do(req, &content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// do authenticates and sends req. A *[]byte out receives the raw body; any other non-nil out is JSON-decoded.
+func (s *JMAPService) do(req *http.Request, out any) error {
+	token, err := resolvePassword(s.cfg.Token, s.cfg.TokenFile, "JMAP token")
+	if err != nil {
+		return err
+	}
+	if s.cfg.Username != "" {
+		req.SetBasicAuth(s.cfg.Username, token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	client := s.httpClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		return &jmapStatusError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(b))}
+	}
+	if raw, ok := out.(*[]byte); ok {
+		*raw, err = io.ReadAll(resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// jmapStatusError carries an unexpected HTTP status returned by the JMAP server.
+type jmapStatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *jmapStatusError) Error() string {
+	return fmt.Sprintf("JMAP server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// jmapError is a JMAP method-level error or SetError.
+type jmapError struct {
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+func (e *jmapError) Error() string {
+	if e.Description == "" {
+		return "JMAP error " + e.Type
+	}
+	return fmt.Sprintf("JMAP error %s: %s", e.Type, e.Description)
+}
+
+// wrapJMAPError returns a descriptive error, identifying auth failures (401/403) separately.
+func (s *JMAPService) wrapJMAPError(err error, action, mailID string) error {
+	ctx := action
+	if mailID != "" {
+		ctx = fmt.Sprintf("%s (mail %s)", action, mailID)
+	}
+	var sErr *jmapStatusError
+	if errors.As(err, &sErr) && (sErr.StatusCode == 401 || sErr.StatusCode == 403) {
+		return fmt.Errorf("%s: %w — check that the token for %s grants JMAP mail read/write access",
+			ctx, err, s.cfg.SessionURL)
+	}
+	return fmt.Errorf("%s: %w", ctx, err)
+}
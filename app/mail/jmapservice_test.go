@@ -0,0 +1,289 @@
+package mail
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
+)
+
+// fakeJMAP is an httptest stand-in for a JMAP session, API and download endpoint.
+type fakeJMAP struct {
+	mu        sync.Mutex
+	seen      map[string]bool
+	mailboxes map[string]string
+	destroyed []string
+}
+
+func (f *fakeJMAP) handler(t *testing.T) http.Handler {
+	mux := http.NewServeMux()
+	auth := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer tok" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next(w, r)
+		}
+	}
+	mux.HandleFunc("GET /jmap/session", auth(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{
+			"apiUrl": "/jmap/api/",
+			"downloadUrl": "/jmap/download/{accountId}/{blobId}/{name}?type={type}",
+			"primaryAccounts": {"urn:ietf:params:jmap:mail": "acc1"}
+		}`)
+	}))
+	mux.HandleFunc("GET /jmap/download/acc1/{blob}/{name}", auth(func(w http.ResponseWriter, r *http.Request) {
+		switch r.PathValue("blob") {
+		case "blob-pdf":
+			_, _ = io.WriteString(w, "%PDF-1.4")
+		case "blob-fwd":
+			_, _ = io.WriteString(w, "From: supplier@example.com\r\nSubject: Forwarded invoice\r\n\r\nbody fwd")
+		case "blob-e1":
+			_, _ = io.WriteString(w, "Subject: Invoice e1\r\n\r\nbody e1")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	mux.HandleFunc("POST /jmap/api/", auth(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			MethodCalls [][3]json.RawMessage `json:"methodCalls"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var responses []any
+		var lastIDs []string
+		for _, c := range req.MethodCalls {
+			var name, id string
+			var args map[string]any
+			_ = json.Unmarshal(c[0], &name)
+			_ = json.Unmarshal(c[1], &args)
+			_ = json.Unmarshal(c[2], &id)
+			var result any
+			switch name {
+			case "Mailbox/query":
+				role := args["filter"].(map[string]any)["role"].(string)
+				result = map[string]any{"ids": []string{"mb-" + role}}
+			case "Email/query":
+				filter := args["filter"].(map[string]any)
+				if filter["notKeyword"] != "$seen" || filter["inMailbox"] != "mb-inbox" {
+					t.Errorf("Email/query filter = %v, want inbox and notKeyword $seen", filter)
+				}
+				lastIDs = f.unseenIDs()
+				result = map[string]any{"ids": lastIDs}
+			case "Email/get":
+				ids := lastIDs
+				if requested, ok := args["ids"].([]any); ok {
+					ids = nil
+					for _, id := range requested {
+						ids = append(ids, id.(string))
+					}
+				}
+				result = map[string]any{"list": f.emails(ids)}
+			case "Email/set":
+				result = f.set(args)
+			default:
+				name, result = "error", map[string]any{"type": "unknownMethod"}
+			}
+			responses = append(responses, []any{name, result, id})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"methodResponses": responses})
+	}))
+	return mux
+}
+
+func (f *fakeJMAP) unseenIDs() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ids := []string{}
+	for _, id := range []string{"e1", "e2"} {
+		if !f.seen[id] && f.mailboxes[id] == "mb-inbox" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (f *fakeJMAP) emails(ids []string) []any {
+	list := []any{}
+	for _, id := range ids {
+		email := map[string]any{
+			"id":                             id,
+			"blobId":                         "blob-" + id,
+			"from":                           []any{map[string]string{"name": "Vendor", "email": "vendor@example.com"}},
+			"to":                             []any{map[string]string{"email": "orders@example.com"}},
+			"cc":                             []any{map[string]string{"email": "audit@example.com"}},
+			"header:Delivered-To:asText:all": []string{"orders+invoices@example.com"},
+			"subject":                        "Invoice " + id,
+			"receivedAt":                     "2024-05-01T10:00:00Z",
+			"textBody":                       []any{map[string]string{"partId": "1", "type": "text/plain"}},
+			"bodyValues":                     map[string]any{"1": map[string]string{"value": "body " + id}},
+			"attachments":                    []any{},
+			"headers": []any{
+				map[string]string{"name": "Authentication-Results", "value": " mx.example.net;\r\n dkim=pass header.d=example.com"},
+				map[string]string{"name": "From", "value": " Vendor <vendor@example.com>"},
+			},
+		}
+		if id == "e1" {
+			email["attachments"] = []any{
+				map[string]string{"blobId": "blob-pdf", "name": "invoice.pdf", "type": "application/pdf"},
+				map[string]string{"blobId": "blob-fwd", "type": "message/rfc822"},
+				map[string]string{"name": "missing.bin", "type": "application/octet-stream"},
+			}
+		}
+		list = append(list, email)
+	}
+	return list
+}
+
+func (f *fakeJMAP) set(args map[string]any) map[string]any {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	result := map[string]any{}
+	if update, ok := args["update"].(map[string]any); ok {
+		notUpdated := map[string]any{}
+		for id, p := range update {
+			patch := p.(map[string]any)
+			if _, ok := f.mailboxes[id]; !ok {
+				notUpdated[id] = map[string]string{"type": "notFound"}
+				continue
+			}
+			if patch["keywords/$seen"] == true {
+				f.seen[id] = true
+			}
+			if mbs, ok := patch["mailboxIds"].(map[string]any); ok {
+				for mb := range mbs {
+					f.mailboxes[id] = mb
+				}
+			}
+		}
+		result["notUpdated"] = notUpdated
+	}
+	if destroy, ok := args["destroy"].([]any); ok {
+		for _, id := range destroy {
+			f.destroyed = append(f.destroyed, id.(string))
+			delete(f.mailboxes, id.(string))
+		}
+	}
+	return result
+}
+
+func newTestJMAPService(t *testing.T, deleteMode string) (*JMAPService, *fakeJMAP) {
+	t.Helper()
+	f := &fakeJMAP{seen: map[string]bool{}, mailboxes: map[string]string{"e1": "mb-inbox", "e2": "mb-inbox"}}
+	srv := httptest.NewServer(f.handler(t))
+	t.Cleanup(srv.Close)
+	svc := NewJMAPService(config.JMAPClient{
+		Enabled:    true,
+		SessionURL: srv.URL + "/jmap/session",
+		Token:      "tok",
+		Mailbox:    "inbox",
+		DeleteMode: deleteMode,
+	})
+	svc.httpClient = srv.Client()
+	return svc, f
+}
+
+func TestJMAPService_GetAllUnreadMail(t *testing.T) {
+	svc, _ := newTestJMAPService(t, "trash")
+
+	mails, err := svc.GetAllUnreadMail(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllUnreadMail() error = %v", err)
+	}
+	if len(mails) != 2 {
+		t.Fatalf("GetAllUnreadMail() returned %d mails, want 2", len(mails))
+	}
+	m := mails[0]
+	if m.Id != "e1" || m.Sender != "vendor@example.com" || m.Subject != "Invoice e1" || m.Body != "body e1" {
+		t.Errorf("mails[0] = %+v, want e1 from vendor with text body", m)
+	}
+	wantRecipients := "orders+invoices@example.com,orders@example.com,audit@example.com"
+	if got := strings.Join(m.Recipients, ","); got != wantRecipients {
+		t.Errorf("Recipients = %q, want %q", got, wantRecipients)
+	}
+	if len(m.Attachments) != 2 || m.Attachments[0].Name != "invoice.pdf" || string(m.Attachments[0].Content) != "%PDF-1.4" {
+		t.Errorf("Attachments = %+v, want invoice.pdf and the unnamed message blob", m.Attachments)
+	}
+	if len(m.Embedded) != 1 || m.Embedded[0].Subject != "Forwarded invoice" {
+		t.Errorf("Embedded = %+v, want the unnamed forwarded message", m.Embedded)
+	}
+	if !m.ReceivedAt.Equal(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("ReceivedAt = %v, want receivedAt", m.ReceivedAt)
+	}
+	if got := m.Header("Authentication-Results"); got != "mx.example.net; dkim=pass header.d=example.com" {
+		t.Errorf("Authentication-Results = %q, want the unfolded raw header", got)
+	}
+}
+
+func TestJMAPService_MarkMailAsRead(t *testing.T) {
+	svc, f := newTestJMAPService(t, "trash")
+
+	if err := svc.MarkMailAsRead(context.Background(), Mail{Id: "e1"}); err != nil {
+		t.Fatalf("MarkMailAsRead() error = %v", err)
+	}
+	if !f.seen["e1"] {
+		t.Error("expected $seen keyword on e1")
+	}
+	if err := svc.MarkMailAsRead(context.Background(), Mail{Id: "missing"}); err == nil || !strings.Contains(err.Error(), "notFound") {
+		t.Errorf("MarkMailAsRead(missing) error = %v, want notFound SetError", err)
+	}
+}
+
+func TestJMAPService_DeleteMail(t *testing.T) {
+	tests := []struct {
+		name          string
+		deleteMode    string
+		wantMailbox   string
+		wantDestroyed bool
+	}{
+		{name: "move to trash", deleteMode: "trash", wantMailbox: "mb-trash"},
+		{name: "destroy", deleteMode: "destroy", wantDestroyed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, f := newTestJMAPService(t, tt.deleteMode)
+
+			if err := svc.DeleteMail(context.Background(), Mail{Id: "e2"}); err != nil {
+				t.Fatalf("DeleteMail() error = %v", err)
+			}
+			if got := f.mailboxes["e2"]; got != tt.wantMailbox {
+				t.Errorf("mailbox of e2 = %q, want %q", got, tt.wantMailbox)
+			}
+			if got := len(f.destroyed) == 1; got != tt.wantDestroyed {
+				t.Errorf("destroyed = %v, want destroyed %v", f.destroyed, tt.wantDestroyed)
+			}
+		})
+	}
+}
+
+func TestJMAPService_authErrorIsDescriptive(t *testing.T) {
+	svc, _ := newTestJMAPService(t, "trash")
+	svc.cfg.Token = "wrong"
+
+	_, err := svc.GetAllUnreadMail(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "401") || !strings.Contains(err.Error(), "mail read/write access") {
+		t.Errorf("GetAllUnreadMail() error = %v, want descriptive 401", err)
+	}
+}
+
+func TestJMAPService_GetRawMail(t *testing.T) {
+	svc, _ := newTestJMAPService(t, "trash")
+
+	raw, err := svc.GetRawMail(context.Background(), Mail{Id: "e1"})
+	if err != nil {
+		t.Fatalf("GetRawMail() error = %v", err)
+	}
+	if string(raw) != "Subject: Invoice e1\r\n\r\nbody e1" {
+		t.Errorf("GetRawMail() = %q, want the blob of the email", raw)
+	}
+}
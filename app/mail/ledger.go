@@ -0,0 +1,91 @@
+package mail
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// idLedger persists the IDs of processed messages in a JSON file for backends that cannot flag
+// messages as read on the server or in the mailbox.
+type idLedger struct {
+	path string
+	// kind names the backend in errors and logs, e.g. "POP3".
+	kind string
+	// mu serializes read-modify-write cycles on the ledger file.
+	mu sync.Mutex
+}
+
+// record adds id to the ledger.
+func (l *idLedger) record(id string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ledger, err := l.load()
+	if err != nil {
+		return err
+	}
+	ledger[id] = true
+	return l.save(ledger)
+}
+
+// load reads the set of processed IDs; a missing file yields an empty set.
+func (l *idLedger) load() (map[string]bool, error) {
+	ledger := make(map[string]bool)
+	b, err := os.ReadFile(filepath.Clean(l.path)) // #nosec G304 -- path comes from trusted configuration
+	if errors.Is(err, os.ErrNotExist) {
+		return ledger, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s ledger %s: %w", l.kind, l.path, err)
+	}
+	var ids []string
+	if err := json.Unmarshal(b, &ids); err != nil {
+		return nil, fmt.Errorf("failed to parse %s ledger %s: %w", l.kind, l.path, err)
+	}
+	for _, id := range ids {
+		ledger[id] = true
+	}
+	return ledger, nil
+}
+
+// save atomically replaces the ledger file with the given set.
+func (l *idLedger) save(ledger map[string]bool) error {
+	ids := make([]string, 0, len(ledger))
+	for id := range ledger {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	b, err := json.MarshalIndent(ids, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return fmt.Errorf("failed to write %s ledger %s: %w", l.kind, tmp, err)
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return fmt.Errorf("failed to replace %s ledger %s: %w", l.kind, l.path, err)
+	}
+	return nil
+}
+
+// prune drops IDs no longer present in the mailbox so the ledger does not grow unbounded.
+func (l *idLedger) prune(ledger map[string]bool, present map[string]bool) {
+	changed := false
+	for id := range ledger {
+		if !present[id] {
+			delete(ledger, id)
+			changed = true
+		}
+	}
+	if changed {
+		if err := l.save(ledger); err != nil {
+			slog.Warn("could not prune ledger", "kind", l.kind, "path", l.path, "error", err)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/mail/message"
+)
+
+// maildirInfoSeparator separates the unique name from the info ("2,FLAGS") part of a Maildir filename.
+const maildirInfoSeparator = ":2,"
+
+// MaildirService implements MailClientService on a local Maildir.
+// Unread mails are all files in new/ plus files in cur/ without the S (seen) or T (trashed) flag.
+// Mail.Id holds the unique part of the Maildir filename.
+type MaildirService struct {
+	root string
+}
+
+// NewMaildirService creates a MaildirService for the Maildir rooted at root.
+func NewMaildirService(root string) *MaildirService {
+	return &MaildirService{root: root}
+}
+
+func (s *MaildirService) GetAllUnreadMail(_ context.Context) ([]Mail, error) {
+	var result []Mail
+	for _, sub := range []string{"new", "cur"} {
+		entries, err := os.ReadDir(filepath.Join(s.root, sub))
+		if err != nil {
+			return nil, fmt.Errorf("list maildir %s: %w", filepath.Join(s.root, sub), err)
+		}
+		names := make([]string, 0, len(entries))
+		for _, e := range entries {
+			if e.Type().IsRegular() && !strings.HasPrefix(e.Name(), ".") {
+				names = append(names, e.Name())
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			unique, flags := splitMaildirName(name)
+			if strings.ContainsAny(flags, "ST") {
+				continue
+			}
+			path := filepath.Join(s.root, sub, name)
+			m, err := s.readMail(unique, path)
+			if err != nil {
+				slog.Error("error reading maildir message", "path", path, "error", err)
+				continue
+			}
+			result = append(result, m)
+		}
+	}
+	if result == nil {
+		result = []Mail{}
+	}
+	return result, nil
+}
+
+// MarkMailAsRead moves the message to cur/ and adds the S flag.
+func (s *MaildirService) MarkMailAsRead(_ context.Context, mail Mail) error {
+	path, flags, err := s.locate(mail.Id)
+	if err != nil {
+		return fmt.Errorf("mark message as read (mail %s): %w", mail.Id, err)
+	}
+	target := filepath.Join(s.root, "cur", mail.Id+maildirInfoSeparator+addMaildirFlag(flags, 'S'))
+	if err := os.Rename(path, target); err != nil {
+		return fmt.Errorf("mark message as read (mail %s): %w", mail.Id, err)
+	}
+	return nil
+}
+
+// DeleteMail unlinks the message file.
+func (s *MaildirService) DeleteMail(_ context.Context, mail Mail) error {
+	path, _, err := s.locate(mail.Id)
+	if err != nil {
+		return fmt.Errorf("delete message (mail %s): %w", mail.Id, err)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("delete message (mail %s): %w", mail.Id, err)
+	}
+	return nil
+}
+
+func (s *MaildirService) readMail(unique, path string) (Mail, error) {
+	raw, err := os.ReadFile(filepath.Clean(path)) // #nosec G304 -- path is listed from the configured maildir
+	if err != nil {
+		return Mail{}, err
+	}
+	m, err := message.Parse(unique, raw)
+	if err != nil {
+		return Mail{}, err
+	}
+	if m.ReceivedAt.IsZero() {
+		if info, err := os.Stat(path); err == nil {
+			m.ReceivedAt = info.ModTime().UTC()
+		}
+	}
+	return m, nil
+}
+
+// locate finds the current path and flags of the message with the given unique name.
+func (s *MaildirService) locate(unique string) (string, string, error) {
+	if unique == "" || strings.ContainsAny(unique, `/\`) {
+		return "", "", fmt.Errorf("invalid maildir id %q", unique)
+	}
+	if path := filepath.Join(s.root, "new", unique); fileExists(path) {
+		return path, "", nil
+	}
+	matches, err := filepath.Glob(filepath.Join(s.root, "cur", globEscape(unique)+maildirInfoSeparator+"*"))
+	if err != nil {
+		return "", "", err
+	}
+	if len(matches) == 0 {
+		if path := filepath.Join(s.root, "cur", unique); fileExists(path) {
+			return path, "", nil
+		}
+		return "", "", fmt.Errorf("message not found in maildir %s", s.root)
+	}
+	_, flags := splitMaildirName(filepath.Base(matches[0]))
+	return matches[0], flags, nil
+}
+
+// splitMaildirName splits a Maildir filename into its unique part and flags.
+func splitMaildirName(name string) (unique, flags string) {
+	if i := strings.LastIndex(name, maildirInfoSeparator); i >= 0 {
+		return name[:i], name[i+len(maildirInfoSeparator):]
+	}
+	return name, ""
+}
+
+// addMaildirFlag returns flags with f added, keeping the ASCII order required by the Maildir spec.
+func addMaildirFlag(flags string, f rune) string {
+	if strings.ContainsRune(flags, f) {
+		return flags
+	}
+	b := []byte(flags + string(f))
+	sort.Slice(b, func(i, j int) bool { return b[i] < b[j] })
+	return string(b)
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// globEscape escapes glob metacharacters in s.
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
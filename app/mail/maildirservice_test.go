@@ -0,0 +1,85 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestMaildir(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, sub := range []string{"new", "cur", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(root, sub), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(rel, content string) {
+		if err := os.WriteFile(filepath.Join(root, rel), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("new/1700000000.M1.host", "From: a@example.com\r\nSubject: fresh\r\n\r\nnew body\r\n")
+	write("cur/1700000001.M2.host:2,F", "From: b@example.com\r\nSubject: flagged unread\r\n\r\ncur body\r\n")
+	write("cur/1700000002.M3.host:2,S", "From: c@example.com\r\nSubject: already seen\r\n\r\nseen\r\n")
+	write("cur/1700000003.M4.host:2,ST", "From: d@example.com\r\nSubject: trashed\r\n\r\ntrash\r\n")
+	return root
+}
+
+func TestMaildirService_GetAllUnreadMail(t *testing.T) {
+	svc := NewMaildirService(newTestMaildir(t))
+
+	mails, err := svc.GetAllUnreadMail(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllUnreadMail() error = %v", err)
+	}
+	if len(mails) != 2 {
+		t.Fatalf("GetAllUnreadMail() returned %d mails, want 2: %+v", len(mails), mails)
+	}
+	if mails[0].Id != "1700000000.M1.host" || mails[0].Subject != "fresh" {
+		t.Errorf("mails[0] = %q/%q, want new/ message", mails[0].Id, mails[0].Subject)
+	}
+	if mails[1].Id != "1700000001.M2.host" || mails[1].Sender != "b@example.com" {
+		t.Errorf("mails[1] = %q/%q, want unseen cur/ message", mails[1].Id, mails[1].Sender)
+	}
+	if mails[0].ReceivedAt.IsZero() {
+		t.Error("ReceivedAt should fall back to the file modification time")
+	}
+}
+
+func TestMaildirService_MarkMailAsRead(t *testing.T) {
+	root := newTestMaildir(t)
+	svc := NewMaildirService(root)
+
+	for _, id := range []string{"1700000000.M1.host", "1700000001.M2.host"} {
+		if err := svc.MarkMailAsRead(context.Background(), Mail{Id: id}); err != nil {
+			t.Fatalf("MarkMailAsRead(%s) error = %v", id, err)
+		}
+	}
+	if !fileExists(filepath.Join(root, "cur", "1700000000.M1.host:2,S")) {
+		t.Error("new/ message was not moved to cur/ with the S flag")
+	}
+	if !fileExists(filepath.Join(root, "cur", "1700000001.M2.host:2,FS")) {
+		t.Error("cur/ message did not keep F and gain S in ASCII order")
+	}
+	mails, err := svc.GetAllUnreadMail(context.Background())
+	if err != nil || len(mails) != 0 {
+		t.Errorf("GetAllUnreadMail() after markRead = %d mails, %v; want 0, nil", len(mails), err)
+	}
+}
+
+func TestMaildirService_DeleteMail(t *testing.T) {
+	root := newTestMaildir(t)
+	svc := NewMaildirService(root)
+
+	if err := svc.DeleteMail(context.Background(), Mail{Id: "1700000001.M2.host"}); err != nil {
+		t.Fatalf("DeleteMail() error = %v", err)
+	}
+	if fileExists(filepath.Join(root, "cur", "1700000001.M2.host:2,F")) {
+		t.Error("message file still exists after delete")
+	}
+	if err := svc.DeleteMail(context.Background(), Mail{Id: "../escape"}); err == nil {
+		t.Error("DeleteMail() must reject ids containing path separators")
+	}
+}
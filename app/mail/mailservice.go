@@ -1,9 +1,14 @@
+// Package mail defines the mail client backends, the processed actions applied to them and sender
+// authentication. Mails are represented by the types of package message, which also parses raw
+// RFC 5322 messages.
 package mail
 
 import (
 	"context"
 	"fmt"
-	"time"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
+	"github.com/jo-hoe/go-mail-webhook-service/app/mail/message"
 )
 
 // ClientType identifies a mail client backend.
@@ -12,6 +17,16 @@ type ClientType string
 const (
 	// GmailClientType selects the Google Gmail backend.
 	GmailClientType ClientType = "gmail"
+	// IMAPClientType selects the generic IMAP backend.
+	IMAPClientType ClientType = "imap"
+	// POP3ClientType selects the POP3 backend with a local UIDL ledger.
+	POP3ClientType ClientType = "pop3"
+	// FilesystemClientType selects a local Maildir or mbox backend.
+	FilesystemClientType ClientType = "filesystem"
+	// GraphClientType selects the Microsoft Graph (Outlook / Exchange Online) backend.
+	GraphClientType ClientType = "graph"
+	// JMAPClientType selects the JMAP (RFC 8620/8621) backend.
+	JMAPClientType ClientType = "jmap"
 
 	// DefaultCredentialsPath is the default path for mounted OAuth credentials.
 	DefaultCredentialsPath = "/secrets/mail"
@@ -24,29 +39,76 @@ type MailClientService interface {
 	DeleteMail(ctx context.Context, mail Mail) error
 }
 
-// Attachment represents a single email attachment.
-type Attachment struct {
-	Name    string
-	Content []byte
+// RawMailLoader is implemented by backends that can download the unmodified RFC 822 source of a
+// mail fetched without it (Mail.Raw is empty), e.g. Gmail via format=raw.
+type RawMailLoader interface {
+	GetRawMail(ctx context.Context, m Mail) ([]byte, error)
+}
+
+// Checkpointer is implemented by backends that track sync progress themselves instead of relying
+// on the read state of mails, or that defer work until a run has finished, e.g. POP3 deletions.
+// CommitCheckpoint is called after the mails of the last
+// GetAllUnreadMail call have been processed; retry holds the mails whose delivery failed,
+// which must be returned again by the next fetch.
+type Checkpointer interface {
+	CommitCheckpoint(ctx context.Context, retry []Mail) error
+}
+
+// MetadataFetcher is implemented by backends that can list mails with headers only, so that
+// bodies and attachments are downloaded just for mails passing the header selectors.
+type MetadataFetcher interface {
+	// GetAllUnreadMailMetadata returns the mails of GetAllUnreadMail without Body and Attachments.
+	GetAllUnreadMailMetadata(ctx context.Context) ([]Mail, error)
+	// LoadMailContent returns m with its body and, when withAttachments is set, its attachments.
+	LoadMailContent(ctx context.Context, m Mail, withAttachments bool) (Mail, error)
 }
 
-// Mail represents an email message.
-type Mail struct {
-	Id          string
-	Sender      string
-	Recipients  []string
-	Subject     string
-	Body        string
-	Attachments []Attachment
-	ReceivedAt  time.Time
+// Attachment, Header and Mail are defined in package message together with the parser, so that
+// mail and the packages using it share one set of types.
+type (
+	Attachment = message.Attachment
+	Header     = message.Header
+	Mail       = message.Mail
+)
+
+// ClientTypeFromConfig returns the ClientType of the enabled client in cfg.
+func ClientTypeFromConfig(cfg config.MailClient) ClientType {
+	switch {
+	case cfg.IMAP.Enabled:
+		return IMAPClientType
+	case cfg.POP3.Enabled:
+		return POP3ClientType
+	case cfg.Filesystem.Enabled:
+		return FilesystemClientType
+	case cfg.Graph.Enabled:
+		return GraphClientType
+	case cfg.JMAP.Enabled:
+		return JMAPClientType
+	default:
+		return GmailClientType
+	}
 }
 
-// NewMailClientService returns a MailClientService for the given client type.
+// NewMailClientService returns a MailClientService for the given client type,
+// configured from the matching section of cfg.
 // An empty ClientType defaults to GmailClientType.
-func NewMailClientService(clientType ClientType) (MailClientService, error) {
+func NewMailClientService(clientType ClientType, cfg config.MailClient) (MailClientService, error) {
 	switch clientType {
 	case GmailClientType, "":
-		return NewGmailService(DefaultCredentialsPath), nil
+		return NewGmailService(cfg.Gmail), nil
+	case IMAPClientType:
+		return NewIMAPService(cfg.IMAP), nil
+	case POP3ClientType:
+		return NewPOP3Service(cfg.POP3), nil
+	case FilesystemClientType:
+		if cfg.Filesystem.Format == "mbox" {
+			return NewMboxService(cfg.Filesystem.Path, cfg.Filesystem.LedgerPath), nil
+		}
+		return NewMaildirService(cfg.Filesystem.Path), nil
+	case GraphClientType:
+		return NewGraphService(cfg.Graph), nil
+	case JMAPClientType:
+		return NewJMAPService(cfg.JMAP), nil
 	default:
 		return nil, fmt.Errorf("unsupported mail client type: %s", clientType)
 	}
@@ -3,12 +3,15 @@ package mail
 import (
 	"reflect"
 	"testing"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
 )
 
 func TestNewMailClientService(t *testing.T) {
 	tests := []struct {
 		name       string
 		clientType ClientType
+		cfg        config.MailClient
 		want       MailClientService
 		wantErr    bool
 	}{
@@ -18,26 +21,81 @@ func TestNewMailClientService(t *testing.T) {
 			want:       &GmailService{credentialsPath: DefaultCredentialsPath},
 			wantErr:    false,
 		},
+		{
+			name:       "gmail account uses its own credentials path and query",
+			clientType: GmailClientType,
+			cfg:        config.MailClient{Gmail: config.GmailClient{Enabled: true, CredentialsPath: "/secrets/orders", Query: "is:unread label:orders"}},
+			want:       &GmailService{credentialsPath: "/secrets/orders", query: "is:unread label:orders"},
+			wantErr:    false,
+		},
 		{
 			name:       "empty type defaults to gmail",
 			clientType: "",
 			want:       &GmailService{credentialsPath: DefaultCredentialsPath},
 			wantErr:    false,
 		},
+		{
+			name:       "imap returns service with configured client",
+			clientType: IMAPClientType,
+			cfg:        config.MailClient{IMAP: config.IMAPClient{Enabled: true, Host: "imap.example.com"}},
+			want:       &IMAPService{cfg: config.IMAPClient{Enabled: true, Host: "imap.example.com"}},
+			wantErr:    false,
+		},
+		{
+			name:       "pop3 returns service with configured client",
+			clientType: POP3ClientType,
+			cfg:        config.MailClient{POP3: config.POP3Client{Enabled: true, Host: "pop.example.com"}},
+			want:       NewPOP3Service(config.POP3Client{Enabled: true, Host: "pop.example.com"}),
+			wantErr:    false,
+		},
+		{
+			name:       "filesystem returns maildir service by default",
+			clientType: FilesystemClientType,
+			cfg:        config.MailClient{Filesystem: config.FilesystemClient{Enabled: true, Format: "maildir", Path: "/var/mail/orders"}},
+			want:       &MaildirService{root: "/var/mail/orders"},
+			wantErr:    false,
+		},
+		{
+			name:       "filesystem returns mbox service for mbox format",
+			clientType: FilesystemClientType,
+			cfg:        config.MailClient{Filesystem: config.FilesystemClient{Enabled: true, Format: "mbox", Path: "/var/mail/orders.mbox", LedgerPath: "/data/mbox-ledger.json"}},
+			want:       NewMboxService("/var/mail/orders.mbox", "/data/mbox-ledger.json"),
+			wantErr:    false,
+		},
+		{
+			name:       "graph returns service with configured client",
+			clientType: GraphClientType,
+			cfg:        config.MailClient{Graph: config.GraphClient{Enabled: true, User: "orders@example.com"}},
+			want:       &GraphService{cfg: config.GraphClient{Enabled: true, User: "orders@example.com"}},
+			wantErr:    false,
+		},
+		{
+			name:       "jmap returns service with configured client",
+			clientType: JMAPClientType,
+			cfg:        config.MailClient{JMAP: config.JMAPClient{Enabled: true, SessionURL: "https://api.fastmail.com/jmap/session"}},
+			want:       &JMAPService{cfg: config.JMAPClient{Enabled: true, SessionURL: "https://api.fastmail.com/jmap/session"}},
+			wantErr:    false,
+		},
 		{
 			name:       "unsupported type returns error",
-			clientType: "imap",
+			clientType: "carrierPigeon",
 			want:       nil,
 			wantErr:    true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := NewMailClientService(tt.clientType)
+			got, err := NewMailClientService(tt.clientType, tt.cfg)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("NewMailClientService() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if g, ok := got.(*GmailService); ok {
+				if g.limiter == nil {
+					t.Errorf("NewMailClientService() did not set up the Gmail rate limiter")
+				}
+				g.limiter = nil
+			}
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("NewMailClientService() = %v, want %v", got, tt.want)
 			}
@@ -0,0 +1,144 @@
+package mail
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	gomail "net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/mail/message"
+)
+
+// mboxEscapedFromRegex matches mboxrd-quoted "From " lines (">From ", ">>From ", ...).
+var mboxEscapedFromRegex = regexp.MustCompile(`^>+From `)
+
+// MboxService implements MailClientService on a local mbox file without modifying it.
+// Messages whose Status header contains R are treated as read and skipped; processed messages
+// are tracked by ID in a ledger file instead.
+// Mail.Id holds the Message-ID, or "mbox-<n>" (1-based position) when absent.
+type MboxService struct {
+	path   string
+	ledger *idLedger
+}
+
+// NewMboxService creates an MboxService reading the mbox file at path and recording processed
+// messages in the ledger file at ledgerPath.
+func NewMboxService(path, ledgerPath string) *MboxService {
+	return &MboxService{path: path, ledger: &idLedger{path: ledgerPath, kind: "mbox"}}
+}
+
+func (s *MboxService) GetAllUnreadMail(_ context.Context) ([]Mail, error) {
+	f, err := os.Open(filepath.Clean(s.path)) // #nosec G304 -- path comes from trusted configuration
+	if err != nil {
+		return nil, fmt.Errorf("open mbox %s: %w", s.path, err)
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil {
+			slog.Error("error closing mbox file", "error", cerr)
+		}
+	}()
+
+	raws, err := splitMbox(f)
+	if err != nil {
+		return nil, fmt.Errorf("read mbox %s: %w", s.path, err)
+	}
+
+	s.ledger.mu.Lock()
+	defer s.ledger.mu.Unlock()
+	ledger, err := s.ledger.load()
+	if err != nil {
+		return nil, err
+	}
+	present := make(map[string]bool, len(raws))
+	result := make([]Mail, 0, len(raws))
+	for i, raw := range raws {
+		id := "mbox-" + strconv.Itoa(i+1)
+		read := false
+		if msg, err := gomail.ReadMessage(bytes.NewReader(raw)); err == nil {
+			read = strings.Contains(msg.Header.Get("Status"), "R")
+			if mid := strings.Trim(strings.TrimSpace(msg.Header.Get("Message-ID")), "<>"); mid != "" {
+				id = mid
+			}
+		}
+		present[id] = true
+		if read || ledger[id] {
+			continue
+		}
+		m, err := message.Parse(id, raw)
+		if err != nil {
+			slog.Error("error parsing mbox message", "index", i+1, "error", err)
+			continue
+		}
+		result = append(result, m)
+	}
+	s.ledger.prune(ledger, present)
+	return result, nil
+}
+
+// MarkMailAsRead records the mail's ID in the ledger so that it is skipped on later runs.
+func (s *MboxService) MarkMailAsRead(_ context.Context, mail Mail) error {
+	if err := s.ledger.record(mail.Id); err != nil {
+		return fmt.Errorf("mark message as read (mail %s): %w", mail.Id, err)
+	}
+	return nil
+}
+
+// DeleteMail records the mail's ID in the ledger like MarkMailAsRead; the mbox file itself is
+// never modified, so the message stays in it.
+func (s *MboxService) DeleteMail(_ context.Context, mail Mail) error {
+	if err := s.ledger.record(mail.Id); err != nil {
+		return fmt.Errorf("delete message (mail %s): %w", mail.Id, err)
+	}
+	return nil
+}
+
+// splitMbox splits an mbox stream into raw RFC 5322 messages, dropping the
+// "From " separator lines and undoing mboxrd ">From " quoting.
+func splitMbox(f *os.File) ([][]byte, error) {
+	var (
+		messages [][]byte
+		current  *bytes.Buffer
+	)
+	// finish stores the current message without the blank line that precedes the next separator.
+	finish := func() {
+		if current == nil {
+			return
+		}
+		b := current.Bytes()
+		if bytes.HasSuffix(b, []byte("\r\n\r\n")) {
+			b = b[:len(b)-2]
+		}
+		messages = append(messages, b)
+	}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "From ") {
+			finish()
+			current = &bytes.Buffer{}
+			continue
+		}
+		if current == nil {
+			// Content before the first separator is not part of any message.
+			continue
+		}
+		if mboxEscapedFromRegex.MatchString(line) {
+			line = line[1:]
+		}
+		current.WriteString(strings.TrimSuffix(line, "\r"))
+		current.WriteString("\r\n")
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	finish()
+	return messages, nil
+}
@@ -0,0 +1,99 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMboxService(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inbox.mbox")
+	content := "From alice@example.com Thu Jan  1 00:00:00 2024\n" +
+		"From: alice@example.com\n" +
+		"Subject: first\n" +
+		"Message-ID: <one@example.com>\n" +
+		"\n" +
+		">From the archive\n" +
+		"\n" +
+		"From bob@example.com Thu Jan  1 00:00:01 2024\n" +
+		"From: bob@example.com\n" +
+		"Subject: already read\n" +
+		"Status: RO\n" +
+		"\n" +
+		"read\n" +
+		"\n" +
+		"From carol@example.com Thu Jan  1 00:00:02 2024\n" +
+		"From: carol@example.com\n" +
+		"Subject: no id\n" +
+		"\n" +
+		"third\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ledgerPath := filepath.Join(t.TempDir(), "ledger.json")
+	svc := NewMboxService(path, ledgerPath)
+
+	mails, err := svc.GetAllUnreadMail(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllUnreadMail() error = %v", err)
+	}
+	if len(mails) != 2 {
+		t.Fatalf("GetAllUnreadMail() returned %d mails, want 2", len(mails))
+	}
+	if mails[0].Id != "one@example.com" || mails[0].Body != "From the archive\r\n" {
+		t.Errorf("mails[0] = %q/%q, want Message-ID and unquoted body", mails[0].Id, mails[0].Body)
+	}
+	if mails[1].Id != "mbox-3" || mails[1].Subject != "no id" {
+		t.Errorf("mails[1] = %q/%q, want positional id", mails[1].Id, mails[1].Subject)
+	}
+
+	if err := svc.MarkMailAsRead(context.Background(), mails[0]); err != nil {
+		t.Fatalf("MarkMailAsRead() error = %v", err)
+	}
+	if err := svc.DeleteMail(context.Background(), mails[1]); err != nil {
+		t.Fatalf("DeleteMail() error = %v", err)
+	}
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != content {
+		t.Errorf("mbox file was modified")
+	}
+
+	// A fresh service instance must honour the ledger written by the previous one.
+	mails, err = NewMboxService(path, ledgerPath).GetAllUnreadMail(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllUnreadMail() error = %v", err)
+	}
+	if len(mails) != 0 {
+		t.Errorf("GetAllUnreadMail() = %+v, want no mails after processing", mails)
+	}
+}
+
+func TestMboxService_ledgerPrunesMissingIDs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inbox.mbox")
+	content := "From alice@example.com Thu Jan  1 00:00:00 2024\n" +
+		"Message-ID: <one@example.com>\n" +
+		"\n" +
+		"body\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ledgerPath := filepath.Join(t.TempDir(), "ledger.json")
+	if err := os.WriteFile(ledgerPath, []byte(`["gone@example.com","one@example.com"]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	svc := NewMboxService(path, ledgerPath)
+	if _, err := svc.GetAllUnreadMail(context.Background()); err != nil {
+		t.Fatalf("GetAllUnreadMail() error = %v", err)
+	}
+	ledger, err := svc.ledger.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ledger["gone@example.com"] || !ledger["one@example.com"] {
+		t.Errorf("ledger = %v, want only one@example.com", ledger)
+	}
+}
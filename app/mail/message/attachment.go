@@ -0,0 +1,44 @@
+package message
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+// NewAttachment builds an Attachment and derives Size and SHA256 from content. An empty
+// contentType is guessed from the filename extension.
+func NewAttachment(name string, content []byte, contentType, contentID string, inline bool) Attachment {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = mediaType
+	} else {
+		contentType = ""
+	}
+	if contentType == "" {
+		if guessed, _, err := mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(name))); err == nil {
+			contentType = guessed
+		}
+	}
+	sum := sha256.Sum256(content)
+	return Attachment{
+		Name:        name,
+		Content:     content,
+		ContentType: contentType,
+		ContentID:   strings.Trim(strings.TrimSpace(contentID), "<>"),
+		Inline:      inline,
+		Size:        int64(len(content)),
+		SHA256:      hex.EncodeToString(sum[:]),
+	}
+}
+
+// AttachmentFromPart builds the Attachment of a MIME part from its Content-Type, Content-ID and
+// Content-Disposition headers. Parts without a disposition but with a Content-ID are embedded
+// in the HTML body (multipart/related) and count as inline.
+func AttachmentFromPart(name string, content []byte, h PartHeader) Attachment {
+	contentID := h.Get("Content-ID")
+	disposition, _, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	inline := disposition == "inline" || (disposition == "" && strings.TrimSpace(contentID) != "")
+	return NewAttachment(name, content, h.Get("Content-Type"), contentID, inline)
+}
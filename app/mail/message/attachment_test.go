@@ -0,0 +1,43 @@
+package message
+
+import (
+	"testing"
+)
+
+func TestParse_attachmentMetadata(t *testing.T) {
+	raw := "From: shop@example.com\r\n" +
+		"Content-Type: multipart/mixed; boundary=outer\r\n\r\n" +
+		"--outer\r\nContent-Type: multipart/related; boundary=inner\r\n\r\n" +
+		"--inner\r\nContent-Type: text/html\r\n\r\n<img src=\"cid:logo@example.com\">\r\n" +
+		"--inner\r\nContent-Type: image/png; name=\"logo.png\"\r\nContent-ID: <logo@example.com>\r\n" +
+		"Content-Transfer-Encoding: base64\r\n\r\ncG5n\r\n" +
+		"--inner--\r\n" +
+		"--outer\r\nContent-Type: application/pdf\r\n" +
+		"Content-Disposition: attachment; filename=\"invoice.pdf\"\r\n\r\n%PDF-\r\n" +
+		"--outer--\r\n"
+
+	m, err := Parse("1", []byte(raw))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want := []Attachment{
+		{
+			Name: "logo.png", Content: []byte("png"), ContentType: "image/png", ContentID: "logo@example.com", Inline: true, Size: 3,
+			SHA256: "8f8cbb7dcf46e0bc7d53265749a6c17d116093a6ba95e442764060c76fd4a86c",
+		},
+		{
+			Name: "invoice.pdf", Content: []byte("%PDF-"), ContentType: "application/pdf", Size: 5,
+			SHA256: "38523c087796e5d5dd1cf9bad1fb026781a838dd9dd2cf8af58b9f6502a46778",
+		},
+	}
+	if len(m.Attachments) != len(want) {
+		t.Fatalf("Attachments = %+v, want %d", m.Attachments, len(want))
+	}
+	for i, a := range m.Attachments {
+		w := want[i]
+		if a.Name != w.Name || string(a.Content) != string(w.Content) || a.ContentType != w.ContentType ||
+			a.ContentID != w.ContentID || a.Inline != w.Inline || a.Size != w.Size || a.SHA256 != w.SHA256 {
+			t.Errorf("Attachments[%d] = %+v, want %+v", i, a, w)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package message
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	htmlcharset "golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	textunicode "golang.org/x/text/encoding/unicode"
+)
+
+// DecodeText converts the content of a text part to UTF-8. label is the charset parameter of the
+// part's Content-Type; when it is missing, unknown or claims UTF-8/US-ASCII for content that is
+// not valid UTF-8, the charset is detected from the content instead.
+func DecodeText(data []byte, mediaType, label string) string {
+	enc := lookupCharset(label)
+	if enc == nil || (isUTF8Label(label) && !utf8.Valid(data)) {
+		enc = detectCharset(data, mediaType)
+	}
+	if enc == nil {
+		return strings.ToValidUTF8(string(bytes.TrimPrefix(data, utf8BOM)), "\uFFFD")
+	}
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		slog.Warn("error decoding text part", "charset", label, "error", err)
+		return strings.ToValidUTF8(string(data), "\uFFFD")
+	}
+	return string(decoded)
+}
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// lookupCharset returns the encoding for a MIME charset label, nil for UTF-8, US-ASCII and
+// unknown labels. Labels are resolved like browsers do, so ISO-8859-1 decodes as Windows-1252.
+func lookupCharset(label string) encoding.Encoding {
+	label = strings.TrimSpace(label)
+	if label == "" || isUTF8Label(label) {
+		return nil
+	}
+	enc, _ := htmlcharset.Lookup(label)
+	return enc
+}
+
+func isUTF8Label(label string) bool {
+	switch strings.ToLower(strings.TrimSpace(label)) {
+	case "utf-8", "utf8", "us-ascii", "ascii":
+		return true
+	default:
+		return false
+	}
+}
+
+// detectCharset guesses the encoding of undeclared text: a byte order mark, an HTML meta
+// declaration, valid UTF-8 (nil), Japanese encodings when the text decodes to kana, and
+// Windows-1252 (a superset of ISO-8859-1) otherwise.
+func detectCharset(data []byte, mediaType string) encoding.Encoding {
+	switch {
+	case bytes.HasPrefix(data, utf8BOM):
+		return nil
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}), bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return textunicode.UTF16(textunicode.BigEndian, textunicode.ExpectBOM)
+	}
+	if mediaType == "text/html" {
+		if enc, name, _ := htmlcharset.DetermineEncoding(data, ""); name != "utf-8" && name != "windows-1252" {
+			return enc
+		}
+	}
+	if utf8.Valid(data) {
+		return nil
+	}
+	if bytes.Contains(data, []byte("\x1b$B")) || bytes.Contains(data, []byte("\x1b$@")) {
+		return japanese.ISO2022JP
+	}
+	for _, enc := range []encoding.Encoding{japanese.ShiftJIS, japanese.EUCJP} {
+		if looksJapanese(enc, data) {
+			return enc
+		}
+	}
+	return charmap.Windows1252
+}
+
+// looksJapanese reports whether data decodes without errors under enc and at least a third of
+// the non-ASCII characters are kana, which Japanese prose always contains.
+func looksJapanese(enc encoding.Encoding, data []byte) bool {
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return false
+	}
+	var nonASCII, kana int
+	for _, r := range string(decoded) {
+		switch {
+		case r == utf8.RuneError:
+			return false
+		case r < utf8.RuneSelf:
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			nonASCII++
+			kana++
+		default:
+			nonASCII++
+		}
+	}
+	return kana > 0 && kana*3 >= nonASCII
+}
+
+// charsetReader lets mime.WordDecoder decode RFC 2047 encoded words in any known charset.
+func charsetReader(label string, input io.Reader) (io.Reader, error) {
+	enc := lookupCharset(label)
+	if enc == nil {
+		if isUTF8Label(label) {
+			return input, nil
+		}
+		return nil, fmt.Errorf("unsupported charset %q", label)
+	}
+	return enc.NewDecoder().Reader(input), nil
+}
+
+// HeaderParam returns parameter key of a structured header value such as Content-Disposition.
+// RFC 2231 extended and continued parameters are decoded in any charset, since mime.ParseMediaType
+// drops values in charsets other than UTF-8 and US-ASCII, and RFC 2047 encoded words are decoded.
+func HeaderParam(value, key string) string {
+	if strings.Contains(strings.ToLower(value), key+"*") {
+		if v := rfc2231Param(value, key); v != "" {
+			return v
+		}
+	}
+	if _, params, err := mime.ParseMediaType(value); err == nil {
+		return DecodeHeaderValue(params[key])
+	}
+	return ""
+}
+
+// rfc2231Param reassembles the sections key*0, key*1*, ... (or the single key*) of an RFC 2231
+// parameter and decodes them from the charset declared in the first section.
+func rfc2231Param(value, key string) string {
+	type section struct {
+		n       int
+		encoded bool
+		value   string
+	}
+	var sections []section
+	for _, p := range SplitHeaderParams(value) {
+		k, v, ok := strings.Cut(p, "=")
+		k = strings.ToLower(strings.TrimSpace(k))
+		if !ok || !strings.HasPrefix(k, key+"*") {
+			continue
+		}
+		rest := k[len(key)+1:]
+		s := section{encoded: rest == "" || strings.HasSuffix(rest, "*"), value: UnquoteParam(strings.TrimSpace(v))}
+		if rest = strings.TrimSuffix(rest, "*"); rest != "" {
+			n, err := strconv.Atoi(rest)
+			if err != nil {
+				continue
+			}
+			s.n = n
+		}
+		sections = append(sections, s)
+	}
+	if len(sections) == 0 {
+		return ""
+	}
+	sort.SliceStable(sections, func(i, j int) bool { return sections[i].n < sections[j].n })
+
+	var label string
+	var raw []byte
+	for i, s := range sections {
+		v := s.value
+		if i == 0 && s.encoded {
+			parts := strings.SplitN(v, "'", 3)
+			if len(parts) == 3 {
+				label, v = parts[0], parts[2]
+			}
+		}
+		if s.encoded {
+			if unescaped, err := url.PathUnescape(v); err == nil {
+				v = unescaped
+			}
+		}
+		raw = append(raw, v...)
+	}
+	return DecodeText(raw, "", label)
+}
+
+// SplitHeaderParams splits a structured header value at semicolons outside quoted strings.
+func SplitHeaderParams(value string) []string {
+	var params []string
+	var cur strings.Builder
+	quoted, escaped := false, false
+	for _, r := range value {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quoted:
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case r == ';' && !quoted:
+			params = append(params, cur.String())
+			cur.Reset()
+			continue
+		}
+		cur.WriteRune(r)
+	}
+	return append(params, cur.String())
+}
+
+// UnquoteParam removes the quotes and backslash escapes of an RFC 822 quoted string.
+func UnquoteParam(v string) string {
+	if len(v) < 2 || v[0] != '"' || v[len(v)-1] != '"' {
+		return v
+	}
+	var b strings.Builder
+	escaped := false
+	for _, r := range v[1 : len(v)-1] {
+		if r == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
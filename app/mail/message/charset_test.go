@@ -0,0 +1,105 @@
+package message
+
+import (
+	"testing"
+)
+
+func TestDecodeText(t *testing.T) {
+	const shiftJIS = "\x82\xb1\x82\xf1\x82\xc9\x82\xbf\x82\xcd\x81A\x92\x8d\x95\xb6\x82\xc5\x82\xb7"
+	tests := []struct {
+		name      string
+		data      string
+		mediaType string
+		charset   string
+		want      string
+	}{
+		{name: "utf-8", data: "Grüße", charset: "utf-8", want: "Grüße"},
+		{name: "iso-8859-1", data: "Gr\xfc\xdfe", charset: "ISO-8859-1", want: "Grüße"},
+		{name: "windows-1252 euro sign", data: "\x80 5", charset: "windows-1252", want: "€ 5"},
+		{name: "shift_jis", data: shiftJIS, charset: "Shift_JIS", want: "こんにちは、注文です"},
+		{name: "iso-2022-jp", data: "\x1b$B$3$s$K$A$O\x1b(B", charset: "iso-2022-jp", want: "こんにちは"},
+		{name: "undeclared utf-8", data: "Grüße", want: "Grüße"},
+		{name: "undeclared latin-1", data: "Gr\xfc\xdfe", want: "Grüße"},
+		{name: "undeclared shift_jis", data: shiftJIS, want: "こんにちは、注文です"},
+		{name: "undeclared euc-jp", data: "\xa4\xb3\xa4\xf3\xa4\xcb\xa4\xc1\xa4\xcf\xa1\xa2\xc3\xed\xca\xb8\xa4\xc7\xa4\xb9", want: "こんにちは、注文です"},
+		{name: "us-ascii label on 8-bit text", data: "Gr\xfc\xdfe", charset: "us-ascii", want: "Grüße"},
+		{name: "unknown label", data: "Gr\xfc\xdfe", charset: "x-unknown", want: "Grüße"},
+		{
+			name:      "html meta charset",
+			data:      `<meta charset="shift_jis"><p>` + shiftJIS + `</p>`,
+			mediaType: "text/html",
+			want:      `<meta charset="shift_jis"><p>こんにちは、注文です</p>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mediaType := tt.mediaType
+			if mediaType == "" {
+				mediaType = "text/plain"
+			}
+			if got := DecodeText([]byte(tt.data), mediaType, tt.charset); got != tt.want {
+				t.Errorf("DecodeText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeaderParam(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		key   string
+		want  string
+	}{
+		{name: "plain", value: `attachment; filename="invoice.pdf"`, key: "filename", want: "invoice.pdf"},
+		{name: "rfc 2231 utf-8", value: `attachment; filename*=UTF-8''Gr%C3%BC%C3%9Fe.pdf`, key: "filename", want: "Grüße.pdf"},
+		{name: "rfc 2231 iso-8859-1", value: `attachment; filename*=iso-8859-1'de'Gr%FC%DFe.pdf`, key: "filename", want: "Grüße.pdf"},
+		{
+			name:  "rfc 2231 continuation",
+			value: `attachment; filename*0*=shift_jis''%90%BF%8B%81; filename*1*=%8F%91; filename*2=".pdf"`,
+			key:   "filename",
+			want:  "請求書.pdf",
+		},
+		{
+			name:  "rfc 2231 preferred over the ascii fallback",
+			value: `attachment; filename="Grusse.pdf"; filename*=iso-8859-1''Gr%FC%DFe.pdf`,
+			key:   "filename",
+			want:  "Grüße.pdf",
+		},
+		{name: "rfc 2047 encoded word", value: `application/pdf; name="=?ISO-8859-1?Q?Gr=FC=DFe.pdf?="`, key: "name", want: "Grüße.pdf"},
+		{name: "rfc 2047 shift_jis", value: `application/pdf; name="=?shift_jis?B?kL+LgY+R?=.pdf"`, key: "name", want: "請求書.pdf"},
+		{name: "missing", value: `inline`, key: "filename", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HeaderParam(tt.value, tt.key); got != tt.want {
+				t.Errorf("HeaderParam() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_charsets(t *testing.T) {
+	raw := "From: shop@example.com\r\n" +
+		"Subject: =?ISO-8859-1?Q?Bestellbest=E4tigung?=\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain; charset=ISO-8859-1\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n" +
+		"Gr=FC=DFe aus M=FCnchen\r\n" +
+		"--b\r\nContent-Type: application/pdf\r\n" +
+		"Content-Disposition: attachment; filename*=iso-8859-1''Rechnung%20M%FCnchen.pdf\r\n" +
+		"Content-Transfer-Encoding: base64\r\n\r\nJVBERi0=\r\n--b--\r\n"
+
+	m, err := Parse("1", []byte(raw))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if m.Subject != "Bestellbestätigung" {
+		t.Errorf("Subject = %q, want Bestellbestätigung", m.Subject)
+	}
+	if m.Body != "Grüße aus München" {
+		t.Errorf("Body = %q, want the body decoded from ISO-8859-1", m.Body)
+	}
+	if len(m.Attachments) != 1 || m.Attachments[0].Name != "Rechnung München.pdf" || string(m.Attachments[0].Content) != "%PDF-" {
+		t.Errorf("Attachments = %+v, want Rechnung München.pdf", m.Attachments)
+	}
+}
@@ -0,0 +1,52 @@
+package message
+
+import (
+	"log/slog"
+	"strings"
+)
+
+// maxEmbeddedDepth bounds how deeply forwarded messages are parsed.
+const maxEmbeddedDepth = 8
+
+// Innermost returns the original message of a mail forwarded as attachment by following the
+// first embedded message down to the deepest one, or m when it embeds no message. The result
+// keeps the Id of m so that log lines and processed actions refer to the mailbox message.
+func (m Mail) Innermost() Mail {
+	inner := m
+	for len(inner.Embedded) > 0 {
+		inner = inner.Embedded[0]
+	}
+	inner.Id = m.Id
+	return inner
+}
+
+// IsMessageType reports whether mediaType is an encapsulated message.
+func IsMessageType(mediaType string) bool {
+	mediaType = strings.ToLower(mediaType)
+	return mediaType == "message/rfc822" || mediaType == "message/global"
+}
+
+// embedMessage parses raw, found at MIME nesting level, as a message embedded in m and appends it
+// to m.Embedded.
+func embedMessage(m *Mail, raw []byte, depth, level int) {
+	if depth >= maxEmbeddedDepth || level >= maxMIMENesting {
+		slog.Warn("skipping embedded message: nested too deeply", "mailId", m.Id, "max_depth", maxEmbeddedDepth)
+		return
+	}
+	nested, err := parse(m.Id, raw, depth+1, level+1)
+	if err != nil {
+		slog.Warn("error parsing embedded message", "mailId", m.Id, "error", err)
+		return
+	}
+	m.Embedded = append(m.Embedded, nested)
+}
+
+// EmbedAttachedMails parses the message/rfc822 attachments of m into m.Embedded, for backends that
+// deliver them as downloaded attachments rather than as MIME parts.
+func EmbedAttachedMails(m *Mail) {
+	for _, a := range m.Attachments {
+		if IsMessageType(a.ContentType) {
+			embedMessage(m, a.Content, 0, 0)
+		}
+	}
+}
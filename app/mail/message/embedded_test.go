@@ -0,0 +1,80 @@
+package message
+
+import (
+	"strings"
+	"testing"
+)
+
+const forwardedVendorMail = "From: billing@vendor.example\r\n" +
+	"To: alice@example.com\r\n" +
+	"Subject: Invoice 1234\r\n" +
+	"Content-Type: multipart/mixed; boundary=inner\r\n\r\n" +
+	"--inner\r\nContent-Type: text/plain\r\n\r\nAmount due: 99.00 EUR\r\n" +
+	"--inner\r\nContent-Type: application/pdf\r\nContent-Disposition: attachment; filename=invoice-1234.pdf\r\n" +
+	"Content-Transfer-Encoding: base64\r\n\r\nJVBERi0=\r\n--inner--\r\n"
+
+func TestParse_forwardedAsAttachment(t *testing.T) {
+	raw := "From: alice@example.com\r\n" +
+		"To: invoices@example.com\r\n" +
+		"Subject: Fwd: Invoice 1234\r\n" +
+		"Content-Type: multipart/mixed; boundary=outer\r\n\r\n" +
+		"--outer\r\nContent-Type: text/plain\r\n\r\nPlease pay this one.\r\n" +
+		"--outer\r\nContent-Type: message/rfc822\r\nContent-Disposition: attachment; filename=\"Invoice 1234.eml\"\r\n\r\n" +
+		forwardedVendorMail + "\r\n--outer--\r\n"
+
+	m, err := Parse("1", []byte(raw))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(m.Attachments) != 1 || m.Attachments[0].Name != "Invoice 1234.eml" {
+		t.Errorf("Attachments = %+v, want only the forwarded message", m.Attachments)
+	}
+	if len(m.Embedded) != 1 {
+		t.Fatalf("Embedded = %d mails, want 1", len(m.Embedded))
+	}
+	inner := m.Innermost()
+	if inner.Id != "1" || inner.Sender != "billing@vendor.example" || inner.Subject != "Invoice 1234" {
+		t.Errorf("Innermost() id/sender/subject = %q, %q, %q", inner.Id, inner.Sender, inner.Subject)
+	}
+	if strings.TrimSpace(inner.Body) != "Amount due: 99.00 EUR" {
+		t.Errorf("Innermost().Body = %q", inner.Body)
+	}
+	if len(inner.Attachments) != 1 || inner.Attachments[0].Name != "invoice-1234.pdf" || string(inner.Attachments[0].Content) != "%PDF-" {
+		t.Errorf("Innermost().Attachments = %+v, want invoice-1234.pdf", inner.Attachments)
+	}
+	if !strings.HasPrefix(string(inner.Raw), "From: billing@vendor.example") {
+		t.Errorf("Innermost().Raw = %q, want the forwarded message", inner.Raw)
+	}
+}
+
+func TestParse_nestingDepthIsBounded(t *testing.T) {
+	raw := forwardedVendorMail
+	for i := 0; i < maxEmbeddedDepth+2; i++ {
+		raw = "Subject: Fwd\r\nContent-Type: message/rfc822\r\n\r\n" + raw
+	}
+
+	m, err := Parse("1", []byte(raw))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	depth := 0
+	for cur := m; len(cur.Embedded) > 0; cur = cur.Embedded[0] {
+		depth++
+	}
+	if depth != maxEmbeddedDepth {
+		t.Errorf("embedded depth = %d, want %d", depth, maxEmbeddedDepth)
+	}
+}
+
+func TestEmbedAttachedMails(t *testing.T) {
+	m := Mail{Id: "m1", Attachments: []Attachment{
+		NewAttachment("invoice.pdf", []byte("%PDF-"), "application/pdf", "", false),
+		NewAttachment("Invoice 1234.eml", []byte(forwardedVendorMail), "message/rfc822", "", false),
+	}}
+
+	EmbedAttachedMails(&m)
+
+	if len(m.Embedded) != 1 || m.Embedded[0].Subject != "Invoice 1234" || m.Innermost().Id != "m1" {
+		t.Errorf("Embedded = %+v, want the forwarded vendor mail", m.Embedded)
+	}
+}
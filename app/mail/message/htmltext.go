@@ -0,0 +1,164 @@
+package message
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// htmlSkipped are elements whose content is never shown to the reader.
+var htmlSkipped = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Title:    true,
+	atom.Noscript: true,
+	atom.Template: true,
+}
+
+// htmlHeadContent are the elements allowed in <head>. Like browsers, any other element ends a
+// head whose </head> is missing.
+var htmlHeadContent = map[atom.Atom]bool{
+	atom.Base: true, atom.Link: true, atom.Meta: true, atom.Noscript: true, atom.Script: true,
+	atom.Style: true, atom.Template: true, atom.Title: true,
+}
+
+// htmlBlocks are elements that start on a new line.
+var htmlBlocks = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Aside: true, atom.Blockquote: true, atom.Div: true,
+	atom.Dl: true, atom.Dt: true, atom.Dd: true, atom.Fieldset: true, atom.Footer: true, atom.Form: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Header: true, atom.Hr: true, atom.Li: true, atom.Main: true, atom.Nav: true, atom.Ol: true,
+	atom.P: true, atom.Pre: true, atom.Section: true, atom.Table: true, atom.Tr: true, atom.Ul: true,
+}
+
+// HTMLToText renders an HTML document as readable plain text: scripts, styles and tags are
+// removed, entities decoded, whitespace collapsed, block elements put on their own lines and
+// link targets kept in angle brackets after the link text, e.g. "Track order <https://...>".
+func HTMLToText(s string) string {
+	var b strings.Builder
+	z := html.NewTokenizer(strings.NewReader(s))
+	// offset is the end of the current token in s.
+	offset := 0
+	inHead := false
+	skip := 0
+	pre := 0
+	var links []string
+	// space records pending whitespace so runs collapse into a single separator.
+	space := false
+	newline := func() {
+		space = false
+		if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+			b.WriteByte('\n')
+		}
+	}
+	write := func(text string) {
+		if text == "" {
+			return
+		}
+		if space && b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteString(text)
+	}
+	for {
+		tt := z.Next()
+		offset += len(z.Raw())
+		switch tt {
+		case html.ErrorToken:
+			return strings.TrimSpace(b.String())
+		case html.TextToken:
+			if skip > 0 || inHead {
+				continue
+			}
+			text := string(z.Text())
+			if pre > 0 {
+				b.WriteString(text)
+				continue
+			}
+			if text != "" && isHTMLSpace(text[0]) {
+				space = true
+			}
+			fields := strings.Fields(text)
+			write(strings.Join(fields, " "))
+			if text != "" && isHTMLSpace(text[len(text)-1]) {
+				space = true
+			}
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			name, hasAttr := z.TagName()
+			a := atom.Lookup(name)
+			if a == atom.Head {
+				inHead = tt == html.StartTagToken
+				continue
+			}
+			if inHead && tt != html.EndTagToken && !htmlHeadContent[a] {
+				inHead = false
+			}
+			if htmlSkipped[a] {
+				switch tt {
+				case html.StartTagToken:
+					skip++
+				case html.EndTagToken:
+					if skip > 0 {
+						skip--
+					}
+				case html.SelfClosingTagToken:
+					// The tokenizer reads everything after <script/> as raw script text up to a
+					// </script> that never comes; continue with the markup after the tag instead.
+					z = html.NewTokenizer(strings.NewReader(s[offset:]))
+				}
+				continue
+			}
+			if skip > 0 || inHead {
+				continue
+			}
+			switch {
+			case a == atom.Br:
+				b.WriteByte('\n')
+				space = false
+			case a == atom.A && tt == html.StartTagToken:
+				href := ""
+				for hasAttr {
+					var key, val []byte
+					key, val, hasAttr = z.TagAttr()
+					if string(key) == "href" {
+						href = strings.TrimSpace(string(val))
+					}
+				}
+				links = append(links, href)
+			case a == atom.A && tt == html.EndTagToken && len(links) > 0:
+				href := links[len(links)-1]
+				links = links[:len(links)-1]
+				if href != "" && !strings.HasPrefix(href, "#") && !strings.HasSuffix(b.String(), href) {
+					space = true
+					write("<" + href + ">")
+				}
+			case a == atom.Td || a == atom.Th:
+				if tt == html.StartTagToken {
+					space = true
+				}
+			case a == atom.Pre:
+				newline()
+				if tt == html.StartTagToken {
+					pre++
+				} else if pre > 0 {
+					pre--
+				}
+			case htmlBlocks[a]:
+				newline()
+			}
+		}
+	}
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// ApplyHTMLFallback derives Body from HTMLBody for mails without a text/plain part.
+func ApplyHTMLFallback(m *Mail) {
+	if strings.TrimSpace(m.Body) == "" && m.HTMLBody != "" {
+		m.Body = HTMLToText(m.HTMLBody)
+	}
+}
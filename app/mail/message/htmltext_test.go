@@ -0,0 +1,112 @@
+package message
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "strips tags and collapses whitespace",
+			html: "<p>Your   order\n <b>1234</b> was shipped.</p>",
+			want: "Your order 1234 was shipped.",
+		},
+		{
+			name: "drops head, scripts and styles",
+			html: `<html><head><title>Receipt</title><style>p{color:red}</style></head>` +
+				`<body><script>track()</script><p>Total: $12.50</p></body></html>`,
+			want: "Total: $12.50",
+		},
+		{
+			name: "head without closing tag ends at body",
+			html: "<html><head><title>Order</title><body><p>Your order 1234 shipped</p></body></html>",
+			want: "Your order 1234 shipped",
+		},
+		{
+			name: "head without closing tag ends at first body element",
+			html: "<head><meta charset=\"utf-8\"><style>p{}</style><p>Your order 1234 shipped</p>",
+			want: "Your order 1234 shipped",
+		},
+		{
+			name: "self-closing script and style",
+			html: `<html><head><script src="x"/><style/></head><body><p>Your order</p><p>1234 shipped</p></body></html>`,
+			want: "Your order\n1234 shipped",
+		},
+		{
+			name: "decodes entities",
+			html: "<p>Caf&eacute; &amp; Bar &#8211; &euro;5&nbsp;</p>",
+			want: "Café & Bar – €5",
+		},
+		{
+			name: "keeps link targets",
+			html: `<p>Track your order <a href="https://shop.example.com/track/1234">here</a>.</p>`,
+			want: "Track your order here <https://shop.example.com/track/1234>.",
+		},
+		{
+			name: "does not repeat link targets shown as text",
+			html: `<a href="https://example.com">https://example.com</a>`,
+			want: "https://example.com",
+		},
+		{
+			name: "puts blocks, list items and breaks on their own lines",
+			html: "<div>Order</div><ul><li>Apple</li><li>Pear</li></ul>Line 1<br>Line 2",
+			want: "Order\nApple\nPear\nLine 1\nLine 2",
+		},
+		{
+			name: "separates table cells",
+			html: "<table><tr><td>Total:</td><td>$12.50</td></tr></table>",
+			want: "Total: $12.50",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HTMLToText(tt.html); got != tt.want {
+				t.Errorf("HTMLToText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_htmlBody(t *testing.T) {
+	tests := []struct {
+		name         string
+		raw          string
+		wantBody     string
+		wantHTMLBody string
+	}{
+		{
+			name: "html only mail gets a derived text body",
+			raw: "From: shop@example.com\r\nSubject: Receipt\r\nContent-Type: text/html; charset=utf-8\r\n\r\n" +
+				"<p>Total: <b>$12.50</b></p>",
+			wantBody:     "Total: $12.50",
+			wantHTMLBody: "<p>Total: <b>$12.50</b></p>",
+		},
+		{
+			name: "plain part wins over the html part",
+			raw: "From: shop@example.com\r\nSubject: Receipt\r\nContent-Type: multipart/alternative; boundary=b\r\n\r\n" +
+				"--b\r\nContent-Type: text/plain\r\n\r\nTotal: 12.50 USD\r\n" +
+				"--b\r\nContent-Type: text/html\r\n\r\n<p>Total: <b>$12.50</b></p>\r\n--b--\r\n",
+			wantBody:     "Total: 12.50 USD",
+			wantHTMLBody: "<p>Total: <b>$12.50</b></p>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Parse("1", []byte(tt.raw))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if strings.TrimSpace(m.Body) != tt.wantBody {
+				t.Errorf("Body = %q, want %q", m.Body, tt.wantBody)
+			}
+			if strings.TrimSpace(m.HTMLBody) != tt.wantHTMLBody {
+				t.Errorf("HTMLBody = %q, want %q", m.HTMLBody, tt.wantHTMLBody)
+			}
+		})
+	}
+}
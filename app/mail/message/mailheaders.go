@@ -0,0 +1,153 @@
+package message
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	gomail "net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// AddressParser parses address lists, decoding RFC 2047 display names in any known charset.
+var AddressParser = &gomail.AddressParser{WordDecoder: mimeWordDecoder}
+
+// ApplyHeaders stores headers on m and derives the threading fields and display names from them.
+func ApplyHeaders(m *Mail, headers []Header) {
+	m.Headers = headers
+	m.MessageID = firstMessageID(m.Header("Message-ID"))
+	m.InReplyTo = firstMessageID(m.Header("In-Reply-To"))
+	m.References = messageIDs(strings.Join(m.HeaderValues("References"), " "))
+
+	for _, name := range []string{"From", "Reply-To", "To", "Cc"} {
+		for _, v := range m.HeaderValues(name) {
+			list, err := AddressParser.ParseList(v)
+			if err != nil {
+				continue
+			}
+			for _, a := range list {
+				if name == "Reply-To" {
+					m.ReplyTo = append(m.ReplyTo, a.Address)
+				}
+				if a.Name == "" {
+					continue
+				}
+				if name == "From" && m.SenderName == "" {
+					m.SenderName = a.Name
+				}
+				if m.DisplayNames == nil {
+					m.DisplayNames = make(map[string]string)
+				}
+				if _, ok := m.DisplayNames[a.Address]; !ok {
+					m.DisplayNames[a.Address] = a.Name
+				}
+			}
+		}
+	}
+}
+
+// messageIDs returns the message IDs of an In-Reply-To or References value without angle brackets.
+func messageIDs(v string) []string {
+	var ids []string
+	for _, f := range strings.Fields(v) {
+		if id := strings.Trim(f, "<>,"); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func firstMessageID(v string) string {
+	if ids := messageIDs(v); len(ids) > 0 {
+		return ids[0]
+	}
+	return ""
+}
+
+// rawHeaders returns the header fields of an RFC 5322 message in order, with folded lines joined.
+// Lines that are not header fields, such as an mbox "From " line, are skipped.
+func rawHeaders(raw []byte) []Header {
+	r := textproto.NewReader(bufio.NewReader(bytes.NewReader(raw)))
+	var headers []Header
+	for {
+		line, err := r.ReadContinuedLine()
+		if line == "" || (err != nil && err != io.EOF) {
+			return headers
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && isFieldName(strings.TrimSpace(name)) {
+			headers = append(headers, Header{Name: strings.TrimSpace(name), Value: strings.TrimSpace(value)})
+		}
+		if err == io.EOF {
+			return headers
+		}
+	}
+}
+
+// isFieldName reports whether name is a valid header field name: printable ASCII without spaces.
+func isFieldName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if name[i] <= ' ' || name[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// SenderAddress returns the bare address of a From value, falling back to the raw value.
+func SenderAddress(from string) string {
+	if addr, err := AddressParser.Parse(from); err == nil {
+		return addr.Address
+	}
+	return from
+}
+
+// RecipientAddresses collects unique recipient addresses from the Delivered-To, To and Cc fields
+// of headers, in order. Bcc is intentionally excluded as it is typically not visible to recipients.
+func RecipientAddresses(headers []Header) []string {
+	seen := make(map[string]bool)
+	var recipients []string
+
+	addAddress := func(raw string) {
+		if addr, err := AddressParser.Parse(raw); err == nil && addr.Address != "" {
+			if !seen[addr.Address] {
+				seen[addr.Address] = true
+				recipients = append(recipients, addr.Address)
+			}
+			return
+		}
+		v := strings.TrimSpace(raw)
+		if v != "" && !seen[v] {
+			seen[v] = true
+			recipients = append(recipients, v)
+		}
+	}
+
+	addAddressList := func(raw string) {
+		if list, err := AddressParser.ParseList(raw); err == nil {
+			for _, a := range list {
+				if a != nil && a.Address != "" && !seen[a.Address] {
+					seen[a.Address] = true
+					recipients = append(recipients, a.Address)
+				}
+			}
+			return
+		}
+		// Fallback: comma-separated raw strings.
+		for _, p := range strings.Split(raw, ",") {
+			addAddress(p)
+		}
+	}
+
+	for _, h := range headers {
+		switch {
+		case strings.EqualFold(h.Name, "Delivered-To"):
+			addAddress(h.Value)
+		case strings.EqualFold(h.Name, "To"), strings.EqualFold(h.Name, "Cc"):
+			addAddressList(h.Value)
+		}
+	}
+	return recipients
+}
@@ -0,0 +1,54 @@
+package message
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse_headers(t *testing.T) {
+	raw := "From: =?ISO-8859-1?Q?J=FCrgen_M=FCller?= <juergen@example.com>\r\n" +
+		"To: Orders <orders@example.com>, team@example.com\r\n" +
+		"Reply-To: Support <support@example.com>\r\n" +
+		"Subject: Re: Order 1234\r\n" +
+		"Message-ID: <reply-3@example.com>\r\n" +
+		"In-Reply-To: <order-2@example.com>\r\n" +
+		"References: <order-1@example.com>\r\n <order-2@example.com>\r\n" +
+		"X-Custom: one\r\n" +
+		"X-Custom: two\r\n" +
+		"\r\n" +
+		"Thanks!\r\n"
+
+	m, err := Parse("1", []byte(raw))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if m.MessageID != "reply-3@example.com" || m.InReplyTo != "order-2@example.com" {
+		t.Errorf("MessageID, InReplyTo = %q, %q", m.MessageID, m.InReplyTo)
+	}
+	if want := []string{"order-1@example.com", "order-2@example.com"}; !reflect.DeepEqual(m.References, want) {
+		t.Errorf("References = %v, want %v", m.References, want)
+	}
+	if want := []string{"support@example.com"}; !reflect.DeepEqual(m.ReplyTo, want) {
+		t.Errorf("ReplyTo = %v, want %v", m.ReplyTo, want)
+	}
+	if m.SenderName != "Jürgen Müller" {
+		t.Errorf("SenderName = %q, want Jürgen Müller", m.SenderName)
+	}
+	wantNames := map[string]string{
+		"juergen@example.com": "Jürgen Müller",
+		"support@example.com": "Support",
+		"orders@example.com":  "Orders",
+	}
+	if !reflect.DeepEqual(m.DisplayNames, wantNames) {
+		t.Errorf("DisplayNames = %v, want %v", m.DisplayNames, wantNames)
+	}
+	if len(m.Headers) != 9 || m.Headers[0].Name != "From" || m.Headers[8].Name != "X-Custom" {
+		t.Errorf("Headers = %v, want all nine fields in message order", m.Headers)
+	}
+	if got := m.HeaderValues("x-custom"); !reflect.DeepEqual(got, []string{"one", "two"}) {
+		t.Errorf("HeaderValues(x-custom) = %v, want [one two]", got)
+	}
+	if m.SizeEstimate != int64(len(raw)) || string(m.Raw) != raw {
+		t.Errorf("SizeEstimate, Raw = %d, %q; want the unmodified message", m.SizeEstimate, m.Raw)
+	}
+}
@@ -0,0 +1,126 @@
+// Package message holds the representation of an email shared by all mail backends and inbound
+// endpoints, and parses raw RFC 5322/MIME messages into it. It depends on no other package of the
+// service, so that parsing can be used and tested on its own.
+package message
+
+import (
+	"strings"
+	"time"
+)
+
+// Attachment represents a single email attachment. ContentType is the declared MIME type without
+// parameters (guessed from the extension when none is declared), ContentID the Content-ID without
+// angle brackets, Inline whether the part is displayed within the body (e.g. an embedded image)
+// rather than offered as a file, and SHA256 the hex-encoded digest of Content.
+type Attachment struct {
+	Name        string
+	Content     []byte
+	ContentType string
+	ContentID   string
+	Inline      bool
+	Size        int64
+	SHA256      string
+}
+
+// Header is a single header field of a mail.
+type Header struct {
+	Name  string
+	Value string
+}
+
+// Mail represents an email message. Body holds the text/plain part, or text derived from HTMLBody
+// (the text/html part) when the mail has no plain part.
+//
+// Headers lists all header fields in message order. MessageID, InReplyTo and References hold
+// message IDs without angle brackets, ReplyTo the bare Reply-To addresses and DisplayNames the
+// display names of the From, Reply-To, To and Cc addresses keyed by address. ThreadID, LabelIDs,
+// Snippet and SizeEstimate are set by backends that provide them, such as Gmail. Raw holds the
+// unmodified RFC 822 source for backends that read it anyway (IMAP, POP3, Maildir, mbox, Graph,
+// SMTP inbound); use mail.RawMailLoader for the others.
+//
+// Embedded holds the messages attached as message/rfc822 parts, e.g. a mail forwarded as
+// attachment, parsed with their own sender, subject, body and attachments.
+//
+// Authentication is the sender authentication verdict derived from the Authentication-Results and
+// ARC headers; it is set by mail.AuthenticateSender.
+type Mail struct {
+	Id             string
+	Sender         string
+	SenderName     string
+	Recipients     []string
+	Subject        string
+	Body           string
+	HTMLBody       string
+	Attachments    []Attachment
+	ReceivedAt     time.Time
+	Headers        []Header
+	MessageID      string
+	InReplyTo      string
+	References     []string
+	ReplyTo        []string
+	DisplayNames   map[string]string
+	ThreadID       string
+	LabelIDs       []string
+	Snippet        string
+	SizeEstimate   int64
+	Raw            []byte
+	Embedded       []Mail
+	Authentication AuthVerdict
+}
+
+// Header returns the value of the first header field named name (case-insensitive), or "".
+func (m Mail) Header(name string) string {
+	for _, h := range m.Headers {
+		if strings.EqualFold(h.Name, name) {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+// HeaderValues returns the values of all header fields named name (case-insensitive).
+func (m Mail) HeaderValues(name string) []string {
+	var values []string
+	for _, h := range m.Headers {
+		if strings.EqualFold(h.Name, name) {
+			values = append(values, h.Value)
+		}
+	}
+	return values
+}
+
+// AuthResult is one result of an Authentication-Results header, e.g. "dkim=pass header.d=example.com".
+// Properties are keyed by ptype.property in lower case, e.g. "header.d" or "smtp.mailfrom".
+type AuthResult struct {
+	Method     string
+	Result     string
+	Properties map[string]string
+}
+
+// AuthResults is a parsed Authentication-Results (RFC 8601) or ARC-Authentication-Results
+// (RFC 8617) header. Instance is the ARC instance (i=), 0 for Authentication-Results.
+type AuthResults struct {
+	AuthServID string
+	Instance   int
+	Results    []AuthResult
+}
+
+// AuthVerdict is the sender authentication verdict of a mail, set by mail.AuthenticateSender.
+//
+// Domain is the domain of the From address. Pass reports whether a trusted authentication
+// service found dkim=pass for a domain aligned with it, or dmarc=pass for it; Reason names the result
+// that decided, or why none did. SPF, DKIM, DMARC and ARC summarize the trusted results ("pass"
+// when any passed, "" when none was reported). Results and ARCResults hold every
+// Authentication-Results and ARC-Authentication-Results header in message order, trusted or not.
+type AuthVerdict struct {
+	Domain     string
+	Pass       bool
+	Reason     string
+	AuthServID string
+	SPF        string
+	DKIM       string
+	DMARC      string
+	ARC        string
+	Results    []AuthResults
+	ARCResults []AuthResults
+}
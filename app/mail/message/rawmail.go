@@ -0,0 +1,248 @@
+package message
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	gomail "net/mail"
+	"strings"
+	"unicode/utf8"
+)
+
+// mimeWordDecoder decodes RFC 2047 encoded words in header values.
+var mimeWordDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+// maxMIMENesting bounds how deeply multipart containers and embedded messages are walked. Each
+// level copies the rest of the message, so without a bound a message of many nested multiparts
+// takes time and memory quadratic in its size.
+const maxMIMENesting = 32
+
+// Parse converts an RFC 5322 message into a Mail identified by id.
+// ReceivedAt is taken from the Date header; callers with a more accurate
+// delivery timestamp (e.g. IMAP INTERNALDATE) should overwrite it.
+//
+// Parsing is tolerant of the damage found in real-world mail: header lines that are not fields,
+// bare LF line endings, invalid Content-Type parameters, multiparts without boundary or closing
+// delimiter, and corrupt base64 or quoted-printable data are recovered from on a best-effort basis.
+// Only a message without any header field is rejected. Parts nested deeper than maxMIMENesting are
+// kept as opaque attachments.
+func Parse(id string, raw []byte) (Mail, error) {
+	return parse(id, raw, 0, 0)
+}
+
+// parse parses a message embedded depth levels deep, whose entity is at MIME nesting level.
+func parse(id string, raw []byte, depth, level int) (Mail, error) {
+	headerBlock, body := splitMessage(raw)
+	headers := rawHeaders(headerBlock)
+	if len(headers) == 0 {
+		return Mail{}, fmt.Errorf("parse message %s: no header fields", id)
+	}
+	h := headerList(headers)
+
+	m := Mail{
+		Id:         id,
+		Sender:     SenderAddress(h.Get("From")),
+		Recipients: rawRecipients(h),
+		Subject:    DecodeHeaderValue(h.Get("Subject")),
+
+		SizeEstimate: int64(len(raw)),
+		Raw:          raw,
+	}
+	ApplyHeaders(&m, headers)
+	if date, err := gomail.ParseDate(h.Get("Date")); err == nil {
+		m.ReceivedAt = date.UTC()
+	}
+
+	walkMIMEPart(h, body, &m, depth, level)
+	ExpandTNEFAttachments(&m)
+	ApplyHTMLFallback(&m)
+	return m, nil
+}
+
+// splitMessage splits raw at the first empty line into the header block and the body. A message
+// without an empty line has no body.
+func splitMessage(raw []byte) ([]byte, []byte) {
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '\n' {
+			continue
+		}
+		switch {
+		case bytes.HasPrefix(raw[i+1:], []byte("\r\n")):
+			return raw[:i+1], raw[i+3:]
+		case bytes.HasPrefix(raw[i+1:], []byte("\n")):
+			return raw[:i+1], raw[i+2:]
+		}
+	}
+	return raw, nil
+}
+
+// PartHeader is satisfied by both net/mail.Header and textproto.MIMEHeader.
+type PartHeader interface {
+	Get(key string) string
+}
+
+// walkMIMEPart decodes one MIME entity and recurses into multipart containers.
+// The first text/plain part becomes the body and the first text/html part the HTML body;
+// parts with a filename become attachments and message/rfc822 parts embedded mails.
+func walkMIMEPart(h PartHeader, body []byte, m *Mail, depth, level int) {
+	mediaType, params := parseContentType(h.Get("Content-Type"))
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if boundary := params["boundary"]; boundary != "" {
+			if level >= maxMIMENesting {
+				slog.Warn("multipart nested too deeply; keeping it as an opaque attachment", "mailId", m.Id, "max_nesting", maxMIMENesting)
+				m.Attachments = append(m.Attachments, NewAttachment(PartFilename(h), body, mediaType, "", false))
+				return
+			}
+			walkMultipart(body, boundary, m, depth, level+1)
+			return
+		}
+		slog.Warn("multipart section without boundary; reading it as text", "mailId", m.Id)
+		mediaType = "text/plain"
+	}
+
+	decoded, err := decodeTransferEncoding(h.Get("Content-Transfer-Encoding"), body)
+	if err != nil {
+		// A partly decoded part is more useful than a missing one.
+		slog.Warn("error decoding part data", "mailId", m.Id, "error", err)
+		if len(decoded) == 0 {
+			return
+		}
+	}
+
+	if IsMessageType(mediaType) {
+		embedMessage(m, decoded, depth, level)
+	}
+	if name := PartFilename(h); name != "" {
+		m.Attachments = append(m.Attachments, AttachmentFromPart(name, decoded, h))
+		return
+	}
+	switch {
+	case mediaType == "text/plain" && m.Body == "":
+		m.Body = DecodeText(decoded, mediaType, params["charset"])
+	case mediaType == "text/html" && m.HTMLBody == "":
+		m.HTMLBody = DecodeText(decoded, mediaType, params["charset"])
+	}
+}
+
+// walkMultipart walks the sections of a multipart body. A missing closing delimiter ends the last
+// section at the end of the body instead of discarding it. The sections are at nesting level.
+func walkMultipart(body []byte, boundary string, m *Mail, depth, level int) {
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		p, err := mr.NextRawPart()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			slog.Warn("error reading multipart section", "mailId", m.Id, "error", err)
+			return
+		}
+		data, err := io.ReadAll(p)
+		if err != nil {
+			slog.Warn("error reading multipart section", "mailId", m.Id, "error", err)
+			if len(data) > 0 {
+				walkMIMEPart(p.Header, data, m, depth, level)
+			}
+			return
+		}
+		walkMIMEPart(p.Header, data, m, depth, level)
+	}
+}
+
+// parseContentType returns the lower-case media type and parameters of a Content-Type value. Values
+// that mime.ParseMediaType rejects, e.g. because of a stray semicolon, are split by hand; a missing
+// or unusable value means text/plain.
+func parseContentType(v string) (string, map[string]string) {
+	mediaType, params, err := mime.ParseMediaType(v)
+	if err == nil {
+		return mediaType, params
+	}
+	parts := SplitHeaderParams(v)
+	mediaType = strings.ToLower(strings.TrimSpace(parts[0]))
+	if !strings.Contains(mediaType, "/") {
+		return "text/plain", map[string]string{}
+	}
+	params = make(map[string]string)
+	for _, p := range parts[1:] {
+		if k, val, ok := strings.Cut(p, "="); ok {
+			params[strings.ToLower(strings.TrimSpace(k))] = UnquoteParam(strings.TrimSpace(val))
+		}
+	}
+	return mediaType, params
+}
+
+// PartFilename returns the attachment filename from Content-Disposition or the Content-Type name
+// parameter, decoding RFC 2231 and RFC 2047 encodings.
+func PartFilename(h PartHeader) string {
+	if name := HeaderParam(h.Get("Content-Disposition"), "filename"); name != "" {
+		return name
+	}
+	return HeaderParam(h.Get("Content-Type"), "name")
+}
+
+// decodeTransferEncoding reverses the Content-Transfer-Encoding of a part body. On corrupt data it
+// returns what could be decoded along with the error.
+func decodeTransferEncoding(encoding string, data []byte) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		// Tolerate line breaks, stray characters and missing padding.
+		cleaned := strings.Map(func(r rune) rune {
+			if r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '+' || r == '/' {
+				return r
+			}
+			return -1
+		}, string(data))
+		if len(cleaned)%4 == 1 {
+			// A single trailing character carries no complete byte.
+			cleaned = cleaned[:len(cleaned)-1]
+		}
+		return base64.RawStdEncoding.DecodeString(cleaned)
+	case "quoted-printable":
+		return io.ReadAll(quotedprintable.NewReader(bytes.NewReader(data)))
+	default:
+		return data, nil
+	}
+}
+
+// DecodeHeaderValue decodes RFC 2047 encoded words, returning the input unchanged on failure.
+// Unencoded 8-bit text, which some senders put into headers, is decoded like an undeclared body.
+func DecodeHeaderValue(v string) string {
+	if !utf8.ValidString(v) {
+		v = DecodeText([]byte(v), "", "")
+	}
+	if decoded, err := mimeWordDecoder.DecodeHeader(v); err == nil {
+		return decoded
+	}
+	return v
+}
+
+// headerList adapts the header fields of a message to PartHeader.
+type headerList []Header
+
+func (h headerList) Get(key string) string {
+	for _, f := range h {
+		if strings.EqualFold(f.Name, key) {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// rawRecipients collects the recipients from Delivered-To, To and Cc, in that order.
+func rawRecipients(h headerList) []string {
+	var ordered []Header
+	for _, name := range []string{"Delivered-To", "To", "Cc"} {
+		for _, f := range h {
+			if strings.EqualFold(f.Name, name) {
+				ordered = append(ordered, Header{Name: name, Value: f.Value})
+			}
+		}
+	}
+	return RecipientAddresses(ordered)
+}
@@ -0,0 +1,185 @@
+package message
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestParse_corpus parses the fixture messages in testdata/mime, which cover common MIME
+// structures, encodings and the malformed mail that senders produce in practice.
+func TestParse_corpus(t *testing.T) {
+	tests := []struct {
+		file            string
+		wantSender      string
+		wantRecipients  string
+		wantSubject     string
+		wantBody        string
+		wantHTMLBody    string
+		wantAttachments []string // name=content
+		wantEmbedded    int
+	}{
+		{
+			file:           "plain.eml",
+			wantSender:     "shop@example.com",
+			wantRecipients: "orders@example.com",
+			wantSubject:    "Order 1234 confirmed",
+			wantBody:       "Thank you for your order 1234.\r\nTotal: $12.50",
+		},
+		{
+			file:           "alternative.eml",
+			wantSender:     "shop@example.com",
+			wantRecipients: "orders@example.com",
+			wantSubject:    "Receipt",
+			wantBody:       "Total: 12.50 €, a very long line that the sender wrapped with a soft line break.",
+			wantHTMLBody:   "<p>Total: <b>12.50 €</b></p>",
+		},
+		{
+			file:            "mixed.eml",
+			wantSender:      "billing@vendor.example",
+			wantRecipients:  "orders@example.com,audit@example.com",
+			wantSubject:     "Invoice 2024-05",
+			wantBody:        "Please find the invoice attached.",
+			wantHTMLBody:    "<p>Please find the invoice attached.</p>",
+			wantAttachments: []string{"invoice-2024-05.pdf=%PDF-1.4\n", "logo.png=\x89PNG\r\n\x1a\n"},
+		},
+		{
+			file:            "encoded-words.eml",
+			wantSender:      "juergen@example.com",
+			wantRecipients:  "office@example.com",
+			wantSubject:     "Rechnung für März",
+			wantBody:        "Grüße aus München",
+			wantAttachments: []string{"Rechnung März.pdf=%PDF-"},
+		},
+		{
+			file:           "malformed-headers.eml",
+			wantSender:     "sender@example.com",
+			wantRecipients: "orders@example.com",
+			wantSubject:    "Broken headers",
+			wantBody:       "Body after broken headers.",
+		},
+		{
+			file:            "unterminated-multipart.eml",
+			wantSender:      "sender@example.com",
+			wantRecipients:  "orders@example.com",
+			wantSubject:     "Truncated upload",
+			wantBody:        "The attachment is cut off.",
+			wantAttachments: []string{"report.csv=id,amount\r\n1,12.50"},
+		},
+		{
+			file:           "multipart-without-boundary.eml",
+			wantSender:     "sender@example.com",
+			wantRecipients: "orders@example.com",
+			wantSubject:    "No boundary",
+			wantBody:       "Plain text in a multipart without boundary.",
+		},
+		{
+			file:            "corrupt-base64.eml",
+			wantSender:      "scanner@example.com",
+			wantRecipients:  "orders@example.com",
+			wantSubject:     "Scan",
+			wantBody:        "Scanned document",
+			wantAttachments: []string{"scan.pdf=%PDF-1.4\n"},
+		},
+		{
+			file:           "raw-8bit-header.eml",
+			wantSender:     "shop@example.com",
+			wantRecipients: "orders@example.com",
+			wantSubject:    "Bestellbestätigung München",
+			wantBody:       "Grüße",
+		},
+		{
+			file:            "forwarded.eml",
+			wantSender:      "alice@example.com",
+			wantRecipients:  "invoices@example.com",
+			wantSubject:     "Fwd: Invoice 1234",
+			wantBody:        "See the attached vendor mail.",
+			wantAttachments: []string{"Invoice 1234.eml=From: billing@vendor.example\r\nTo: alice@example.com\r\nSubject: Invoice 1234\r\nContent-Type: text/plain\r\n\r\nAmount due: 99.00 EUR"},
+			wantEmbedded:    1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			raw, err := os.ReadFile(filepath.Join("testdata", "mime", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := Parse(tt.file, raw)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if m.Sender != tt.wantSender {
+				t.Errorf("Sender = %q, want %q", m.Sender, tt.wantSender)
+			}
+			if got := strings.Join(m.Recipients, ","); got != tt.wantRecipients {
+				t.Errorf("Recipients = %q, want %q", got, tt.wantRecipients)
+			}
+			if m.Subject != tt.wantSubject {
+				t.Errorf("Subject = %q, want %q", m.Subject, tt.wantSubject)
+			}
+			if got := strings.TrimSpace(m.Body); got != tt.wantBody {
+				t.Errorf("Body = %q, want %q", got, tt.wantBody)
+			}
+			if got := strings.TrimSpace(m.HTMLBody); got != tt.wantHTMLBody {
+				t.Errorf("HTMLBody = %q, want %q", got, tt.wantHTMLBody)
+			}
+			var gotAttachments []string
+			for _, a := range m.Attachments {
+				gotAttachments = append(gotAttachments, a.Name+"="+string(a.Content))
+			}
+			if strings.Join(gotAttachments, "|") != strings.Join(tt.wantAttachments, "|") {
+				t.Errorf("Attachments = %q, want %q", gotAttachments, tt.wantAttachments)
+			}
+			if len(m.Embedded) != tt.wantEmbedded {
+				t.Errorf("Embedded = %d mails, want %d", len(m.Embedded), tt.wantEmbedded)
+			}
+		})
+	}
+
+	// Every fixture must be covered by the table above.
+	files, err := filepath.Glob(filepath.Join("testdata", "mime", "*.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(tests) {
+		t.Errorf("testdata/mime holds %d fixtures, the table covers %d", len(files), len(tests))
+	}
+}
+
+func TestParse_rejectsMessagesWithoutHeaders(t *testing.T) {
+	for _, raw := range []string{"", "\r\njust a body\r\n", "no header fields at all"} {
+		if _, err := Parse("1", []byte(raw)); err == nil {
+			t.Errorf("Parse(%q) error = nil, want an error", raw)
+		}
+	}
+}
+
+func TestParse_boundsMultipartNesting(t *testing.T) {
+	// 30000 nested multiparts walked level by level would take quadratic time and memory.
+	const levels = 30000
+	var b strings.Builder
+	b.WriteString("From: sender@example.com\r\nSubject: Nested\r\nContent-Type: multipart/mixed; boundary=b0\r\n\r\n")
+	for i := 1; i < levels; i++ {
+		fmt.Fprintf(&b, "--b%d\r\nContent-Type: multipart/mixed; boundary=b%d\r\n\r\n", i-1, i)
+	}
+	fmt.Fprintf(&b, "--b%d\r\nContent-Type: text/plain\r\n\r\ntoo deep\r\n", levels-1)
+	for i := levels - 1; i >= 0; i-- {
+		fmt.Fprintf(&b, "--b%d--\r\n", i)
+	}
+
+	m, err := Parse("1", []byte(b.String()))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if m.Body != "" {
+		t.Errorf("Body = %q, want the text beyond the nesting limit left unparsed", m.Body)
+	}
+	if len(m.Attachments) != 1 || !strings.HasPrefix(m.Attachments[0].ContentType, "multipart/") {
+		t.Fatalf("Attachments = %d, want the remaining multipart kept as one opaque attachment", len(m.Attachments))
+	}
+	if !strings.Contains(string(m.Attachments[0].Content), "too deep") {
+		t.Errorf("opaque attachment does not hold the rest of the message")
+	}
+}
@@ -0,0 +1,234 @@
+package message
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Compressed RTF ([MS-OXRTFCP]) header magic values.
+const (
+	rtfCompressed   = 0x75465A4C // "LZFu"
+	rtfUncompressed = 0x414C454D // "MELA"
+)
+
+// rtfDictionaryInit is the text the LZFu dictionary starts with.
+const rtfDictionaryInit = `{\rtf1\ansi\mac\deff0\deftab720{\fonttbl;}{\f0\fnil \froman \fswiss \fmodern \fscript \fdecor MS Sans SerifSymbolArialTimes New RomanCourier{\colortbl\red0\green0\blue0` +
+	"\r\n" + `\par \pard\plain\f0\fs20\b\i\u\tab\tx`
+
+// decompressRTF decompresses a PR_RTF_COMPRESSED value. The CRC is not verified.
+func decompressRTF(data []byte) ([]byte, error) {
+	if len(data) < 16 {
+		return nil, errors.New("compressed RTF header too short")
+	}
+	compSize := binary.LittleEndian.Uint32(data[0:4])
+	rawSize := binary.LittleEndian.Uint32(data[4:8])
+	magic := binary.LittleEndian.Uint32(data[8:12])
+	body := data[16:]
+	if end := int(compSize) - 12; end >= 0 && end < len(body) {
+		body = body[:end]
+	}
+	switch magic {
+	case rtfUncompressed:
+		if int(rawSize) < len(body) {
+			body = body[:rawSize]
+		}
+		return body, nil
+	case rtfCompressed:
+	default:
+		return nil, fmt.Errorf("unknown compressed RTF type 0x%08X", magic)
+	}
+
+	var dict [4096]byte
+	copy(dict[:], rtfDictionaryInit)
+	write := len(rtfDictionaryInit)
+	out := make([]byte, 0, rawSize)
+	for i := 0; i < len(body); {
+		control := body[i]
+		i++
+		for bit := 0; bit < 8 && i < len(body); bit++ {
+			if control&(1<<bit) == 0 {
+				out = append(out, body[i])
+				dict[write%4096] = body[i]
+				write++
+				i++
+				continue
+			}
+			if i+1 >= len(body) {
+				return out, nil
+			}
+			ref := int(body[i])<<8 | int(body[i+1])
+			i += 2
+			offset, length := ref>>4, ref&0xF+2
+			if offset == write%4096 {
+				// A reference to the write position ends the stream.
+				return out, nil
+			}
+			for k := 0; k < length; k++ {
+				c := dict[(offset+k)%4096]
+				out = append(out, c)
+				dict[write%4096] = c
+				write++
+			}
+		}
+	}
+	return out, nil
+}
+
+// rtfSkippedDestinations are groups whose content is not part of the document text.
+var rtfSkippedDestinations = map[string]bool{
+	"fonttbl": true, "colortbl": true, "stylesheet": true, "info": true, "pict": true,
+	"object": true, "header": true, "footer": true, "listtable": true, "listoverridetable": true,
+	"rsidtbl": true, "generator": true, "xmlnstbl": true, "themedata": true, "filetbl": true,
+	"colorschememapping": true, "latentstyles": true, "datastore": true, "revtbl": true,
+}
+
+// rtfSymbols maps control words to the text they stand for.
+var rtfSymbols = map[string]string{
+	"par": "\n", "line": "\n", "row": "\n", "sect": "\n", "page": "\n", "tab": "\t", "cell": " ",
+	"emdash": "—", "endash": "–", "bullet": "•", "lquote": "‘", "rquote": "’",
+	"ldblquote": "“", "rdblquote": "”", "emspace": " ", "enspace": " ",
+}
+
+// rtfToText extracts the readable text of an RTF document. Outlook's encapsulated HTML
+// (\fromhtml) is handled by dropping the \*\htmltag groups and the \htmlrtf sections that only
+// exist for RTF readers.
+func rtfToText(rtf []byte) string {
+	type group struct {
+		skip bool
+		uc   int
+	}
+	var (
+		b        strings.Builder
+		pending  []byte // 8-bit text awaiting codepage decoding
+		codepage = 1252
+		stack    []group
+		cur      = group{uc: 1}
+		htmlrtf  bool
+		ucSkip   int
+	)
+	flush := func() {
+		if len(pending) > 0 {
+			b.WriteString(DecodeText(pending, "", fmt.Sprintf("windows-%d", codepage)))
+			pending = pending[:0]
+		}
+	}
+	emit := func(c byte) {
+		if ucSkip > 0 {
+			ucSkip--
+			return
+		}
+		if cur.skip || htmlrtf {
+			return
+		}
+		pending = append(pending, c)
+	}
+	emitString := func(s string) {
+		if cur.skip || htmlrtf {
+			return
+		}
+		flush()
+		b.WriteString(s)
+	}
+
+	for i := 0; i < len(rtf); i++ {
+		c := rtf[i]
+		switch c {
+		case '{':
+			stack = append(stack, cur)
+		case '}':
+			if len(stack) > 0 {
+				cur = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+		case '\r', '\n':
+		case '\\':
+			if i+1 >= len(rtf) {
+				break
+			}
+			next := rtf[i+1]
+			switch {
+			case next == '\\' || next == '{' || next == '}':
+				emit(next)
+				i++
+			case next == '\'':
+				if i+3 < len(rtf) {
+					if v, err := strconv.ParseUint(string(rtf[i+2:i+4]), 16, 8); err == nil {
+						emit(byte(v))
+					}
+				}
+				i += 3
+			case next == '*':
+				cur.skip = true
+				i++
+			case next == '~':
+				emitString(" ")
+				i++
+			case next == '_':
+				emitString("-")
+				i++
+			case next == '\r' || next == '\n':
+				emitString("\n")
+				i++
+			case isASCIILetter(next):
+				j := i + 1
+				for j < len(rtf) && isASCIILetter(rtf[j]) {
+					j++
+				}
+				word := string(rtf[i+1 : j])
+				k := j
+				if k < len(rtf) && rtf[k] == '-' {
+					k++
+				}
+				for k < len(rtf) && rtf[k] >= '0' && rtf[k] <= '9' {
+					k++
+				}
+				param, hasParam := 0, k > j
+				if hasParam {
+					param, _ = strconv.Atoi(string(rtf[j:k]))
+				}
+				if k < len(rtf) && rtf[k] == ' ' {
+					k++
+				}
+				i = k - 1
+				switch {
+				case rtfSkippedDestinations[word]:
+					cur.skip = true
+				case word == "htmlrtf":
+					htmlrtf = !hasParam || param != 0
+				case word == "ansicpg" && hasParam:
+					flush()
+					codepage = param
+				case word == "uc" && hasParam:
+					cur.uc = param
+				case word == "u" && hasParam:
+					if param < 0 {
+						param += 65536
+					}
+					emitString(string(rune(param)))
+					ucSkip = cur.uc
+				case rtfSymbols[word] != "":
+					emitString(rtfSymbols[word])
+				}
+			default:
+				// Other control symbols such as \- (optional hyphen) carry no text.
+				i++
+			}
+		default:
+			emit(c)
+		}
+	}
+	flush()
+
+	lines := strings.Split(b.String(), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " \t")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+func isASCIILetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
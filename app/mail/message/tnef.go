@@ -0,0 +1,413 @@
+package message
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"golang.org/x/text/encoding/unicode"
+)
+
+// tnefSignature starts every TNEF stream (winmail.dat), stored little-endian.
+const tnefSignature = 0x223E9F78
+
+// TNEF attribute levels and the IDs (lower 16 bits of the attribute) read by decodeTNEF.
+const (
+	tnefLevelMessage    = 0x01
+	tnefLevelAttachment = 0x02
+
+	tnefAttBody           = 0x800C
+	tnefAttAttachData     = 0x800F
+	tnefAttAttachTitle    = 0x8010
+	tnefAttAttachRendData = 0x9002
+	tnefAttMsgProps       = 0x9003
+	tnefAttAttachment     = 0x9005
+	tnefAttOemCodepage    = 0x9007
+)
+
+// MAPI property IDs read from the message and attachment property lists.
+const (
+	mapiBody               = 0x1000
+	mapiRTFCompressed      = 0x1009
+	mapiBodyHTML           = 0x1013
+	mapiDisplayName        = 0x3001
+	mapiAttachData         = 0x3701
+	mapiAttachFilename     = 0x3704
+	mapiAttachLongFilename = 0x3707
+	mapiAttachMimeTag      = 0x370E
+	mapiAttachContentID    = 0x3712
+	mapiAttachFlags        = 0x3714
+	mapiAttachmentHidden   = 0x7FFE
+)
+
+// MAPI property types. Multi-valued types carry mapiMultiValued in addition to the base type.
+const (
+	mapiTypeShort    = 0x0002
+	mapiTypeLong     = 0x0003
+	mapiTypeFloat    = 0x0004
+	mapiTypeDouble   = 0x0005
+	mapiTypeCurrency = 0x0006
+	mapiTypeAppTime  = 0x0007
+	mapiTypeError    = 0x000A
+	mapiTypeBoolean  = 0x000B
+	mapiTypeObject   = 0x000D
+	mapiTypeI8       = 0x0014
+	mapiTypeString8  = 0x001E
+	mapiTypeUnicode  = 0x001F
+	mapiTypeSysTime  = 0x0040
+	mapiTypeCLSID    = 0x0048
+	mapiTypeBinary   = 0x0102
+	mapiMultiValued  = 0x1000
+)
+
+// attachFlagMHTMLRef marks an attachment referenced by the HTML body (PR_ATTACH_FLAGS).
+const attachFlagMHTMLRef = 0x4
+
+// tnefContent is the decoded content of a TNEF stream.
+type tnefContent struct {
+	Body        string
+	HTMLBody    string
+	Attachments []Attachment
+}
+
+// isTNEF reports whether a is a TNEF stream: an application/ms-tnef part or a winmail.dat file
+// that starts with the TNEF signature.
+func isTNEF(a Attachment) bool {
+	if len(a.Content) < 6 || binary.LittleEndian.Uint32(a.Content) != tnefSignature {
+		return false
+	}
+	switch strings.ToLower(a.ContentType) {
+	case "application/ms-tnef", "application/vnd.ms-tnef":
+		return true
+	}
+	return strings.EqualFold(a.Name, "winmail.dat")
+}
+
+// ExpandTNEFAttachments replaces the TNEF attachments of m (winmail.dat from Outlook) with the
+// files they contain, so that selectors and attachment strategies see e.g. "invoice-123.pdf".
+// The plain, RTF or HTML body of the TNEF stream fills Body and HTMLBody when the mail has none.
+// A stream that cannot be decoded is kept as it is.
+func ExpandTNEFAttachments(m *Mail) {
+	var expanded []Attachment
+	found := false
+	for _, a := range m.Attachments {
+		if !isTNEF(a) {
+			expanded = append(expanded, a)
+			continue
+		}
+		content, err := decodeTNEF(a.Content)
+		if err != nil {
+			slog.Warn("error decoding TNEF attachment; forwarding it undecoded", "mailId", m.Id, "name", a.Name, "error", err)
+			expanded = append(expanded, a)
+			continue
+		}
+		found = true
+		expanded = append(expanded, content.Attachments...)
+		if strings.TrimSpace(m.Body) == "" {
+			m.Body = content.Body
+		}
+		if m.HTMLBody == "" {
+			m.HTMLBody = content.HTMLBody
+		}
+	}
+	if found {
+		m.Attachments = expanded
+		ApplyHTMLFallback(m)
+	}
+}
+
+// tnefAttachment collects the attributes of one attachment until it is complete.
+type tnefAttachment struct {
+	title   string
+	data    []byte
+	props   map[uint16]mapiValue
+	hasData bool
+}
+
+// decodeTNEF decodes a TNEF stream as described in [MS-OXTNEF]: the message body from attBody or
+// the PR_BODY, PR_BODY_HTML and PR_RTF_COMPRESSED properties, and every attachment with its long
+// filename, MIME type and content ID. Checksums are not verified.
+func decodeTNEF(data []byte) (tnefContent, error) {
+	r := &byteReader{data: data}
+	if r.u32() != tnefSignature {
+		return tnefContent{}, errors.New("missing TNEF signature")
+	}
+	r.u16() // legacy key
+
+	var (
+		content  tnefContent
+		codepage uint32
+		msgProps map[uint16]mapiValue
+		plain    string
+		atts     []*tnefAttachment
+	)
+	current := func() *tnefAttachment {
+		if len(atts) == 0 {
+			atts = append(atts, &tnefAttachment{})
+		}
+		return atts[len(atts)-1]
+	}
+	for r.remaining() > 0 {
+		level := r.u8()
+		id := uint16(r.u32())
+		value := r.bytes(int(r.u32()))
+		r.u16() // checksum
+		if r.err != nil {
+			if len(atts) == 0 && msgProps == nil && plain == "" {
+				return tnefContent{}, fmt.Errorf("truncated TNEF stream: %w", r.err)
+			}
+			slog.Warn("truncated TNEF stream; keeping the attributes read so far", "error", r.err)
+			break
+		}
+		switch {
+		case id == tnefAttOemCodepage && len(value) >= 4:
+			codepage = binary.LittleEndian.Uint32(value)
+		case level == tnefLevelMessage && id == tnefAttBody:
+			plain = decodeString8(value, codepage)
+		case level == tnefLevelMessage && id == tnefAttMsgProps:
+			props, err := parseMAPIProps(value)
+			if err != nil {
+				slog.Warn("error reading TNEF message properties", "error", err)
+			}
+			msgProps = props
+		case level == tnefLevelAttachment && id == tnefAttAttachRendData:
+			atts = append(atts, &tnefAttachment{})
+		case level == tnefLevelAttachment && id == tnefAttAttachTitle:
+			current().title = decodeString8(value, codepage)
+		case level == tnefLevelAttachment && id == tnefAttAttachData:
+			current().data, current().hasData = value, true
+		case level == tnefLevelAttachment && id == tnefAttAttachment:
+			props, err := parseMAPIProps(value)
+			if err != nil {
+				slog.Warn("error reading TNEF attachment properties", "error", err)
+			}
+			current().props = props
+		}
+	}
+
+	content.Body = plain
+	if v, ok := msgProps[mapiBody]; ok && strings.TrimSpace(content.Body) == "" {
+		content.Body = v.text(codepage)
+	}
+	if v, ok := msgProps[mapiBodyHTML]; ok {
+		if v.typ == mapiTypeBinary {
+			content.HTMLBody = DecodeText(v.first(), "text/html", "")
+		} else {
+			content.HTMLBody = v.text(codepage)
+		}
+	}
+	if v, ok := msgProps[mapiRTFCompressed]; ok && strings.TrimSpace(content.Body) == "" {
+		rtf, err := decompressRTF(v.first())
+		if err != nil {
+			slog.Warn("error decompressing TNEF RTF body", "error", err)
+		} else {
+			content.Body = rtfToText(rtf)
+		}
+	}
+
+	for i, a := range atts {
+		if !a.hasData && len(a.props) == 0 {
+			continue
+		}
+		content.Attachments = append(content.Attachments, a.attachment(i, codepage))
+	}
+	return content, nil
+}
+
+// attachment builds the Attachment from the collected attributes. The long filename in the MAPI
+// properties takes precedence over the 8.3 title; PR_ATTACH_DATA_OBJ is used without attAttachData.
+func (a *tnefAttachment) attachment(idx int, codepage uint32) Attachment {
+	name := a.title
+	for _, id := range []uint16{mapiAttachFilename, mapiDisplayName, mapiAttachLongFilename} {
+		if v, ok := a.props[id]; ok {
+			if s := v.text(codepage); s != "" {
+				name = s
+			}
+		}
+	}
+	if name == "" {
+		name = fmt.Sprintf("attachment-%d", idx+1)
+	}
+	data := a.data
+	if v, ok := a.props[mapiAttachData]; ok && !a.hasData {
+		data = v.first()
+		if v.typ == mapiTypeObject && len(data) >= 16 {
+			// Embedded objects start with the interface identifier.
+			data = data[16:]
+		}
+	}
+	var contentType, contentID string
+	if v, ok := a.props[mapiAttachMimeTag]; ok {
+		contentType = v.text(codepage)
+	}
+	if v, ok := a.props[mapiAttachContentID]; ok {
+		contentID = v.text(codepage)
+	}
+	inline := false
+	if v, ok := a.props[mapiAttachFlags]; ok && len(v.first()) >= 4 {
+		inline = binary.LittleEndian.Uint32(v.first())&attachFlagMHTMLRef != 0
+	}
+	if v, ok := a.props[mapiAttachmentHidden]; ok && len(v.first()) >= 1 && v.first()[0] != 0 {
+		inline = true
+	}
+	return NewAttachment(name, data, contentType, contentID, inline)
+}
+
+// mapiValue is a property value; values holds one entry per value of multi-valued properties.
+type mapiValue struct {
+	typ    uint16
+	values [][]byte
+}
+
+func (v mapiValue) first() []byte {
+	if len(v.values) == 0 {
+		return nil
+	}
+	return v.values[0]
+}
+
+// text decodes a PT_UNICODE or PT_STRING8 value, using codepage for the latter.
+func (v mapiValue) text(codepage uint32) string {
+	switch v.typ {
+	case mapiTypeUnicode:
+		decoded, err := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewDecoder().Bytes(v.first())
+		if err != nil {
+			return ""
+		}
+		return strings.TrimRight(string(decoded), "\x00")
+	case mapiTypeString8:
+		return decodeString8(v.first(), codepage)
+	default:
+		return ""
+	}
+}
+
+// decodeString8 decodes a NUL-terminated 8-bit string in the Windows codepage of the stream.
+func decodeString8(b []byte, codepage uint32) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	label := ""
+	if codepage != 0 {
+		label = fmt.Sprintf("windows-%d", codepage)
+	}
+	return DecodeText(b, "", label)
+}
+
+// parseMAPIProps reads a MAPI property list ([MS-OXTNEF] 2.1.3.4). On malformed input it returns
+// the properties read so far along with the error.
+func parseMAPIProps(data []byte) (map[uint16]mapiValue, error) {
+	r := &byteReader{data: data}
+	props := make(map[uint16]mapiValue)
+	count := r.u32()
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		typ := r.u16()
+		id := r.u16()
+		if id >= 0x8000 {
+			// Named property: GUID, kind and either a numeric ID or a UTF-16 name.
+			r.bytes(16)
+			if r.u32() == 0 {
+				r.u32()
+			} else {
+				r.bytes(int(r.u32()))
+				r.pad4()
+			}
+		}
+		base := typ &^ mapiMultiValued
+		v := mapiValue{typ: base}
+		switch base {
+		case mapiTypeString8, mapiTypeUnicode, mapiTypeBinary, mapiTypeObject:
+			n := r.u32()
+			for j := uint32(0); j < n && r.err == nil; j++ {
+				v.values = append(v.values, r.bytes(int(r.u32())))
+				r.pad4()
+			}
+		default:
+			size := mapiFixedSize(base)
+			if size == 0 {
+				return props, fmt.Errorf("unsupported MAPI property type 0x%04X", typ)
+			}
+			n := uint32(1)
+			if typ&mapiMultiValued != 0 {
+				n = r.u32()
+			}
+			for j := uint32(0); j < n && r.err == nil; j++ {
+				v.values = append(v.values, r.bytes(size))
+			}
+		}
+		if r.err != nil {
+			return props, r.err
+		}
+		props[id] = v
+	}
+	return props, r.err
+}
+
+// mapiFixedSize returns the encoded size of a fixed-length property value, 0 for unknown types.
+// Values shorter than four bytes are padded to four.
+func mapiFixedSize(typ uint16) int {
+	switch typ {
+	case mapiTypeShort, mapiTypeLong, mapiTypeFloat, mapiTypeError, mapiTypeBoolean:
+		return 4
+	case mapiTypeDouble, mapiTypeCurrency, mapiTypeAppTime, mapiTypeI8, mapiTypeSysTime:
+		return 8
+	case mapiTypeCLSID:
+		return 16
+	default:
+		return 0
+	}
+}
+
+// byteReader reads little-endian values; after the first short read err is set and every
+// further read returns zero values.
+type byteReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *byteReader) remaining() int { return len(r.data) - r.pos }
+
+func (r *byteReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > r.remaining() {
+		r.err = fmt.Errorf("unexpected end of data at offset %d", r.pos)
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *byteReader) u8() uint8 {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *byteReader) u16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *byteReader) u32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+// pad4 skips the padding that aligns variable-length values to four bytes.
+func (r *byteReader) pad4() {
+	if rem := r.pos % 4; rem != 0 && r.err == nil {
+		r.bytes(4 - rem)
+	}
+}
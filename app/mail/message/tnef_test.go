@@ -0,0 +1,202 @@
+package message
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// tnefStream builds a TNEF stream from attributes made with tnefAttr.
+func tnefStream(attrs ...[]byte) []byte {
+	b := binary.LittleEndian.AppendUint32(nil, tnefSignature)
+	b = binary.LittleEndian.AppendUint16(b, 0x0001)
+	for _, a := range attrs {
+		b = append(b, a...)
+	}
+	return b
+}
+
+func tnefAttr(level byte, id uint32, data []byte) []byte {
+	b := []byte{level}
+	b = binary.LittleEndian.AppendUint32(b, id)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(data)))
+	b = append(b, data...)
+	var sum uint16
+	for _, c := range data {
+		sum += uint16(c)
+	}
+	return binary.LittleEndian.AppendUint16(b, sum)
+}
+
+// mapiProps builds a MAPI property list from properties made with mapiProp.
+func mapiProps(props ...[]byte) []byte {
+	b := binary.LittleEndian.AppendUint32(nil, uint32(len(props)))
+	for _, p := range props {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// mapiProp encodes a single-valued variable-length property.
+func mapiProp(typ, id uint16, value []byte) []byte {
+	b := binary.LittleEndian.AppendUint16(nil, typ)
+	b = binary.LittleEndian.AppendUint16(b, id)
+	b = binary.LittleEndian.AppendUint32(b, 1)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(value)))
+	b = append(b, value...)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func utf16z(s string) []byte {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s + "\x00")) {
+		b = binary.LittleEndian.AppendUint16(b, u)
+	}
+	return b
+}
+
+// compressedRTFExample is the "Simple Compressed RTF" example of [MS-OXRTFCP].
+var compressedRTFExample = []byte{
+	0x2d, 0x00, 0x00, 0x00, 0x2b, 0x00, 0x00, 0x00, 0x4c, 0x5a, 0x46, 0x75, 0xf1, 0xc5, 0xc7, 0xa7,
+	0x03, 0x00, 0x0a, 0x00, 0x72, 0x63, 0x70, 0x67, 0x31, 0x32, 0x35, 0x42, 0x32, 0x0a, 0xf3, 0x20,
+	0x68, 0x65, 0x6c, 0x09, 0x00, 0x20, 0x62, 0x77, 0x05, 0xb0, 0x6c, 0x64, 0x7d, 0x0a, 0x80, 0x0f,
+	0xa0,
+}
+
+func winmailDat() []byte {
+	return tnefStream(
+		tnefAttr(tnefLevelMessage, 0x00089006, []byte{0, 0, 1, 0}),
+		tnefAttr(tnefLevelMessage, 0x00069007, []byte{0xe4, 0x04, 0, 0, 0, 0, 0, 0}), // codepage 1252
+		tnefAttr(tnefLevelMessage, 0x00069003, mapiProps(
+			mapiProp(mapiTypeBinary, mapiRTFCompressed, compressedRTFExample),
+		)),
+		tnefAttr(tnefLevelAttachment, 0x00069002, make([]byte, 14)),
+		tnefAttr(tnefLevelAttachment, 0x00018010, []byte("INVOIC~1.PDF\x00")),
+		tnefAttr(tnefLevelAttachment, 0x0006800F, []byte("%PDF-1.4")),
+		tnefAttr(tnefLevelAttachment, 0x00069005, mapiProps(
+			mapiProp(mapiTypeUnicode, mapiAttachLongFilename, utf16z("invoice-123.pdf")),
+			mapiProp(mapiTypeString8, mapiAttachMimeTag, []byte("application/pdf\x00")),
+		)),
+		tnefAttr(tnefLevelAttachment, 0x00069002, make([]byte, 14)),
+		tnefAttr(tnefLevelAttachment, 0x00018010, []byte("Notizen f\xfcr M\xe4rz.txt\x00")),
+		tnefAttr(tnefLevelAttachment, 0x0006800F, []byte("notes")),
+	)
+}
+
+func TestDecodeTNEF(t *testing.T) {
+	content, err := decodeTNEF(winmailDat())
+	if err != nil {
+		t.Fatalf("decodeTNEF() error = %v", err)
+	}
+	if content.Body != "hello world" {
+		t.Errorf("Body = %q, want the text of the compressed RTF body", content.Body)
+	}
+	if len(content.Attachments) != 2 {
+		t.Fatalf("Attachments = %+v, want 2", content.Attachments)
+	}
+	pdf, notes := content.Attachments[0], content.Attachments[1]
+	if pdf.Name != "invoice-123.pdf" || pdf.ContentType != "application/pdf" || string(pdf.Content) != "%PDF-1.4" {
+		t.Errorf("first attachment = %q, %q, %q; want invoice-123.pdf", pdf.Name, pdf.ContentType, pdf.Content)
+	}
+	if notes.Name != "Notizen für März.txt" || notes.ContentType != "text/plain" || string(notes.Content) != "notes" {
+		t.Errorf("second attachment = %q, %q, %q; want the title decoded from codepage 1252", notes.Name, notes.ContentType, notes.Content)
+	}
+}
+
+func TestDecodeTNEF_truncated(t *testing.T) {
+	data := winmailDat()
+	if _, err := decodeTNEF(data[:12]); err == nil {
+		t.Error("decodeTNEF() of a truncated header error = nil, want an error")
+	}
+	// The data of the second attachment is cut off.
+	content, err := decodeTNEF(data[:len(data)-8])
+	if err != nil || len(content.Attachments) != 1 || content.Attachments[0].Name != "invoice-123.pdf" {
+		t.Errorf("decodeTNEF() of a truncated stream = %+v, %v; want the complete attachment", content.Attachments, err)
+	}
+}
+
+func TestParse_winmailDat(t *testing.T) {
+	raw := "From: buyer@outlook.example\r\nSubject: Invoice 123\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: application/ms-tnef; name=\"winmail.dat\"\r\n" +
+		"Content-Disposition: attachment; filename=\"winmail.dat\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n\r\n" +
+		base64.StdEncoding.EncodeToString(winmailDat()) + "\r\n--b--\r\n"
+
+	m, err := Parse("1", []byte(raw))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	var names []string
+	for _, a := range m.Attachments {
+		names = append(names, a.Name)
+	}
+	if strings.Join(names, ",") != "invoice-123.pdf,Notizen für März.txt" {
+		t.Errorf("Attachments = %v, want the files of winmail.dat", names)
+	}
+	if m.Body != "hello world" {
+		t.Errorf("Body = %q, want the TNEF body", m.Body)
+	}
+}
+
+func TestExpandTNEFAttachments_keepsUndecodableStreams(t *testing.T) {
+	broken := tnefStream([]byte{tnefLevelMessage, 0x01})
+	m := Mail{Body: "see attachment", Attachments: []Attachment{
+		NewAttachment("winmail.dat", broken, "application/ms-tnef", "", false),
+		NewAttachment("winmail.dat", []byte("not tnef"), "application/octet-stream", "", false),
+	}}
+
+	ExpandTNEFAttachments(&m)
+
+	if len(m.Attachments) != 2 || m.Body != "see attachment" {
+		t.Errorf("ExpandTNEFAttachments() = %+v, want the mail unchanged", m)
+	}
+}
+
+func TestDecompressRTF(t *testing.T) {
+	got, err := decompressRTF(compressedRTFExample)
+	if err != nil {
+		t.Fatalf("decompressRTF() error = %v", err)
+	}
+	if want := "{\\rtf1\\ansi\\ansicpg1252\\pard hello world}\r\n"; string(got) != want {
+		t.Errorf("decompressRTF() = %q, want %q", got, want)
+	}
+}
+
+func TestRTFToText(t *testing.T) {
+	tests := []struct {
+		name string
+		rtf  string
+		want string
+	}{
+		{
+			name: "paragraphs and font table",
+			rtf:  `{\rtf1\ansi{\fonttbl{\f0 Arial;}}\f0\fs20 Invoice 123\par Total: 12.50\par}`,
+			want: "Invoice 123\nTotal: 12.50",
+		},
+		{
+			name: "codepage escapes and unicode",
+			rtf:  `{\rtf1\ansi\ansicpg1252 Gr\'fc\'dfe \u8364? 5\emdash ok}`,
+			want: "Grüße € 5—ok",
+		},
+		{
+			name: "encapsulated html",
+			rtf: `{\rtf1\ansi\fromhtml1 {\*\htmltag64 <p>}\htmlrtf {\htmlrtf0 Please pay ` +
+				`{\*\htmltag84 <b>}\htmlrtf \b \htmlrtf0 invoice 123\htmlrtf \b0\htmlrtf0 {\*\htmltag92 </b>}.}` +
+				`\htmlrtf }\htmlrtf0 {\*\htmltag72 </p>}}`,
+			want: "Please pay invoice 123.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rtfToText([]byte(tt.rtf)); got != tt.want {
+				t.Errorf("rtfToText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
+	"github.com/jo-hoe/go-mail-webhook-service/app/mail/message"
+)
+
+// POP3Service implements MailClientService against a POP3 server.
+// POP3 has no read flag, so processed messages are tracked by UIDL in a ledger file.
+// Mail.Id holds the message UIDL.
+type POP3Service struct {
+	cfg    config.POP3Client
+	ledger *idLedger
+	// deleteMu guards pendingDeletes, the UIDLs queued by DeleteMail since the last CommitCheckpoint.
+	deleteMu       sync.Mutex
+	pendingDeletes []string
+}
+
+// NewPOP3Service creates a POP3Service for the given configuration.
+func NewPOP3Service(cfg config.POP3Client) *POP3Service {
+	return &POP3Service{cfg: cfg, ledger: &idLedger{path: cfg.LedgerPath, kind: "POP3"}}
+}
+
+func (s *POP3Service) GetAllUnreadMail(ctx context.Context) ([]Mail, error) {
+	c, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+
+	listing, err := c.uidl()
+	if err != nil {
+		return nil, fmt.Errorf("list POP3 message UIDLs: %w", err)
+	}
+
+	s.ledger.mu.Lock()
+	defer s.ledger.mu.Unlock()
+	ledger, err := s.ledger.load()
+	if err != nil {
+		return nil, err
+	}
+	present := make(map[string]bool, len(listing))
+	for _, entry := range listing {
+		present[entry.uidl] = true
+	}
+	s.ledger.prune(ledger, present)
+
+	result := make([]Mail, 0, len(listing))
+	for _, entry := range listing {
+		if ledger[entry.uidl] {
+			continue
+		}
+		raw, err := c.retr(entry.number)
+		if err != nil {
+			return nil, fmt.Errorf("retrieve POP3 message %s: %w", entry.uidl, err)
+		}
+		m, err := message.Parse(entry.uidl, raw)
+		if err != nil {
+			slog.Error("error parsing pop3 message", "uidl", entry.uidl, "error", err)
+			continue
+		}
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+// MarkMailAsRead records the mail's UIDL in the ledger so that it is skipped on later runs.
+func (s *POP3Service) MarkMailAsRead(_ context.Context, mail Mail) error {
+	if err := s.ledger.record(mail.Id); err != nil {
+		return fmt.Errorf("mark message as read (mail %s): %w", mail.Id, err)
+	}
+	return nil
+}
+
+// DeleteMail records the mail's UIDL in the ledger and queues the message for deletion by
+// CommitCheckpoint. Servers lock the maildrop for the duration of a session, so the mails
+// processed concurrently are deleted together in a single session after the run.
+func (s *POP3Service) DeleteMail(_ context.Context, mail Mail) error {
+	if err := s.ledger.record(mail.Id); err != nil {
+		return fmt.Errorf("delete message (mail %s): %w", mail.Id, err)
+	}
+	s.deleteMu.Lock()
+	defer s.deleteMu.Unlock()
+	s.pendingDeletes = append(s.pendingDeletes, mail.Id)
+	return nil
+}
+
+// CommitCheckpoint issues DELE for the messages queued by DeleteMail in one session; the deletions
+// are committed on QUIT. Failed mails need no bookkeeping since they are not in the ledger.
+func (s *POP3Service) CommitCheckpoint(ctx context.Context, _ []Mail) error {
+	s.deleteMu.Lock()
+	uidls := s.pendingDeletes
+	s.pendingDeletes = nil
+	s.deleteMu.Unlock()
+	if len(uidls) == 0 {
+		return nil
+	}
+
+	c, err := s.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("delete %d messages: %w", len(uidls), err)
+	}
+	listing, err := c.uidl()
+	if err != nil {
+		c.close()
+		return fmt.Errorf("delete %d messages: %w", len(uidls), err)
+	}
+	numbers := make(map[string]int, len(listing))
+	for _, entry := range listing {
+		numbers[entry.uidl] = entry.number
+	}
+	for _, uidl := range uidls {
+		n, ok := numbers[uidl]
+		if !ok {
+			slog.Warn("message to delete is no longer on the POP3 server", "uidl", uidl)
+			continue
+		}
+		if _, err := c.cmd("DELE %d", n); err != nil {
+			// QUIT still commits the deletions issued so far.
+			c.close()
+			return fmt.Errorf("delete message (mail %s): %w", uidl, err)
+		}
+	}
+	if err := c.quit(); err != nil {
+		return fmt.Errorf("delete %d messages: commit on QUIT: %w", len(uidls), err)
+	}
+	return nil
+}
+
+// connect dials the server and authenticates with USER/PASS.
+func (s *POP3Service) connect(ctx context.Context) (*pop3Conn, error) {
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	tlsConfig := newTLSConfig(s.cfg.Host, s.cfg.InsecureSkipVerify)
+	dialer := newDialer(ctx)
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if s.cfg.Security == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("connect to POP3 server %s: %w", addr, err)
+	}
+	c := newPOP3Conn(conn)
+	if err := conn.SetDeadline(time.Now().Add(serverIOTimeout)); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if _, err := c.readResponse(); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("POP3 greeting from %s: %w", addr, err)
+	}
+
+	if s.cfg.Security == "starttls" {
+		if _, err := c.cmd("STLS"); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("STLS with POP3 server %s: %w", addr, err)
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("STLS handshake with POP3 server %s: %w", addr, err)
+		}
+		c = newPOP3Conn(tlsConn)
+	}
+
+	password, err := resolvePassword(s.cfg.Password, s.cfg.PasswordFile, "POP3")
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+	if _, err := c.cmd("USER %s", s.cfg.Username); err != nil {
+		c.close()
+		return nil, fmt.Errorf("login to POP3 server %s as %s: %w", addr, s.cfg.Username, err)
+	}
+	if _, err := c.cmd("PASS %s", password); err != nil {
+		c.close()
+		return nil, fmt.Errorf("login to POP3 server %s as %s: %w", addr, s.cfg.Username, err)
+	}
+	return c, nil
+}
+
+// pop3Entry maps a session-scoped message number to its persistent UIDL.
+type pop3Entry struct {
+	number int
+	uidl   string
+}
+
+// pop3Conn is a minimal RFC 1939 client connection.
+type pop3Conn struct {
+	conn net.Conn
+	text *textproto.Conn
+}
+
+func newPOP3Conn(conn net.Conn) *pop3Conn {
+	return &pop3Conn{conn: conn, text: textproto.NewConn(conn)}
+}
+
+// cmd sends a command and returns the text following "+OK". The command and the reading of its
+// response, including multi-line data, must complete within serverIOTimeout.
+func (c *pop3Conn) cmd(format string, args ...any) (string, error) {
+	if err := c.conn.SetDeadline(time.Now().Add(serverIOTimeout)); err != nil {
+		return "", err
+	}
+	if err := c.text.PrintfLine(format, args...); err != nil {
+		return "", err
+	}
+	return c.readResponse()
+}
+
+func (c *pop3Conn) readResponse() (string, error) {
+	line, err := c.text.ReadLine()
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(line, "+OK") {
+		return strings.TrimSpace(strings.TrimPrefix(line, "+OK")), nil
+	}
+	return "", fmt.Errorf("pop3 server error: %s", line)
+}
+
+// uidl lists message numbers and UIDLs of all messages in the maildrop.
+func (c *pop3Conn) uidl() ([]pop3Entry, error) {
+	if _, err := c.cmd("UIDL"); err != nil {
+		return nil, err
+	}
+	lines, err := c.text.ReadDotLines()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]pop3Entry, 0, len(lines))
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("malformed UIDL line %q", line)
+		}
+		n, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("malformed UIDL line %q: %w", line, err)
+		}
+		entries = append(entries, pop3Entry{number: n, uidl: fields[1]})
+	}
+	return entries, nil
+}
+
+// retr downloads the full message with the given number.
+func (c *pop3Conn) retr(number int) ([]byte, error) {
+	if _, err := c.cmd("RETR %d", number); err != nil {
+		return nil, err
+	}
+	return c.text.ReadDotBytes()
+}
+
+// quit ends the session, committing pending deletions, and closes the connection.
+func (c *pop3Conn) quit() error {
+	_, err := c.cmd("QUIT")
+	if cerr := c.text.Close(); cerr != nil {
+		slog.Debug("pop3 close failed", "error", cerr)
+	}
+	return err
+}
+
+// close ends the session on a best-effort basis.
+func (c *pop3Conn) close() {
+	if err := c.quit(); err != nil {
+		slog.Debug("pop3 quit failed", "error", err)
+	}
+}
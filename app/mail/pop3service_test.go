@@ -0,0 +1,281 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
+)
+
+// fakePOP3Server is a minimal in-process RFC 1939 server holding messages keyed by UIDL.
+// Like real servers it locks the maildrop from PASS until the session ends.
+type fakePOP3Server struct {
+	mu        sync.Mutex
+	uidls     []string
+	messages  map[string]string
+	retrieved []string
+	locked    bool
+	sessions  int
+}
+
+func (f *fakePOP3Server) serve(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakePOP3Server) handle(conn net.Conn) {
+	tp := textproto.NewConn(conn)
+	defer func() { _ = tp.Close() }()
+	_ = tp.PrintfLine("+OK ready")
+
+	var snapshot []string
+	deleted := map[int]bool{}
+	owner := false
+	defer func() {
+		if owner {
+			f.mu.Lock()
+			f.locked = false
+			f.mu.Unlock()
+		}
+	}()
+
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "USER":
+			_ = tp.PrintfLine("+OK")
+		case "PASS":
+			if len(fields) < 2 || fields[1] != "secret" {
+				_ = tp.PrintfLine("-ERR invalid password")
+				continue
+			}
+			f.mu.Lock()
+			if f.locked {
+				f.mu.Unlock()
+				_ = tp.PrintfLine("-ERR [IN-USE] maildrop already locked")
+				continue
+			}
+			f.locked, owner = true, true
+			f.sessions++
+			snapshot = append([]string(nil), f.uidls...)
+			f.mu.Unlock()
+			_ = tp.PrintfLine("+OK")
+		case "UIDL":
+			_ = tp.PrintfLine("+OK")
+			w := tp.DotWriter()
+			for i, u := range snapshot {
+				_, _ = fmt.Fprintf(w, "%d %s\r\n", i+1, u)
+			}
+			_ = w.Close()
+		case "RETR":
+			var n int
+			_, _ = fmt.Sscanf(fields[1], "%d", &n)
+			f.mu.Lock()
+			body := f.messages[snapshot[n-1]]
+			f.retrieved = append(f.retrieved, snapshot[n-1])
+			f.mu.Unlock()
+			_ = tp.PrintfLine("+OK")
+			w := tp.DotWriter()
+			_, _ = w.Write([]byte(body))
+			_ = w.Close()
+		case "DELE":
+			var n int
+			_, _ = fmt.Sscanf(fields[1], "%d", &n)
+			deleted[n] = true
+			_ = tp.PrintfLine("+OK")
+		case "QUIT":
+			f.mu.Lock()
+			kept := f.uidls[:0]
+			for i, u := range snapshot {
+				if !deleted[i+1] {
+					kept = append(kept, u)
+				}
+			}
+			f.uidls = kept
+			f.mu.Unlock()
+			_ = tp.PrintfLine("+OK bye")
+			return
+		default:
+			_ = tp.PrintfLine("-ERR unknown command")
+		}
+	}
+}
+
+func startTestPOP3Server(t *testing.T) (config.POP3Client, *fakePOP3Server) {
+	t.Helper()
+	f := &fakePOP3Server{
+		uidls: []string{"uid-1", "uid-2"},
+		messages: map[string]string{
+			"uid-1": "From: a@example.com\r\nSubject: first\r\n\r\nbody one\r\n",
+			"uid-2": "From: b@example.com\r\nSubject: second\r\n\r\nbody two\r\n",
+		},
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go f.serve(l)
+	t.Cleanup(func() { _ = l.Close() })
+
+	return config.POP3Client{
+		Enabled:    true,
+		Host:       "127.0.0.1",
+		Port:       l.Addr().(*net.TCPAddr).Port,
+		Security:   "none",
+		Username:   "user",
+		Password:   "secret",
+		LedgerPath: filepath.Join(t.TempDir(), "ledger.json"),
+	}, f
+}
+
+func TestPOP3Service_GetAllUnreadMail(t *testing.T) {
+	cfg, _ := startTestPOP3Server(t)
+	svc := NewPOP3Service(cfg)
+
+	mails, err := svc.GetAllUnreadMail(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllUnreadMail() error = %v", err)
+	}
+	if len(mails) != 2 {
+		t.Fatalf("GetAllUnreadMail() returned %d mails, want 2", len(mails))
+	}
+	if mails[0].Id != "uid-1" || mails[0].Subject != "first" || mails[0].Sender != "a@example.com" {
+		t.Errorf("first mail = %+v, want uid-1/first/a@example.com", mails[0])
+	}
+	if strings.TrimSpace(mails[1].Body) != "body two" {
+		t.Errorf("second mail body = %q, want %q", mails[1].Body, "body two")
+	}
+}
+
+func TestPOP3Service_MarkMailAsRead_persistsLedger(t *testing.T) {
+	cfg, f := startTestPOP3Server(t)
+	svc := NewPOP3Service(cfg)
+
+	if err := svc.MarkMailAsRead(context.Background(), Mail{Id: "uid-1"}); err != nil {
+		t.Fatalf("MarkMailAsRead() error = %v", err)
+	}
+
+	// A fresh service instance must honour the ledger written by the previous one.
+	mails, err := NewPOP3Service(cfg).GetAllUnreadMail(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllUnreadMail() error = %v", err)
+	}
+	if len(mails) != 1 || mails[0].Id != "uid-2" {
+		t.Fatalf("GetAllUnreadMail() = %+v, want only uid-2", mails)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, u := range f.retrieved {
+		if u == "uid-1" {
+			t.Errorf("ledgered message uid-1 was retrieved again")
+		}
+	}
+}
+
+func TestPOP3Service_ledgerPrunesMissingUIDLs(t *testing.T) {
+	cfg, _ := startTestPOP3Server(t)
+	if err := os.WriteFile(cfg.LedgerPath, []byte(`["gone","uid-1"]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	svc := NewPOP3Service(cfg)
+	if _, err := svc.GetAllUnreadMail(context.Background()); err != nil {
+		t.Fatalf("GetAllUnreadMail() error = %v", err)
+	}
+	ledger, err := svc.ledger.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ledger["gone"] || !ledger["uid-1"] {
+		t.Errorf("ledger = %v, want only uid-1", ledger)
+	}
+}
+
+func TestPOP3Service_DeleteMail(t *testing.T) {
+	cfg, f := startTestPOP3Server(t)
+	svc := NewPOP3Service(cfg)
+	ctx := context.Background()
+
+	if err := svc.DeleteMail(ctx, Mail{Id: "uid-1"}); err != nil {
+		t.Fatalf("DeleteMail() error = %v", err)
+	}
+	if err := svc.DeleteMail(ctx, Mail{Id: "gone"}); err != nil {
+		t.Fatalf("DeleteMail() error = %v", err)
+	}
+	f.mu.Lock()
+	if len(f.uidls) != 2 || f.sessions != 0 {
+		t.Errorf("UIDLs = %v after %d sessions, want the deletion deferred to CommitCheckpoint", f.uidls, f.sessions)
+	}
+	f.mu.Unlock()
+	if mails, err := svc.GetAllUnreadMail(ctx); err != nil || len(mails) != 1 || mails[0].Id != "uid-2" {
+		t.Errorf("GetAllUnreadMail() = %+v, %v; want the deleted mail skipped", mails, err)
+	}
+
+	if err := svc.CommitCheckpoint(ctx, nil); err != nil {
+		t.Fatalf("CommitCheckpoint() error = %v", err)
+	}
+	f.mu.Lock()
+	remaining := append([]string(nil), f.uidls...)
+	f.mu.Unlock()
+	if len(remaining) != 1 || remaining[0] != "uid-2" {
+		t.Errorf("remaining UIDLs = %v, want [uid-2]", remaining)
+	}
+}
+
+func TestPOP3Service_DeleteMail_concurrent(t *testing.T) {
+	cfg, f := startTestPOP3Server(t)
+	svc := NewPOP3Service(cfg)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for _, id := range []string{"uid-1", "uid-2"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- svc.DeleteMail(ctx, Mail{Id: id})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("DeleteMail() error = %v", err)
+		}
+	}
+	if err := svc.CommitCheckpoint(ctx, nil); err != nil {
+		t.Fatalf("CommitCheckpoint() error = %v", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.uidls) != 0 || f.sessions != 1 {
+		t.Errorf("remaining UIDLs = %v after %d sessions, want all deleted in one session", f.uidls, f.sessions)
+	}
+}
+
+func TestPOP3Service_wrongPassword(t *testing.T) {
+	cfg, _ := startTestPOP3Server(t)
+	cfg.Password = "wrong"
+	if _, err := NewPOP3Service(cfg).GetAllUnreadMail(context.Background()); err == nil {
+		t.Fatal("GetAllUnreadMail() with wrong password should fail")
+	}
+}
@@ -0,0 +1,46 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// serverIOTimeout bounds the dial and every command exchange with an IMAP or POP3 server, so that
+// an unresponsive server cannot block a run.
+const serverIOTimeout = 5 * time.Minute
+
+// newTLSConfig returns the TLS configuration used for implicit TLS and STARTTLS connections.
+func newTLSConfig(host string, insecureSkipVerify bool) *tls.Config {
+	return &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: insecureSkipVerify, // #nosec G402 -- explicit opt-in for test servers
+		MinVersion:         tls.VersionTLS12,
+	}
+}
+
+// newDialer returns a dialer with serverIOTimeout honouring the deadline of ctx, if any.
+func newDialer(ctx context.Context) *net.Dialer {
+	dialer := &net.Dialer{Timeout: serverIOTimeout}
+	if deadline, ok := ctx.Deadline(); ok {
+		dialer.Deadline = deadline
+	}
+	return dialer
+}
+
+// resolvePassword returns password, or the trimmed content of passwordFile when password is empty.
+func resolvePassword(password, passwordFile, protocol string) (string, error) {
+	if password != "" {
+		return password, nil
+	}
+	b, err := os.ReadFile(filepath.Clean(passwordFile)) // #nosec G304 -- path comes from trusted configuration
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s password file %s: %w", protocol, passwordFile, err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
@@ -0,0 +1,229 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
+)
+
+const (
+	// DefaultTokenEnvVar is the environment variable read by the env token store.
+	DefaultTokenEnvVar = "GMAIL_TOKEN"
+
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+// TokenStore loads and persists the OAuth token of the Gmail user so that refreshed (and rotated)
+// tokens survive restarts.
+type TokenStore interface {
+	Load(ctx context.Context) (*oauth2.Token, error)
+	Save(ctx context.Context, token *oauth2.Token) error
+	// String describes the storage location for log and error messages.
+	String() string
+}
+
+// NewTokenStore returns the TokenStore configured in cfg; tokenPath is the file used by the file store.
+func NewTokenStore(cfg config.GmailTokenStore, tokenPath string) (TokenStore, error) {
+	switch cfg.Type {
+	case "", "file":
+		return &FileTokenStore{Path: tokenPath}, nil
+	case "env":
+		name := cfg.EnvVar
+		if name == "" {
+			name = DefaultTokenEnvVar
+		}
+		return &EnvTokenStore{Variable: name}, nil
+	case "kubernetesSecret":
+		return NewKubernetesSecretTokenStore(cfg.SecretNamespace, cfg.SecretName, cfg.SecretKey)
+	default:
+		return nil, fmt.Errorf("unsupported token store type: %s", cfg.Type)
+	}
+}
+
+// FileTokenStore keeps the token as JSON in a file, e.g. request.token written by cli/gmail.
+type FileTokenStore struct {
+	Path string
+}
+
+func (s *FileTokenStore) Load(_ context.Context) (*oauth2.Token, error) {
+	return tokenFromFile(s.Path)
+}
+
+func (s *FileTokenStore) Save(_ context.Context, token *oauth2.Token) error {
+	b, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.Path, b, 0600)
+}
+
+func (s *FileTokenStore) String() string {
+	return s.Path
+}
+
+// EnvTokenStore reads the token JSON from an environment variable (e.g. populated from a Secret).
+// Refreshed tokens are only kept in the process environment and do not survive a restart.
+type EnvTokenStore struct {
+	Variable string
+}
+
+func (s *EnvTokenStore) Load(_ context.Context) (*oauth2.Token, error) {
+	v, ok := os.LookupEnv(s.Variable)
+	if !ok || strings.TrimSpace(v) == "" {
+		return nil, fmt.Errorf("environment variable %s is not set", s.Variable)
+	}
+	token := &oauth2.Token{}
+	return token, json.Unmarshal([]byte(v), token)
+}
+
+func (s *EnvTokenStore) Save(_ context.Context, token *oauth2.Token) error {
+	b, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	return os.Setenv(s.Variable, string(b))
+}
+
+func (s *EnvTokenStore) String() string {
+	return "$" + s.Variable
+}
+
+// KubernetesSecretTokenStore keeps the token in a key of a Kubernetes Secret, read and patched
+// through the API server with the pod's service account. The service account needs get and
+// patch permissions on the Secret.
+type KubernetesSecretTokenStore struct {
+	Namespace string
+	Name      string
+	Key       string
+
+	apiServer string
+	// bearerTokenFile is re-read for every request since projected service account tokens rotate.
+	bearerTokenFile string
+	httpClient      *http.Client
+}
+
+// NewKubernetesSecretTokenStore creates a store for the Secret using the in-cluster configuration.
+// An empty namespace defaults to the pod's namespace and an empty key to TokenFileName.
+func NewKubernetesSecretTokenStore(namespace, name, key string) (*KubernetesSecretTokenStore, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("kubernetes token store requires running in a cluster (KUBERNETES_SERVICE_HOST/PORT not set)")
+	}
+	if namespace == "" {
+		b, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace")) // #nosec G304 -- fixed in-cluster path
+		if err != nil {
+			return nil, fmt.Errorf("could not determine pod namespace: %w", err)
+		}
+		namespace = strings.TrimSpace(string(b))
+	}
+	ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt")) // #nosec G304 -- fixed in-cluster path
+	if err != nil {
+		return nil, fmt.Errorf("could not read cluster CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("cluster CA contains no certificates")
+	}
+	if key == "" {
+		key = TokenFileName
+	}
+	return &KubernetesSecretTokenStore{
+		Namespace:       namespace,
+		Name:            name,
+		Key:             key,
+		apiServer:       "https://" + net.JoinHostPort(host, port),
+		bearerTokenFile: filepath.Join(serviceAccountDir, "token"),
+		httpClient: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}},
+		},
+	}, nil
+}
+
+func (s *KubernetesSecretTokenStore) Load(ctx context.Context) (*oauth2.Token, error) {
+	var secret struct {
+		Data map[string][]byte `json:"data"`
+	}
+	if err := s.do(ctx, http.MethodGet, "", nil, &secret); err != nil {
+		return nil, err
+	}
+	raw, ok := secret.Data[s.Key]
+	if !ok {
+		return nil, fmt.Errorf("secret %s has no key %q", s, s.Key)
+	}
+	token := &oauth2.Token{}
+	if err := json.Unmarshal(raw, token); err != nil {
+		return nil, fmt.Errorf("invalid token in secret %s: %w", s, err)
+	}
+	return token, nil
+}
+
+// Save replaces the token key with a JSON merge patch, leaving the other keys of the Secret untouched.
+func (s *KubernetesSecretTokenStore) Save(ctx context.Context, token *oauth2.Token) error {
+	b, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]any{
+		"data": map[string]string{s.Key: base64.StdEncoding.EncodeToString(b)},
+	})
+	if err != nil {
+		return err
+	}
+	return s.do(ctx, http.MethodPatch, "application/merge-patch+json", patch, nil)
+}
+
+func (s *KubernetesSecretTokenStore) String() string {
+	return "secret " + s.Namespace + "/" + s.Name
+}
+
+func (s *KubernetesSecretTokenStore) do(ctx context.Context, method, contentType string, body []byte, out any) error {
+	bearer, err := os.ReadFile(s.bearerTokenFile) // #nosec G304 -- fixed in-cluster path
+	if err != nil {
+		return fmt.Errorf("could not read service account token: %w", err)
+	}
+	u := s.apiServer + "/api/v1/namespaces/" + url.PathEscape(s.Namespace) + "/secrets/" + url.PathEscape(s.Name)
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(bearer)))
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, s, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		hint := ""
+		if resp.StatusCode == http.StatusForbidden {
+			hint = "; grant the service account get and patch on the secret"
+		}
+		return fmt.Errorf("%s %s: kubernetes API returned %d%s: %s", method, s, resp.StatusCode, hint, strings.TrimSpace(string(msg)))
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
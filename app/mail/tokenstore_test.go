@@ -0,0 +1,187 @@
+package mail
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestTokenStores_roundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		store TokenStore
+	}{
+		{name: "file", store: &FileTokenStore{Path: filepath.Join(t.TempDir(), TokenFileName)}},
+		{name: "env", store: &EnvTokenStore{Variable: "TEST_GMAIL_TOKEN_ROUND_TRIP"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if env, ok := tt.store.(*EnvTokenStore); ok {
+				t.Setenv(env.Variable, "")
+			}
+			want := &oauth2.Token{AccessToken: "access", RefreshToken: "refresh", Expiry: time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)}
+			if err := tt.store.Save(context.Background(), want); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			got, err := tt.store.Load(context.Background())
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if got.AccessToken != want.AccessToken || got.RefreshToken != want.RefreshToken || !got.Expiry.Equal(want.Expiry) {
+				t.Errorf("Load() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+// fakeSecretAPI serves a single Secret the way the Kubernetes API server does.
+type fakeSecretAPI struct {
+	data        map[string][]byte
+	forbidPatch bool
+	gotAuth     []string
+	gotPatch    map[string]map[string]string
+}
+
+func (f *fakeSecretAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.gotAuth = append(f.gotAuth, r.Header.Get("Authorization"))
+	if r.URL.Path != "/api/v1/namespaces/mail/secrets/gmail-token" {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": f.data})
+	case http.MethodPatch:
+		if f.forbidPatch {
+			http.Error(w, `secrets "gmail-token" is forbidden`, http.StatusForbidden)
+			return
+		}
+		if r.Header.Get("Content-Type") != "application/merge-patch+json" {
+			http.Error(w, "unsupported patch type", http.StatusUnsupportedMediaType)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &f.gotPatch); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for k, v := range f.gotPatch["data"] {
+			f.data[k], _ = base64.StdEncoding.DecodeString(v)
+		}
+		_, _ = io.WriteString(w, `{}`)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func newTestSecretStore(t *testing.T, api *fakeSecretAPI) *KubernetesSecretTokenStore {
+	t.Helper()
+	srv := httptest.NewTLSServer(api)
+	t.Cleanup(srv.Close)
+	bearer := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(bearer, []byte("sa-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return &KubernetesSecretTokenStore{
+		Namespace:       "mail",
+		Name:            "gmail-token",
+		Key:             TokenFileName,
+		apiServer:       srv.URL,
+		bearerTokenFile: bearer,
+		httpClient:      srv.Client(),
+	}
+}
+
+func TestKubernetesSecretTokenStore(t *testing.T) {
+	api := &fakeSecretAPI{data: map[string][]byte{
+		TokenFileName:      []byte(`{"access_token":"old","refresh_token":"refresh"}`),
+		"credentials.json": []byte(`{}`),
+	}}
+	store := newTestSecretStore(t, api)
+
+	got, err := store.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got.AccessToken != "old" || got.RefreshToken != "refresh" {
+		t.Errorf("Load() = %+v, want the token from the secret", got)
+	}
+
+	if err := store.Save(context.Background(), &oauth2.Token{AccessToken: "new", RefreshToken: "rotated"}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if len(api.gotPatch["data"]) != 1 {
+		t.Errorf("patch = %v, want only the token key", api.gotPatch)
+	}
+	if _, ok := api.data["credentials.json"]; !ok {
+		t.Error("patch removed the other keys of the secret")
+	}
+	got, err = store.Load(context.Background())
+	if err != nil || got.AccessToken != "new" || got.RefreshToken != "rotated" {
+		t.Errorf("Load() after Save() = %+v, %v; want the rotated token", got, err)
+	}
+	for _, auth := range api.gotAuth {
+		if auth != "Bearer sa-token" {
+			t.Errorf("Authorization = %q, want the service account token", auth)
+		}
+	}
+}
+
+func TestKubernetesSecretTokenStore_forbidden(t *testing.T) {
+	store := newTestSecretStore(t, &fakeSecretAPI{data: map[string][]byte{}, forbidPatch: true})
+
+	err := store.Save(context.Background(), &oauth2.Token{AccessToken: "new"})
+	if err == nil || !strings.Contains(err.Error(), "grant the service account get and patch") {
+		t.Errorf("Save() error = %v, want an RBAC hint", err)
+	}
+}
+
+// staticTokenSource returns its token, which the test can replace to simulate a refresh.
+type staticTokenSource struct{ token *oauth2.Token }
+
+func (s *staticTokenSource) Token() (*oauth2.Token, error) { return s.token, nil }
+
+// countingTokenStore counts saves.
+type countingTokenStore struct {
+	FileTokenStore
+	saves int
+}
+
+func (s *countingTokenStore) Save(ctx context.Context, token *oauth2.Token) error {
+	s.saves++
+	return s.FileTokenStore.Save(ctx, token)
+}
+
+func TestTokenSavingSource_savesOnlyRefreshedTokens(t *testing.T) {
+	store := &countingTokenStore{FileTokenStore: FileTokenStore{Path: filepath.Join(t.TempDir(), TokenFileName)}}
+	src := &staticTokenSource{token: &oauth2.Token{AccessToken: "loaded"}}
+	ts := &tokenSavingSource{TokenSource: src, ctx: context.Background(), store: store, last: "loaded"}
+
+	for i := 0; i < 3; i++ {
+		if _, err := ts.Token(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if store.saves != 0 {
+		t.Errorf("saves = %d before refresh, want 0", store.saves)
+	}
+	src.token = &oauth2.Token{AccessToken: "refreshed"}
+	for i := 0; i < 3; i++ {
+		if _, err := ts.Token(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if store.saves != 1 {
+		t.Errorf("saves = %d after refresh, want 1", store.saves)
+	}
+}
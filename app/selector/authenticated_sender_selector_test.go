@@ -0,0 +1,55 @@
+package selector
+
+import (
+	"testing"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
+	"github.com/jo-hoe/go-mail-webhook-service/app/mail"
+)
+
+func TestAuthenticatedSenderRegexSelector(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       mail.Mail
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "authenticated sender",
+			m:    mail.Mail{Sender: "orders@ourvendor.com", Authentication: mail.AuthVerdict{Domain: "ourvendor.com", Pass: true}},
+			want: "orders@ourvendor.com",
+		},
+		{
+			name:    "spoofed sender",
+			m:       mail.Mail{Sender: "orders@ourvendor.com", Authentication: mail.AuthVerdict{Domain: "ourvendor.com"}},
+			wantErr: true,
+		},
+		{
+			name:    "sender outside the authenticated domain",
+			m:       mail.Mail{Sender: "orders@ourvendor.com.attacker.example", Authentication: mail.AuthVerdict{Domain: "attacker.example", Pass: true}},
+			wantErr: true,
+		},
+		{
+			name:    "not evaluated",
+			m:       mail.Mail{Sender: "orders@ourvendor.com"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			protos, err := NewSelectorPrototypes([]config.MailSelectorConfig{
+				{Name: "vendor", Type: "authenticatedSenderRegex", Pattern: `^[^@]+@ourvendor\.com$`},
+			})
+			if err != nil {
+				t.Fatalf("failed to build selector prototypes: %v", err)
+			}
+			val, err := protos[0].NewInstance().SelectValue(tt.m)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SelectValue error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if val != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, val)
+			}
+		})
+	}
+}
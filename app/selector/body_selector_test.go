@@ -0,0 +1,42 @@
+package selector
+
+import (
+	"testing"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
+	"github.com/jo-hoe/go-mail-webhook-service/app/mail"
+)
+
+func TestBodyRegexSelector_Target(t *testing.T) {
+	m := mail.Mail{
+		Body:     "Track your order here <https://shop.example.com/track/1234>",
+		HTMLBody: `<a href="https://shop.example.com/track/1234">here</a>`,
+	}
+	tests := []struct {
+		name    string
+		target  string
+		pattern string
+		want    string
+	}{
+		{name: "default targets the text body", pattern: `Track your order (\w+)`, want: "here"},
+		{name: "text", target: "text", pattern: `<(https://[^>]+)>`, want: "https://shop.example.com/track/1234"},
+		{name: "html", target: "html", pattern: `href="([^"]+)"`, want: "https://shop.example.com/track/1234"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			protos, err := NewSelectorPrototypes([]config.MailSelectorConfig{
+				{Name: "link", Type: "bodyRegex", Pattern: tt.pattern, CaptureGroup: 1, Target: tt.target},
+			})
+			if err != nil {
+				t.Fatalf("failed to build selector prototypes: %v", err)
+			}
+			val, err := protos[0].NewInstance().SelectValue(m)
+			if err != nil {
+				t.Fatalf("SelectValue returned error: %v", err)
+			}
+			if val != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, val)
+			}
+		})
+	}
+}
@@ -3,18 +3,20 @@ package selector
 import (
 	"fmt"
 	"regexp"
+	"strings"
 
 	"github.com/jo-hoe/go-mail-webhook-service/app/config"
 	"github.com/jo-hoe/go-mail-webhook-service/app/mail"
 )
 
 // NewSelectorPrototypes constructs immutable selector prototypes from configuration.
-// Supports "subjectRegex", "bodyRegex", "senderRegex", "recipientRegex", and "attachmentNameRegex".
+// Supports "subjectRegex", "bodyRegex", "senderRegex", "authenticatedSenderRegex", "recipientRegex",
+// "headerRegex" and "attachmentNameRegex".
 func NewSelectorPrototypes(cfgs []config.MailSelectorConfig) ([]SelectorPrototype, error) {
 	prototypes := make([]SelectorPrototype, 0, len(cfgs))
 	for _, c := range cfgs {
 		switch c.Type {
-		case "subjectRegex", "bodyRegex", "senderRegex", "recipientRegex":
+		case "subjectRegex", "bodyRegex", "senderRegex", "authenticatedSenderRegex", "recipientRegex", "headerRegex":
 			re, err := regexp.Compile(c.Pattern)
 			if err != nil {
 				return nil, fmt.Errorf("failed to compile regex for selector '%s': %w", c.Name, err)
@@ -24,11 +26,20 @@ func NewSelectorPrototypes(cfgs []config.MailSelectorConfig) ([]SelectorPrototyp
 			case "subjectRegex":
 				getValues = func(m mail.Mail) []string { return []string{m.Subject} }
 			case "bodyRegex":
-				getValues = func(m mail.Mail) []string { return []string{m.Body} }
+				if c.Target == "html" {
+					getValues = func(m mail.Mail) []string { return []string{m.HTMLBody} }
+				} else {
+					getValues = func(m mail.Mail) []string { return []string{m.Body} }
+				}
 			case "senderRegex":
 				getValues = func(m mail.Mail) []string { return []string{m.Sender} }
+			case "authenticatedSenderRegex":
+				getValues = authenticatedSender
 			case "recipientRegex":
 				getValues = func(m mail.Mail) []string { return m.Recipients }
+			case "headerRegex":
+				header := c.Header
+				getValues = func(m mail.Mail) []string { return m.HeaderValues(header) }
 			}
 			prototypes = append(prototypes, &RegexSelectorPrototype{
 				name:         c.Name,
@@ -52,3 +63,23 @@ func NewSelectorPrototypes(cfgs []config.MailSelectorConfig) ([]SelectorPrototyp
 	}
 	return prototypes, nil
 }
+
+// IsHeaderOnly reports whether selectors of type selType only look at mail headers
+// (subject, sender, recipients and header fields) and can therefore run before the content is downloaded.
+func IsHeaderOnly(selType string) bool {
+	switch selType {
+	case "subjectRegex", "senderRegex", "authenticatedSenderRegex", "recipientRegex", "headerRegex":
+		return true
+	default:
+		return false
+	}
+}
+
+// authenticatedSender returns the sender of m when its From domain passed sender authentication.
+func authenticatedSender(m mail.Mail) []string {
+	v := m.Authentication
+	if !v.Pass || !strings.HasSuffix(strings.ToLower(m.Sender), "@"+v.Domain) {
+		return nil
+	}
+	return []string{m.Sender}
+}
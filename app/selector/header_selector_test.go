@@ -0,0 +1,44 @@
+package selector
+
+import (
+	"testing"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
+	"github.com/jo-hoe/go-mail-webhook-service/app/mail"
+)
+
+func TestHeaderRegexSelector(t *testing.T) {
+	m := mail.Mail{Headers: []mail.Header{
+		{Name: "Message-ID", Value: "<reply-2@example.com>"},
+		{Name: "X-Ticket", Value: "none"},
+		{Name: "X-Ticket", Value: "TICKET-42"},
+	}}
+	tests := []struct {
+		name    string
+		header  string
+		pattern string
+		want    string
+		wantErr bool
+	}{
+		{name: "message id", header: "message-id", pattern: `<([^>]+)>`, want: "reply-2@example.com"},
+		{name: "repeated header", header: "X-Ticket", pattern: `TICKET-([0-9]+)`, want: "42"},
+		{name: "missing header", header: "In-Reply-To", pattern: `.+`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			protos, err := NewSelectorPrototypes([]config.MailSelectorConfig{
+				{Name: "value", Type: "headerRegex", Header: tt.header, Pattern: tt.pattern, CaptureGroup: 1},
+			})
+			if err != nil {
+				t.Fatalf("failed to build selector prototypes: %v", err)
+			}
+			val, err := protos[0].NewInstance().SelectValue(m)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SelectValue error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if val != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, val)
+			}
+		})
+	}
+}
@@ -10,7 +10,7 @@ import (
 // It holds compiled regex and static attributes. Safe to share across goroutines.
 type RegexSelectorPrototype struct {
 	name         string
-	selType      string // "subjectRegex" | "bodyRegex" | "senderRegex" | "recipientRegex"
+	selType      string // "subjectRegex" | "bodyRegex" | "senderRegex" | "authenticatedSenderRegex" | "recipientRegex" | "headerRegex"
 	captureGroup int
 	re           *regexp.Regexp
 	getValues    func(mail.Mail) []string
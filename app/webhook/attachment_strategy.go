@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"mime"
 	"path/filepath"
+	"slices"
 	"strings"
 	"text/template"
 
@@ -13,12 +14,21 @@ import (
 
 	"github.com/jo-hoe/go-mail-webhook-service/app/config"
 	"github.com/jo-hoe/go-mail-webhook-service/app/mail"
+	"github.com/jo-hoe/go-mail-webhook-service/app/mail/message"
 )
 
 // AttachmentDeliveryStrategy builds the concrete webhook request(s) for a mail's attachments.
-// Implementations must not send the requests themselves; they only return the configs to be sent.
+// Implementations must not send the requests themselves; they only return the requests to be sent.
 type AttachmentDeliveryStrategy interface {
-	BuildRequests(base goback.Config, cfg *config.Config, m mail.Mail, selected map[string]string) []goback.Config
+	BuildRequests(base goback.Config, cfg *config.Config, m mail.Mail, selected map[string]string) []Request
+}
+
+// Request is one webhook request built by an AttachmentDeliveryStrategy.
+type Request struct {
+	goback.Config
+	// FileTypes holds the content type of each of Multipart.Files in order; an empty entry keeps
+	// the type goback writes. goback.ByteFile cannot carry it, so it is set when the request is sent.
+	FileTypes []string
 }
 
 // NewAttachmentDeliveryStrategy returns the strategy corresponding to s.
@@ -28,6 +38,8 @@ func NewAttachmentDeliveryStrategy(s config.AttachmentStrategy) AttachmentDelive
 		return &multipartPerAttachmentStrategy{}
 	case config.StrategyIgnore:
 		return &ignoreStrategy{}
+	case config.StrategyOriginalMessage:
+		return &originalMessageStrategy{}
 	default:
 		return &multipartBundleStrategy{}
 	}
@@ -36,35 +48,31 @@ func NewAttachmentDeliveryStrategy(s config.AttachmentStrategy) AttachmentDelive
 // ignoreStrategy forwards the base request without any attachments.
 type ignoreStrategy struct{}
 
-func (st *ignoreStrategy) BuildRequests(base goback.Config, _ *config.Config, _ mail.Mail, _ map[string]string) []goback.Config {
-	return []goback.Config{base}
+func (st *ignoreStrategy) BuildRequests(base goback.Config, _ *config.Config, _ mail.Mail, _ map[string]string) []Request {
+	return []Request{{Config: base}}
 }
 
 // multipartBundleStrategy bundles all qualifying attachments into one request.
 type multipartBundleStrategy struct{}
 
-func (st *multipartBundleStrategy) BuildRequests(base goback.Config, cfg *config.Config, m mail.Mail, selected map[string]string) []goback.Config {
-	h := base
-	valid := filterAttachmentsBySize(m.Attachments, cfg.Attachments.MaxSizeBytes)
-	if len(valid) > 0 {
-		if h.Multipart == nil {
-			h.Multipart = &goback.Multipart{}
-		}
-		h.Multipart.Files = append(h.Multipart.Files, buildRequestFiles(cfg.Attachments.FieldName, valid, selected)...)
+func (st *multipartBundleStrategy) BuildRequests(base goback.Config, cfg *config.Config, m mail.Mail, selected map[string]string) []Request {
+	valid := qualifyingAttachments(m.Attachments, cfg.Attachments)
+	if len(valid) == 0 {
+		return []Request{{Config: base}}
 	}
-	return []goback.Config{h}
+	return []Request{withFiles(base, cfg.Attachments.FieldName, valid, selected)}
 }
 
 // multipartPerAttachmentStrategy sends one request per qualifying attachment.
 // When no attachments qualify, the base request is returned unchanged.
 type multipartPerAttachmentStrategy struct{}
 
-func (st *multipartPerAttachmentStrategy) BuildRequests(base goback.Config, cfg *config.Config, m mail.Mail, selected map[string]string) []goback.Config {
-	valid := filterAttachmentsBySize(m.Attachments, cfg.Attachments.MaxSizeBytes)
+func (st *multipartPerAttachmentStrategy) BuildRequests(base goback.Config, cfg *config.Config, m mail.Mail, selected map[string]string) []Request {
+	valid := qualifyingAttachments(m.Attachments, cfg.Attachments)
 	if len(valid) == 0 {
-		return []goback.Config{base}
+		return []Request{{Config: base}}
 	}
-	requests := make([]goback.Config, 0, len(valid))
+	requests := make([]Request, 0, len(valid))
 	for i, a := range valid {
 		h := base
 		var fields map[string]string
@@ -75,11 +83,56 @@ func (st *multipartPerAttachmentStrategy) BuildRequests(base goback.Config, cfg
 			Fields: fields,
 			Files:  []goback.ByteFile{buildSingleRequestFile(cfg.Attachments.FieldName, i, a, selected)},
 		}
-		requests = append(requests, h)
+		requests = append(requests, Request{Config: h, FileTypes: []string{a.ContentType}})
 	}
 	return requests
 }
 
+// originalMessageStrategy sends the unmodified source of the mail as one message/rfc822 file,
+// followed by the qualifying attachments when attachments.withAttachments is set. The size limit
+// only applies to those attachments, never to the original message.
+type originalMessageStrategy struct{}
+
+func (st *originalMessageStrategy) BuildRequests(base goback.Config, cfg *config.Config, m mail.Mail, selected map[string]string) []Request {
+	var files []mail.Attachment
+	if len(m.Raw) > 0 {
+		files = append(files, message.NewAttachment(originalMessageName, m.Raw, "message/rfc822", "", false))
+	} else {
+		slog.Warn("original message is not available; sending the request without it", "mailId", m.Id)
+	}
+	if cfg.Attachments.WithAttachments {
+		files = append(files, qualifyingAttachments(m.Attachments, cfg.Attachments)...)
+	}
+	if len(files) == 0 {
+		return []Request{{Config: base}}
+	}
+	return []Request{withFiles(base, cfg.Attachments.FieldName, files, selected)}
+}
+
+// originalMessageName is the filename of the original message in the multipart request.
+const originalMessageName = "message.eml"
+
+// qualifyingAttachments returns the attachments to forward according to the inline and size settings.
+func qualifyingAttachments(atts []mail.Attachment, cfg config.AttachmentsConfig) []mail.Attachment {
+	if cfg.Inline == config.InlineExclude {
+		atts = filterInlineAttachments(atts)
+	}
+	return filterAttachmentsBySize(atts, cfg.MaxSizeBytes)
+}
+
+// filterInlineAttachments returns the attachments that are not displayed inline in the body.
+func filterInlineAttachments(atts []mail.Attachment) []mail.Attachment {
+	result := make([]mail.Attachment, 0, len(atts))
+	for _, a := range atts {
+		if a.Inline {
+			slog.Debug("skipping inline attachment", "name", a.Name, "content_id", a.ContentID)
+			continue
+		}
+		result = append(result, a)
+	}
+	return result
+}
+
 // filterAttachmentsBySize returns the subset of atts whose content size does not exceed max.
 // When max <= 0, all attachments are returned unchanged.
 func filterAttachmentsBySize(atts []mail.Attachment, max int64) []mail.Attachment {
@@ -97,38 +150,54 @@ func filterAttachmentsBySize(atts []mail.Attachment, max int64) []mail.Attachmen
 	return result
 }
 
-// buildRequestFiles converts a slice of attachments into goback.ByteFile entries.
-func buildRequestFiles(fieldTpl string, attachments []mail.Attachment, selected map[string]string) []goback.ByteFile {
-	files := make([]goback.ByteFile, 0, len(attachments))
+// withFiles returns a request for base whose multipart body additionally carries attachments.
+// The multipart section is copied so that base, usually the configured callback, stays unchanged.
+func withFiles(base goback.Config, fieldTpl string, attachments []mail.Attachment, selected map[string]string) Request {
+	mp := goback.Multipart{}
+	if base.Multipart != nil {
+		mp = *base.Multipart
+	}
+	types := make([]string, len(mp.Files), len(mp.Files)+len(attachments))
+	mp.Files = slices.Clip(mp.Files)
 	for i, a := range attachments {
-		files = append(files, buildSingleRequestFile(fieldTpl, i, a, selected))
+		mp.Files = append(mp.Files, buildSingleRequestFile(fieldTpl, i, a, selected))
+		types = append(types, a.ContentType)
 	}
-	return files
+	base.Multipart = &mp
+	return Request{Config: base, FileTypes: types}
 }
 
-// buildSingleRequestFile creates a goback.ByteFile from one attachment.
+// buildSingleRequestFile creates a goback.ByteFile from one attachment, keeping its filename.
 func buildSingleRequestFile(fieldTpl string, idx int, a mail.Attachment, selected map[string]string) goback.ByteFile {
-	field := renderFieldName(fieldTpl, idx, a.Name, selected)
+	field := renderFieldName(fieldTpl, idx, a, selected)
 	name := filepath.Base(a.Name)
-	if name == "" {
+	if name == "" || name == "." {
 		name = field
 	}
 	return goback.ByteFile{Field: field, FileName: name, Data: a.Content}
 }
 
 // renderFieldName evaluates fieldTpl as a Go text/template or returns a positional default.
-func renderFieldName(fieldTpl string, idx int, filename string, selected map[string]string) string {
+func renderFieldName(fieldTpl string, idx int, a mail.Attachment, selected map[string]string) string {
 	if strings.TrimSpace(fieldTpl) == "" {
 		return fmt.Sprintf("attachment_%d", idx)
 	}
-	base := filepath.Base(filename)
+	base := filepath.Base(a.Name)
 	ext := filepath.Ext(base)
+	contentType := a.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(ext)
+	}
 	data := map[string]any{
 		"index":       idx,
 		"filename":    base,
 		"basename":    strings.TrimSuffix(base, ext),
 		"ext":         ext,
-		"contentType": mime.TypeByExtension(ext),
+		"contentType": contentType,
+		"contentId":   a.ContentID,
+		"inline":      a.Inline,
+		"size":        a.Size,
+		"sha256":      a.SHA256,
 	}
 	for k, v := range selected {
 		data[k] = v
@@ -0,0 +1,123 @@
+package webhook
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jo-hoe/goback"
+
+	"github.com/jo-hoe/go-mail-webhook-service/app/config"
+	"github.com/jo-hoe/go-mail-webhook-service/app/mail"
+	"github.com/jo-hoe/go-mail-webhook-service/app/mail/message"
+)
+
+func TestMultipartBundleStrategy_inline(t *testing.T) {
+	m := mail.Mail{Attachments: []mail.Attachment{
+		message.NewAttachment("invoice.pdf", []byte("%PDF-"), "application/pdf", "", false),
+		message.NewAttachment("logo.png", []byte("png"), "image/png", "<logo@example.com>", true),
+	}}
+	tests := []struct {
+		name      string
+		inline    config.InlineAttachments
+		wantFiles []string
+	}{
+		{name: "include", inline: config.InlineInclude, wantFiles: []string{"invoice.pdf", "logo.png"}},
+		{name: "exclude", inline: config.InlineExclude, wantFiles: []string{"invoice.pdf"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Attachments: config.AttachmentsConfig{FieldName: "file", Inline: tt.inline}}
+			reqs := (&multipartBundleStrategy{}).BuildRequests(goback.Config{URL: "http://example.com"}, cfg, m, nil)
+			if len(reqs) != 1 || reqs[0].Multipart == nil || len(reqs[0].Multipart.Files) != len(tt.wantFiles) {
+				t.Fatalf("BuildRequests() = %+v, want files %v", reqs, tt.wantFiles)
+			}
+			for i, f := range reqs[0].Multipart.Files {
+				if f.FileName != tt.wantFiles[i] {
+					t.Errorf("file %d = %q, want %q", i, f.FileName, tt.wantFiles[i])
+				}
+			}
+		})
+	}
+}
+
+func TestOriginalMessageStrategy(t *testing.T) {
+	m := mail.Mail{
+		Raw: []byte("Subject: Invoice\r\n\r\nbody"),
+		Attachments: []mail.Attachment{
+			message.NewAttachment("invoice.pdf", []byte("%PDF-"), "application/pdf", "", false),
+			message.NewAttachment("logo.png", []byte("png"), "image/png", "<logo@example.com>", true),
+		},
+	}
+	tests := []struct {
+		name            string
+		m               mail.Mail
+		withAttachments bool
+		wantFiles       []string
+	}{
+		{name: "alone", m: m, wantFiles: []string{"message.eml"}},
+		{name: "with attachments", m: m, withAttachments: true, wantFiles: []string{"message.eml", "invoice.pdf"}},
+		{name: "raw not available", m: mail.Mail{Attachments: m.Attachments}, wantFiles: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Attachments: config.AttachmentsConfig{
+				Strategy:        config.StrategyOriginalMessage,
+				FieldName:       "{{.contentType}}",
+				Inline:          config.InlineExclude,
+				WithAttachments: tt.withAttachments,
+			}}
+			reqs := NewAttachmentDeliveryStrategy(cfg.Attachments.Strategy).BuildRequests(goback.Config{URL: "http://example.com"}, cfg, tt.m, nil)
+			if len(reqs) != 1 {
+				t.Fatalf("BuildRequests() = %d requests, want 1", len(reqs))
+			}
+			var got []string
+			if reqs[0].Multipart != nil {
+				for _, f := range reqs[0].Multipart.Files {
+					got = append(got, f.FileName)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantFiles, ",") {
+				t.Fatalf("files = %v, want %v", got, tt.wantFiles)
+			}
+			if len(got) > 0 {
+				f := reqs[0].Multipart.Files[0]
+				if f.Field != "message/rfc822" || string(f.Data) != string(m.Raw) {
+					t.Errorf("original message file = %q, %q", f.Field, f.Data)
+				}
+			}
+		})
+	}
+}
+
+func Test_buildSingleRequestFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		att       mail.Attachment
+		fieldTpl  string
+		wantField string
+		wantName  string
+	}{
+		{
+			name:      "declared content type in field template",
+			att:       message.NewAttachment("scan", []byte("%PDF-"), "application/pdf; name=scan", "", false),
+			fieldTpl:  "{{.contentType}}",
+			wantField: "application/pdf",
+			wantName:  "scan",
+		},
+		{
+			name:      "content id, inline and sha256",
+			att:       message.NewAttachment("logo.png", []byte("png"), "image/png", "<logo@example.com>", true),
+			fieldTpl:  "{{.contentId}}-{{.inline}}-{{.size}}-{{printf \"%.8s\" .sha256}}",
+			wantField: "logo@example.com-true-3-8f8cbb7d",
+			wantName:  "logo.png",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := buildSingleRequestFile(tt.fieldTpl, 0, tt.att, nil)
+			if f.Field != tt.wantField || f.FileName != tt.wantName {
+				t.Errorf("buildSingleRequestFile() = %q, %q; want %q, %q", f.Field, f.FileName, tt.wantField, tt.wantName)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package webhook
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+)
+
+// partTypeTransport sets the Content-Type header of the file parts of multipart/form-data
+// requests. goback.ByteFile has no content type, so the parts goback writes would otherwise not
+// carry the type declared by the mail.
+type partTypeTransport struct {
+	base http.RoundTripper
+	// types holds the content type per file part in order; empty entries keep the written type.
+	types []string
+}
+
+// withPartTypes returns a copy of client whose multipart requests get the given file part types.
+func withPartTypes(client *http.Client, types []string) *http.Client {
+	c := http.Client{}
+	if client != nil {
+		c = *client
+	}
+	base := c.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	c.Transport = &partTypeTransport{base: base, types: types}
+	return &c
+}
+
+func (t *partTypeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	mediaType, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" || req.Body == nil {
+		return t.base.RoundTrip(req)
+	}
+	body, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read multipart request body: %w", err)
+	}
+	body, err = setPartTypes(body, params["boundary"], t.types)
+	if err != nil {
+		return nil, err
+	}
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	out.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	out.ContentLength = int64(len(body))
+	return t.base.RoundTrip(out)
+}
+
+// setPartTypes re-encodes the multipart body with the same boundary, setting the Content-Type of
+// the n-th file part to types[n]. Part contents are copied without decoding.
+func setPartTypes(body []byte, boundary string, types []string) ([]byte, error) {
+	r := multipart.NewReader(bytes.NewReader(body), boundary)
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	if err := w.SetBoundary(boundary); err != nil {
+		return nil, fmt.Errorf("invalid multipart boundary: %w", err)
+	}
+	file := 0
+	for {
+		p, err := r.NextRawPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse multipart request body: %w", err)
+		}
+		if p.FileName() != "" {
+			if file < len(types) && types[file] != "" {
+				p.Header.Set("Content-Type", types[file])
+			}
+			file++
+		}
+		pw, err := w.CreatePart(p.Header)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(pw, p); err != nil {
+			return nil, fmt.Errorf("failed to copy multipart part: %w", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
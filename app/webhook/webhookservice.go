@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
 	"sync"
 	"sync/atomic"
 
@@ -34,6 +35,8 @@ type selectedMail struct {
 // WebhookService orchestrates mail fetching, selector evaluation, and webhook delivery.
 type WebhookService struct {
 	config *config.Config
+	// client is used for webhook requests; nil lets goback use its default client.
+	client *http.Client
 }
 
 // NewWebhookService creates a WebhookService for the given configuration.
@@ -41,48 +44,211 @@ func NewWebhookService(cfg *config.Config) *WebhookService {
 	return &WebhookService{config: cfg}
 }
 
-// Run fetches unread mails, evaluates selectors, dispatches webhooks, and returns the failure count.
+// Run processes every configured mail account in turn and returns the total failure count.
+// Each account gets its own failure count and logs carry its name.
 func (s *WebhookService) Run() int {
-	mailService, err := mail.NewMailClientService(mail.GmailClientType)
+	total := 0
+	for _, account := range s.config.MailClient.AllAccounts() {
+		total += s.runAccount(account)
+	}
+	return total
+}
+
+// runAccount fetches unread mails of one account, evaluates selectors, dispatches webhooks, and returns the failure count.
+// An account whose mail service cannot be created or whose mails cannot be fetched counts as one failure.
+func (s *WebhookService) runAccount(account config.MailAccount) int {
+	logger := slog.With("account", account.Name)
+	ctx := withLogger(context.Background(), logger)
+	mailService, err := mail.NewMailClientService(mail.ClientTypeFromConfig(account.MailClient), account.MailClient)
 	if err != nil {
-		slog.Error("could not create mail service", "error", err)
-		return 0
+		logger.Error("could not create mail service", "error", err)
+		return 1
 	}
 	var failureCount atomic.Int64
-	processMails(context.Background(), nil, s.config, mailService, &failureCount)
+	processMails(ctx, s.client, s.config, mailService, &failureCount)
+	failures := int(failureCount.Load())
+	if failures > 0 {
+		logger.Error("account finished with failures", "errors", failures)
+	}
+	return failures
+}
+
+// ProcessMails runs mails fetched outside of Run (e.g. after a Gmail push notification) through
+// the selectors, webhook delivery and processed action of mailService, and returns the failure count.
+func (s *WebhookService) ProcessMails(ctx context.Context, account string, mailService mail.MailClientService, mails []mail.Mail) int {
+	ctx = withLogger(ctx, slog.With("account", account))
+	var failureCount atomic.Int64
+	processFetchedMails(ctx, s.client, s.config, mailService, mails, &failureCount)
 	return int(failureCount.Load())
 }
 
+// HandleMail runs a single pushed mail (e.g. received via SMTP) through the selectors and
+// webhook delivery. It reports whether all selectors matched and returns the delivery error, if any.
+// No processed action is applied since pushed mails do not live in a mailbox.
+func (s *WebhookService) HandleMail(ctx context.Context, m mail.Mail) (bool, error) {
+	prototypes, err := selector.NewSelectorPrototypes(s.config.MailSelectors)
+	if err != nil {
+		return false, fmt.Errorf("could not build selector prototypes: %w", err)
+	}
+	if len(prototypes) == 0 {
+		loggerFrom(ctx).Warn("no selectors configured; mail is not processed", "mailId", m.Id)
+		return false, nil
+	}
+	authenticated := authenticateSenders(ctx, []mail.Mail{m}, s.config.SenderAuthentication)
+	if len(authenticated) == 0 {
+		return false, nil
+	}
+	m = expandArchives(authenticated, s.config.Attachments.Archives)[0]
+	view := messageView(m, s.config.MessageScope)
+	selected, err := selectMailValues(ctx, view, prototypes)
+	if err != nil {
+		return false, nil
+	}
+	if err := deliverMail(ctx, s.client, view, s.config, selected); err != nil {
+		return true, err
+	}
+	loggerFrom(ctx).Info("successfully processed mail", "mailId", m.Id)
+	return true, nil
+}
+
 func processMails(ctx context.Context, client *http.Client, cfg *config.Config, mailService mail.MailClientService, failureCounter *atomic.Int64) {
-	slog.Info("start reading mails")
-	allMails, err := mailService.GetAllUnreadMail(ctx)
+	loggerFrom(ctx).Info("start reading mails")
+	var (
+		allMails []mail.Mail
+		failed   []mail.Mail
+		err      error
+	)
+	if fetcher, ok := mailService.(mail.MetadataFetcher); ok {
+		allMails, failed, err = fetchCandidateMails(ctx, fetcher, cfg, failureCounter)
+	} else {
+		allMails, err = mailService.GetAllUnreadMail(ctx)
+	}
 	if err != nil {
-		slog.Error("error reading mails", "error", err)
+		loggerFrom(ctx).Error("error reading mails", "error", err)
+		failureCounter.Add(1)
 		return
 	}
-	slog.Info("unread mails fetched", "count", len(allMails))
+	loggerFrom(ctx).Info("unread mails fetched", "count", len(allMails))
+	failed = append(failed, processFetchedMails(ctx, client, cfg, mailService, allMails, failureCounter)...)
+	if cp, ok := mailService.(mail.Checkpointer); ok {
+		if err := cp.CommitCheckpoint(ctx, failed); err != nil {
+			loggerFrom(ctx).Error("could not commit sync checkpoint; mails may be processed again", "error", err)
+			failureCounter.Add(1)
+		}
+	}
+}
+
+// fetchCandidateMails lists mails with headers only, drops those failing a header-only selector
+// and downloads the content of the remaining ones when a selector or the attachment strategy
+// needs it. Mails whose content could not be downloaded are returned as failed.
+func fetchCandidateMails(ctx context.Context, fetcher mail.MetadataFetcher, cfg *config.Config, failureCounter *atomic.Int64) ([]mail.Mail, []mail.Mail, error) {
+	mails, err := fetcher.GetAllUnreadMailMetadata(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The verdict only depends on headers, so unauthenticated senders are dropped before downloading.
+	mails = authenticateSenders(ctx, mails, cfg.SenderAuthentication)
+
+	var headerCfgs []config.MailSelectorConfig
+	// With messageScope innermost the headers of the listed mail are those of the forward wrapper.
+	innermost := cfg.MessageScope == config.MessageScopeInnermost
+	needBody := innermost
+	for _, c := range cfg.MailSelectors {
+		if selector.IsHeaderOnly(c.Type) && !innermost {
+			headerCfgs = append(headerCfgs, c)
+		} else {
+			needBody = true
+		}
+	}
+	needAttachments := cfg.Attachments.ForwardsAttachments() || innermost
+	for _, c := range cfg.MailSelectors {
+		if c.Type == "attachmentNameRegex" {
+			needAttachments = true
+		}
+	}
+	headerPrototypes, err := selector.NewSelectorPrototypes(headerCfgs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not build selector prototypes: %w", err)
+	}
+
+	var headerMatches []mail.Mail
+	for _, m := range mails {
+		if _, err := selectMailValues(ctx, m, headerPrototypes); err == nil {
+			headerMatches = append(headerMatches, m)
+		}
+	}
+	loggerFrom(ctx).Info("mails passing header selectors", "count", len(headerMatches), "listed", len(mails))
+	if !needBody && !needAttachments {
+		return headerMatches, nil, nil
+	}
 
+	// The backend bounds the parallel requests; contents are loaded concurrently like deliveries.
+	loaded := make([]*mail.Mail, len(headerMatches))
+	var wg sync.WaitGroup
+	for i, m := range headerMatches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			full, err := fetcher.LoadMailContent(ctx, m, needAttachments)
+			if err != nil {
+				loggerFrom(ctx).Error("could not load mail content", "mailId", m.Id, "error", err)
+				return
+			}
+			loaded[i] = &full
+		}()
+	}
+	wg.Wait()
+
+	candidates := make([]mail.Mail, 0, len(headerMatches))
+	var failed []mail.Mail
+	for i, m := range loaded {
+		if m == nil {
+			failureCounter.Add(1)
+			failed = append(failed, headerMatches[i])
+			continue
+		}
+		candidates = append(candidates, *m)
+	}
+	return candidates, failed, nil
+}
+
+// processFetchedMails evaluates selectors on already fetched mails, dispatches webhooks concurrently
+// and applies the processed action to every successfully delivered mail. It returns the mails
+// whose delivery failed.
+func processFetchedMails(ctx context.Context, client *http.Client, cfg *config.Config, mailService mail.MailClientService, allMails []mail.Mail, failureCounter *atomic.Int64) []mail.Mail {
 	prototypes, err := selector.NewSelectorPrototypes(cfg.MailSelectors)
 	if err != nil {
-		slog.Error("could not build selector prototypes", "error", err)
-		return
+		loggerFrom(ctx).Error("could not build selector prototypes", "error", err)
+		failureCounter.Add(1)
+		return allMails
 	}
 	if len(prototypes) == 0 {
-		slog.Warn("no selectors configured; no mails will be processed")
+		loggerFrom(ctx).Warn("no selectors configured; no mails will be processed")
 	}
 
-	matched := filterMailsBySelectors(allMails, prototypes)
-	slog.Info("mails matching all selectors", "count", len(matched))
+	allMails = authenticateSenders(ctx, allMails, cfg.SenderAuthentication)
+	allMails = expandArchives(allMails, cfg.Attachments.Archives)
+	matched := filterMailsBySelectors(ctx, allMails, prototypes, cfg.MessageScope)
+	loggerFrom(ctx).Info("mails matching all selectors", "count", len(matched))
 
-	var wg sync.WaitGroup
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed []mail.Mail
+	)
 	for _, sm := range matched {
 		wg.Add(1)
 		go func(m mail.Mail, sel map[string]string) {
 			defer wg.Done()
-			processOneMail(ctx, client, mailService, m, cfg, sel, failureCounter)
+			if !processOneMail(ctx, client, mailService, m, cfg, sel, failureCounter) {
+				mu.Lock()
+				failed = append(failed, m)
+				mu.Unlock()
+			}
 		}(sm.Mail, sm.Selected)
 	}
 	wg.Wait()
+	return failed
 }
 
 func processOneMail(
@@ -93,84 +259,164 @@ func processOneMail(
 	cfg *config.Config,
 	selected map[string]string,
 	failureCounter *atomic.Int64,
-) {
+) bool {
+	view := messageView(m, cfg.MessageScope)
+	if cfg.Attachments.Strategy == config.StrategyOriginalMessage && len(view.Raw) == 0 {
+		if loader, ok := mailService.(mail.RawMailLoader); ok {
+			raw, err := loader.GetRawMail(ctx, m)
+			if err != nil {
+				loggerFrom(ctx).Error("could not load original message", "mailId", m.Id, "error", err)
+				failureCounter.Add(1)
+				return false
+			}
+			view.Raw = raw
+		}
+	}
+	if err := deliverMail(ctx, client, view, cfg, selected); err != nil {
+		failureCounter.Add(1)
+		return false
+	}
+	applyProcessedAction(ctx, mailService, m, cfg.Processing.ProcessedAction)
+	loggerFrom(ctx).Info("successfully processed mail", "mailId", m.Id)
+	return true
+}
+
+// deliverMail sends all webhook requests built by the attachment strategy, stopping at the first failure.
+func deliverMail(ctx context.Context, client *http.Client, m mail.Mail, cfg *config.Config, selected map[string]string) error {
 	strategy := NewAttachmentDeliveryStrategy(cfg.Attachments.Strategy)
-	slog.Info("start processing mail", "mailId", m.Id, "subject", m.Subject, "body_prefix", truncate(m.Body, 100), "received_at", m.ReceivedAt)
+	loggerFrom(ctx).Info("start processing mail", "mailId", m.Id, "subject", m.Subject, "body_prefix", truncate(m.Body, 100), "received_at", m.ReceivedAt)
 	for _, req := range strategy.BuildRequests(cfg.Callback, cfg, m, selected) {
 		if len(req.ExpectedStatus) == 0 {
 			req.ExpectedStatus = defaultSuccessStatusCodes
 		}
 		if err := sendRequest(ctx, client, req, selected, m); err != nil {
-			failureCounter.Add(1)
-			return
+			return err
 		}
 	}
-	applyProcessedAction(ctx, mailService, m, cfg.Processing.ProcessedAction)
-	slog.Info("successfully processed mail", "mailId", m.Id)
+	return nil
 }
 
 func applyProcessedAction(ctx context.Context, mailService mail.MailClientService, m mail.Mail, actionName string) {
 	action, err := mail.NewProcessedAction(actionName)
 	if err != nil {
-		slog.Error("invalid processed action; falling back to markRead", "configured", actionName, "error", err)
+		loggerFrom(ctx).Error("invalid processed action; falling back to markRead", "configured", actionName, "error", err)
 		action, _ = mail.NewProcessedAction("markRead")
 	}
 	if err := action.Apply(ctx, mailService, m); err != nil {
-		slog.Error("could not apply processed action", "action", action.Name(), "mailId", m.Id, "error", err)
+		loggerFrom(ctx).Error("could not apply processed action", "action", action.Name(), "mailId", m.Id, "error", err)
 	}
 }
 
-func sendRequest(ctx context.Context, client *http.Client, h goback.Config, selected map[string]string, m mail.Mail) error {
-	exec, err := goback.NewCallbackExecutor(h, client)
+func sendRequest(ctx context.Context, client *http.Client, req Request, selected map[string]string, m mail.Mail) error {
+	if slices.ContainsFunc(req.FileTypes, func(t string) bool { return t != "" }) {
+		client = withPartTypes(client, req.FileTypes)
+	}
+	exec, err := goback.NewCallbackExecutor(req.Config, client)
 	if err != nil {
-		slog.Error("could not create webhook executor", "mailId", m.Id, "error", err)
+		loggerFrom(ctx).Error("could not create webhook executor", "mailId", m.Id, "error", err)
 		return err
 	}
 	resp, _, err := exec.Execute(ctx, goback.TemplateData{Values: selected})
 	if err != nil {
-		slog.Error("webhook execution failed", "mailId", m.Id, "error", err)
+		loggerFrom(ctx).Error("webhook execution failed", "mailId", m.Id, "error", err)
 		return err
 	}
 	if resp != nil {
-		slog.Info("webhook request sent", "mailId", m.Id, "status_code", resp.StatusCode, "method", h.Method, "url", h.URL)
+		loggerFrom(ctx).Info("webhook request sent", "mailId", m.Id, "status_code", resp.StatusCode, "method", req.Method, "url", req.URL)
 	}
 	return nil
 }
 
 // selectMailValues evaluates every prototype against m and returns the collected values.
 // Returns an error as soon as any selector does not match or fails.
-func selectMailValues(m mail.Mail, prototypes []selector.SelectorPrototype) (map[string]string, error) {
+func selectMailValues(ctx context.Context, m mail.Mail, prototypes []selector.SelectorPrototype) (map[string]string, error) {
 	result := make(map[string]string, len(prototypes))
 	for _, proto := range prototypes {
 		sel := proto.NewInstance()
 		v, err := sel.SelectValue(m)
 		if err != nil {
 			if errors.Is(err, selector.ErrNotMatched) {
-				slog.Info("selector not matched", "name", sel.Name(), "type", sel.Type(), "mailId", m.Id)
+				loggerFrom(ctx).Info("selector not matched", "name", sel.Name(), "type", sel.Type(), "mailId", m.Id)
 			} else {
-				slog.Error("selector evaluation failed", "name", sel.Name(), "type", sel.Type(), "mailId", m.Id, "error", err)
+				loggerFrom(ctx).Error("selector evaluation failed", "name", sel.Name(), "type", sel.Type(), "mailId", m.Id, "error", err)
 			}
 			return nil, fmt.Errorf("selector %q did not apply: %w", sel.Name(), err)
 		}
-		slog.Info("selector matched", "name", sel.Name(), "type", sel.Type(), "mailId", m.Id)
+		loggerFrom(ctx).Info("selector matched", "name", sel.Name(), "type", sel.Type(), "mailId", m.Id)
 		result[sel.Name()] = v
 	}
 	return result, nil
 }
 
-func filterMailsBySelectors(mails []mail.Mail, prototypes []selector.SelectorPrototype) []selectedMail {
+// authenticateSenders sets the sender authentication verdict of mails. When authentication is
+// required, mails whose sender is not authenticated are logged with their verdict and dropped.
+func authenticateSenders(ctx context.Context, mails []mail.Mail, cfg config.SenderAuthentication) []mail.Mail {
+	authenticated := make([]mail.Mail, 0, len(mails))
+	for _, m := range mails {
+		mail.AuthenticateSender(&m, cfg)
+		if v := m.Authentication; cfg.Required && !v.Pass {
+			loggerFrom(ctx).Warn("sender not authenticated; mail is not processed",
+				"mailId", m.Id, "sender", m.Sender, "domain", v.Domain, "reason", v.Reason,
+				"authServId", v.AuthServID, "spf", v.SPF, "dkim", v.DKIM, "dmarc", v.DMARC, "arc", v.ARC)
+			continue
+		}
+		authenticated = append(authenticated, m)
+	}
+	return authenticated
+}
+
+// expandArchives expands the archive attachments of mails when configured, so that selectors and
+// attachment strategies see the archive members.
+func expandArchives(mails []mail.Mail, cfg config.ArchiveExpansion) []mail.Mail {
+	if !cfg.Enabled {
+		return mails
+	}
+	expanded := make([]mail.Mail, len(mails))
+	for i, m := range mails {
+		mail.ExpandArchiveAttachments(&m, cfg)
+		expanded[i] = m
+	}
+	return expanded
+}
+
+// messageView returns the message that selectors and attachment strategies operate on: m itself,
+// or the original message of a mail forwarded as attachment when messageScope is innermost.
+func messageView(m mail.Mail, scope config.MessageScope) mail.Mail {
+	if scope == config.MessageScopeInnermost {
+		return m.Innermost()
+	}
+	return m
+}
+
+// filterMailsBySelectors returns the mails whose message view matches all prototypes.
+func filterMailsBySelectors(ctx context.Context, mails []mail.Mail, prototypes []selector.SelectorPrototype, scope config.MessageScope) []selectedMail {
 	if len(prototypes) == 0 {
 		return nil
 	}
 	result := make([]selectedMail, 0, len(mails))
 	for _, m := range mails {
-		if selected, err := selectMailValues(m, prototypes); err == nil {
+		if selected, err := selectMailValues(ctx, messageView(m, scope), prototypes); err == nil {
 			result = append(result, selectedMail{Mail: m, Selected: selected})
 		}
 	}
 	return result
 }
 
+type loggerKey struct{}
+
+// withLogger returns a context whose processing logs go to l (e.g. tagged with the account name).
+func withLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// loggerFrom returns the logger carried by ctx, or the default logger.
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
 // truncate returns input truncated to maxLen characters with a "..." suffix when truncated.
 func truncate(input string, maxLen int) string {
 	if len(input) <= maxLen {
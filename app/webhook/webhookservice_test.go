@@ -7,6 +7,8 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"sync/atomic"
@@ -26,6 +28,7 @@ func Test_filterMailsBySelectors(t *testing.T) {
 	type args struct {
 		mails  []mail.Mail
 		protos []selector.SelectorPrototype
+		scope  config.MessageScope
 	}
 	tests := []struct {
 		name string
@@ -55,10 +58,27 @@ func Test_filterMailsBySelectors(t *testing.T) {
 			},
 			want: []mail.Mail{},
 		},
+		{
+			name: "innermost scope matches the forwarded message but returns the mailbox mail",
+			args: args{
+				mails: []mail.Mail{
+					{Id: "1", Subject: "Fwd: Invoice 1234", Embedded: []mail.Mail{{Subject: "Invoice 1234"}}},
+					{Id: "2", Subject: "Invoice 5678"},
+				},
+				protos: mustPrototypes(t, []config.MailSelectorConfig{
+					{Name: "subjectScope", Type: "subjectRegex", Pattern: "^Invoice"},
+				}),
+				scope: config.MessageScopeInnermost,
+			},
+			want: []mail.Mail{
+				{Id: "1", Subject: "Fwd: Invoice 1234", Embedded: []mail.Mail{{Subject: "Invoice 1234"}}},
+				{Id: "2", Subject: "Invoice 5678"},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotSelected := filterMailsBySelectors(tt.args.mails, tt.args.protos)
+			gotSelected := filterMailsBySelectors(context.Background(), tt.args.mails, tt.args.protos, tt.args.scope)
 			got := make([]mail.Mail, len(gotSelected))
 			for i, sm := range gotSelected {
 				got[i] = sm.Mail
@@ -176,7 +196,7 @@ func Test_processOneMail(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			selected, err := selectMailValues(tt.m, allProtos)
+			selected, err := selectMailValues(context.Background(), tt.m, allProtos)
 			if err != nil {
 				if tt.wantSuccessLog {
 					t.Errorf("selectMailValues() unexpected error: %v", err)
@@ -235,6 +255,261 @@ func Test_processMails(t *testing.T) {
 	}
 }
 
+func Test_processFetchedMails_invalidSelectorCountsAsFailure(t *testing.T) {
+	cfg := &config.Config{
+		MailSelectors: []config.MailSelectorConfig{{Name: "subjectScope", Type: "subjectRegex", Pattern: "("}},
+		Callback:      goback.Config{URL: "http://example.com", Method: "POST"},
+	}
+	mails := []mail.Mail{{Id: "1", Subject: "testSubject"}}
+	var fc atomic.Int64
+	failed := processFetchedMails(context.Background(), successHTTPClient(), cfg, &mail.MailClientServiceMock{Mails: mails}, mails, &fc)
+	if len(failed) != 1 || fc.Load() != 1 {
+		t.Errorf("failed = %d mails, failures = %d; want the mail returned for retry and one failure", len(failed), fc.Load())
+	}
+}
+
+// metadataServiceStub lists header-only mails and records which mails had their content loaded.
+type metadataServiceStub struct {
+	mail.MailClientServiceMock
+	loaded          []string
+	withAttachments bool
+}
+
+func (s *metadataServiceStub) GetAllUnreadMailMetadata(context.Context) ([]mail.Mail, error) {
+	return s.Mails, nil
+}
+
+func (s *metadataServiceStub) LoadMailContent(_ context.Context, m mail.Mail, withAttachments bool) (mail.Mail, error) {
+	s.loaded = append(s.loaded, m.Id)
+	s.withAttachments = withAttachments
+	m.Body = "Amount: 10 EUR"
+	return m, nil
+}
+
+func Test_processMails_twoPhaseFetch(t *testing.T) {
+	tests := []struct {
+		name                string
+		selectors           []config.MailSelectorConfig
+		strategy            config.AttachmentStrategy
+		wantLoaded          []string
+		wantWithAttachments bool
+		wantRequests        int64
+	}{
+		{
+			name: "content loaded only for header matches",
+			selectors: []config.MailSelectorConfig{
+				{Name: "subjectScope", Type: "subjectRegex", Pattern: "Invoice"},
+				{Name: "amount", Type: "bodyRegex", Pattern: "Amount: (\\d+)", CaptureGroup: 1},
+			},
+			strategy:     config.StrategyIgnore,
+			wantLoaded:   []string{"m1"},
+			wantRequests: 1,
+		},
+		{
+			name: "attachment strategy requires attachments",
+			selectors: []config.MailSelectorConfig{
+				{Name: "subjectScope", Type: "subjectRegex", Pattern: "Invoice"},
+			},
+			strategy:            config.StrategyMultipartBundle,
+			wantLoaded:          []string{"m1"},
+			wantWithAttachments: true,
+			wantRequests:        1,
+		},
+		{
+			name: "header selectors only need no content",
+			selectors: []config.MailSelectorConfig{
+				{Name: "subjectScope", Type: "subjectRegex", Pattern: "Invoice"},
+			},
+			strategy:     config.StrategyIgnore,
+			wantRequests: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int64
+			client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+				requests.Add(1)
+				return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("")), Header: make(http.Header)}, nil
+			})}
+			svc := &metadataServiceStub{MailClientServiceMock: mail.MailClientServiceMock{Mails: []mail.Mail{
+				{Id: "m1", Subject: "Invoice 42"},
+				{Id: "m2", Subject: "Newsletter"},
+			}}}
+			cfg := &config.Config{
+				MailSelectors: tt.selectors,
+				Callback:      goback.Config{URL: "http://example.com", Method: "POST"},
+				Attachments:   config.AttachmentsConfig{Strategy: tt.strategy, FieldName: "attachment"},
+			}
+
+			var fc atomic.Int64
+			processMails(context.Background(), client, cfg, svc, &fc)
+			if !reflect.DeepEqual(svc.loaded, tt.wantLoaded) || svc.withAttachments != tt.wantWithAttachments {
+				t.Errorf("loaded = %v (attachments %v), want %v (attachments %v)", svc.loaded, svc.withAttachments, tt.wantLoaded, tt.wantWithAttachments)
+			}
+			if requests.Load() != tt.wantRequests || fc.Load() != 0 {
+				t.Errorf("requests = %d, failures = %d; want %d requests without failures", requests.Load(), fc.Load(), tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestWebhookService_Run_multipleAccounts(t *testing.T) {
+	var logBuffer bytes.Buffer
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logBuffer, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	newMaildir := func(subject string) string {
+		root := t.TempDir()
+		for _, sub := range []string{"new", "cur", "tmp"} {
+			if err := os.MkdirAll(filepath.Join(root, sub), 0700); err != nil {
+				t.Fatal(err)
+			}
+		}
+		msg := "From: vendor@example.com\r\nSubject: " + subject + "\r\n\r\nbody\r\n"
+		if err := os.WriteFile(filepath.Join(root, "new", "1.M1.host"), []byte(msg), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return root
+	}
+	account := func(name, path string) config.MailAccount {
+		return config.MailAccount{Name: name, MailClient: config.MailClient{
+			Filesystem: config.FilesystemClient{Enabled: true, Format: "maildir", Path: path},
+		}}
+	}
+
+	cfg := &config.Config{
+		MailClient: config.MailClient{Accounts: []config.MailAccount{
+			account("orders", newMaildir("testSubject ok")),
+			account("billing", newMaildir("testSubject fail")),
+			account("support", filepath.Join(t.TempDir(), "missing")),
+		}},
+		MailSelectors: []config.MailSelectorConfig{
+			{Name: "subject", Type: "subjectRegex", Pattern: "testSubject (.*)", CaptureGroup: 1},
+		},
+		Callback:   goback.Config{URL: "http://example.com", Method: "POST"},
+		Processing: config.Processing{ProcessedAction: "markRead"},
+	}
+	// Accounts run in order: the first (orders) call succeeds, the second (billing) fails.
+	calls := 0
+	s := NewWebhookService(cfg)
+	s.client = &http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			calls++
+			status := 200
+			if calls > 1 {
+				status = 500
+			}
+			return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader("")), Header: make(http.Header), Request: req}, nil
+		}),
+	}
+
+	if got := s.Run(); got != 2 {
+		t.Errorf("Run() = %d, want 1 failure each from the billing and support accounts", got)
+	}
+	logs := logBuffer.String()
+	for _, want := range []string{
+		"account=orders",
+		`msg="account finished with failures" account=billing errors=1`,
+		`msg="error reading mails" account=support`,
+		`msg="account finished with failures" account=support errors=1`,
+	} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("logs missing %q; got: %s", want, logs)
+		}
+	}
+	if strings.Contains(logs, `account finished with failures" account=orders`) {
+		t.Errorf("orders account must not report failures; got: %s", logs)
+	}
+}
+
+func TestWebhookService_HandleMail(t *testing.T) {
+	cfg := &config.Config{
+		MailSelectors: []config.MailSelectorConfig{
+			{Name: "subjectScope", Type: "subjectRegex", Pattern: "testSubject"},
+		},
+		Callback: goback.Config{URL: "http://example.com", Method: "POST"},
+	}
+	tests := []struct {
+		name        string
+		m           mail.Mail
+		statusCode  int
+		wantMatched bool
+		wantErr     bool
+	}{
+		{name: "matching mail is delivered", m: mail.Mail{Subject: "testSubject"}, statusCode: 200, wantMatched: true},
+		{name: "non-matching mail is not delivered", m: mail.Mail{Subject: "other"}, statusCode: 200, wantMatched: false},
+		{name: "delivery failure is reported", m: mail.Mail{Subject: "testSubject"}, statusCode: 500, wantMatched: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			s := NewWebhookService(cfg)
+			s.client = &http.Client{
+				Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+					calls++
+					return &http.Response{
+						StatusCode: tt.statusCode,
+						Body:       io.NopCloser(strings.NewReader("")),
+						Header:     make(http.Header),
+						Request:    req,
+					}, nil
+				}),
+			}
+
+			matched, err := s.HandleMail(context.Background(), tt.m)
+			if matched != tt.wantMatched || (err != nil) != tt.wantErr {
+				t.Errorf("HandleMail() = %v, %v; want matched %v, error %v", matched, err, tt.wantMatched, tt.wantErr)
+			}
+			if !tt.wantMatched && calls != 0 {
+				t.Errorf("webhook called %d times for non-matching mail", calls)
+			}
+		})
+	}
+}
+
+func Test_authenticateSenders(t *testing.T) {
+	var logBuffer bytes.Buffer
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logBuffer, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	mails := []mail.Mail{
+		{Id: "signed", Sender: "orders@ourvendor.com", Headers: []mail.Header{
+			{Name: "Authentication-Results", Value: "mx.example.net; dkim=pass header.d=ourvendor.com"},
+			{Name: "From", Value: "orders@ourvendor.com"},
+		}},
+		{Id: "spoofed", Sender: "orders@ourvendor.com", Headers: []mail.Header{
+			{Name: "Authentication-Results", Value: "mx.example.net; spf=fail smtp.mailfrom=ourvendor.com; dmarc=fail header.from=ourvendor.com"},
+			{Name: "From", Value: "orders@ourvendor.com"},
+		}},
+	}
+	tests := []struct {
+		name    string
+		cfg     config.SenderAuthentication
+		wantIDs []string
+	}{
+		{name: "verdicts only", cfg: config.SenderAuthentication{TrustedAuthServIDs: []string{"mx.example.net"}}, wantIDs: []string{"signed", "spoofed"}},
+		{name: "required", cfg: config.SenderAuthentication{Required: true, TrustedAuthServIDs: []string{"mx.example.net"}}, wantIDs: []string{"signed"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logBuffer.Reset()
+			got := authenticateSenders(context.Background(), mails, tt.cfg)
+			var ids []string
+			for _, m := range got {
+				ids = append(ids, m.Id)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Fatalf("authenticateSenders() = %v, want %v", ids, tt.wantIDs)
+			}
+			if !got[0].Authentication.Pass {
+				t.Errorf("verdict of the signed mail = %+v, want pass", got[0].Authentication)
+			}
+			logged := strings.Contains(logBuffer.String(), "mailId=spoofed") && strings.Contains(logBuffer.String(), "dmarc=fail")
+			if logged != tt.cfg.Required {
+				t.Errorf("verdict of the spoofed mail logged = %v, want %v; log: %s", logged, tt.cfg.Required, logBuffer.String())
+			}
+		})
+	}
+}
+
 func Test_truncate(t *testing.T) {
 	tests := []struct {
 		name   string
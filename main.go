@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"log/slog"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 
 	"github.com/jo-hoe/go-mail-webhook-service/app/config"
+	"github.com/jo-hoe/go-mail-webhook-service/app/inbound"
 	"github.com/jo-hoe/go-mail-webhook-service/app/webhook"
 )
 
@@ -42,9 +46,21 @@ func main() {
 	}
 	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: level})))
 
+	// Server mode: receive pushed mails and push notifications until SIGINT/SIGTERM
+	if cfg.Inbound.Enabled() || cfg.MailClient.PushEnabled() {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := inbound.Run(ctx, cfg, webhook.NewWebhookService(cfg)); err != nil {
+			slog.Error("inbound server failed", "error", err)
+			stop()
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Process config once and exit (suitable for Kubernetes Job execution)
 	if failMailsCount := webhook.NewWebhookService(cfg).Run(); failMailsCount > 0 {
-		slog.Error("webhook sends failed", "errors", failMailsCount)
+		slog.Error("mail processing failed", "errors", failMailsCount)
 		os.Exit(1)
 	}
 }